@@ -4,7 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"github.com/nilium/go-md3/md3"
-	"io"
+	"github.com/nilium/go-md3/md3/shader"
+	"github.com/nilium/go-md3/md3/skin"
 	"io/ioutil"
 	"log"
 	"os"
@@ -13,6 +14,10 @@ import (
 type modelPathPair struct {
 	model *md3.Model
 	path  string
+	// skin is the skin to resolve the model's materials with, if any.
+	skin *skin.Skin
+	// shaders resolves the model's materials to their images.
+	shaders *shader.Resolver
 }
 
 const (
@@ -23,49 +28,106 @@ const (
 )
 
 var (
-	appMode = flag.String("mode", defaultMode, "One of convert, spec, or view.")
+	appMode  = flag.String("mode", defaultMode, "One of convert, spec, or view.")
+	skinPath = flag.String("skin", "", "A .skin file to resolve the materials of models' surfaces with.")
 )
 
-func dataForPath(path string) ([]byte, error) {
-	var r io.Reader
+// readModelForPath reads the MD3 model at the given path, which may refer to
+// a file within a pk3 archive. Files are decoded in place where possible;
+// standard input ("-") is read into memory first. Files in other formats,
+// such as OBJ, are imported by the importer for their extension.
+func readModelForPath(path string) (*md3.Model, error) {
 	if path == "-" {
-		r = os.Stdin
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return md3.Read(data)
+	}
+
+	if importer, ok := importerForPath(path); ok {
+		return importer(path)
+	}
+
+	fsys, name, err := fsForPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return md3.ReadFile(fsys, name)
+}
+
+// readSkinForPath reads the .skin file at the given path, which may refer to
+// a file within a pk3 archive.
+func readSkinForPath(path string) (*skin.Skin, error) {
+	fsys, name, err := fsForPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return skin.Parse(file)
+}
+
+// readPairForPath reads the model at the given path, along with the skin to
+// use for it, if any, and the resolver for its shaders.
+func readPairForPath(path string) (*modelPathPair, error) {
+	var err error
+	pair := &modelPathPair{path: path}
+
+	if *assemblePlayers {
+		pair.model, pair.skin, err = readPlayerForPath(path)
 	} else {
-		file, err := os.Open(path)
+		pair.model, err = readModelForPath(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if pair.shaders, err = shadersForPath(path); err != nil {
+		return nil, err
+	}
+
+	if *skinPath != "" {
+		s, err := readSkinForPath(*skinPath)
 		if err != nil {
 			return nil, err
 		}
-		r = file
-		defer file.Close()
+		if pair.skin != nil {
+			pair.skin.Merge(s)
+		} else {
+			pair.skin = s
+		}
 	}
 
-	return ioutil.ReadAll(r)
+	return pair, nil
 }
 
 func main() {
 	flag.Parse()
 
+	paths, err := expandPaths(flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	output := make(chan *modelPathPair)
 
-	for _, path := range flag.Args() {
+	for _, path := range paths {
 		go func(path string, output chan<- *modelPathPair) {
-			var model *md3.Model
-			var err error
-			var data []byte
-			data, err = dataForPath(path)
-
+			pair, err := readPairForPath(path)
 			if err != nil {
-				log.Printf("Error reading data for path %q:\n%s", path, err)
+				log.Printf("Error reading MD3 %q:\n%s", path, err)
 				output <- nil
 				return
 			}
 
-			model, err = md3.Read(data)
-			if err != nil {
-				log.Printf("Error reading MD3 header %q:\n%s", path, err)
-			}
-
-			output <- &modelPathPair{model, path}
+			output <- pair
 		}(path, output)
 	}
 
@@ -74,7 +136,7 @@ func main() {
 
 	switch *appMode {
 	case convertMode:
-		modelOutput, doneProcessingModels = convertModelsToOBJ()
+		modelOutput, doneProcessingModels = convertModels()
 	case viewMode:
 		panic("Unimplemented mode: view")
 	case specMode:
@@ -83,10 +145,12 @@ func main() {
 		panic(fmt.Errorf("Invalid mode: %q", *appMode))
 	}
 
-	nargs := flag.NArg()
-	for i := 0; i < nargs; i++ {
+	failed := false
+	for range paths {
 		if model, ok := <-output; ok && model != nil {
 			modelOutput <- model
+		} else {
+			failed = true
 		}
 	}
 
@@ -95,4 +159,8 @@ func main() {
 	if doneProcessingModels != nil {
 		<-doneProcessingModels
 	}
+
+	if failed {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,259 @@
+// Package anim reads the animation.cfg files that accompany Quake 3 player
+// models and maps animation times to model frames.
+package anim
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// Index identifies one of a player model's animations. The order of the
+// indices matches the order animations are listed in an animation.cfg file.
+type Index int
+
+const (
+	BothDeath1 Index = iota
+	BothDead1
+	BothDeath2
+	BothDead2
+	BothDeath3
+	BothDead3
+
+	TorsoGesture
+	TorsoAttack
+	TorsoAttack2
+	TorsoDrop
+	TorsoRaise
+	TorsoStand
+	TorsoStand2
+
+	LegsWalkCR
+	LegsWalk
+	LegsRun
+	LegsBack
+	LegsSwim
+	LegsJump
+	LegsLand
+	LegsJumpB
+	LegsLandB
+	LegsIdle
+	LegsIdleCR
+	LegsTurn
+
+	// The following torso animations were added by Team Arena. If a file
+	// doesn't define them, they fall back to TorsoGesture.
+	TorsoGetFlag
+	TorsoGuardBase
+	TorsoPatrol
+	TorsoFollowMe
+	TorsoAffirmative
+	TorsoNegative
+
+	// MaxAnimations is the number of animations an animation.cfg file can
+	// define.
+	MaxAnimations
+)
+
+const (
+	// LegsBackCR and LegsBackWalk aren't read from the file: they're
+	// LegsWalkCR and LegsWalk played in reverse.
+	LegsBackCR = MaxAnimations + iota
+	LegsBackWalk
+
+	// NumAnimations is the number of animations held by a Config.
+	NumAnimations
+)
+
+var indexNames = [NumAnimations]string{
+	"BOTH_DEATH1", "BOTH_DEAD1", "BOTH_DEATH2", "BOTH_DEAD2", "BOTH_DEATH3", "BOTH_DEAD3",
+	"TORSO_GESTURE", "TORSO_ATTACK", "TORSO_ATTACK2", "TORSO_DROP", "TORSO_RAISE", "TORSO_STAND", "TORSO_STAND2",
+	"LEGS_WALKCR", "LEGS_WALK", "LEGS_RUN", "LEGS_BACK", "LEGS_SWIM", "LEGS_JUMP", "LEGS_LAND", "LEGS_JUMPB",
+	"LEGS_LANDB", "LEGS_IDLE", "LEGS_IDLECR", "LEGS_TURN",
+	"TORSO_GETFLAG", "TORSO_GUARDBASE", "TORSO_PATROL", "TORSO_FOLLOWME", "TORSO_AFFIRMATIVE", "TORSO_NEGATIVE",
+	"LEGS_BACKCR", "LEGS_BACKWALK",
+}
+
+// String returns the name the Quake 3 source uses for the animation, such as
+// "TORSO_STAND".
+func (i Index) String() string {
+	if i < 0 || i >= NumAnimations {
+		return fmt.Sprintf("Index(%d)", int(i))
+	}
+	return indexNames[i]
+}
+
+// IndexByName returns the animation with the given name, as returned by
+// Index.String.
+func IndexByName(name string) (Index, bool) {
+	for index, indexName := range indexNames {
+		if indexName == name {
+			return Index(index), true
+		}
+	}
+	return 0, false
+}
+
+// Part identifies which of a player's models an animation's frames belong to.
+type Part int
+
+const (
+	// Both animations are played by the legs and torso at once, and their
+	// frames are present in both models.
+	Both Part = iota
+	Torso
+	Legs
+)
+
+// Part returns the model the animation's frames belong to.
+func (i Index) Part() Part {
+	switch {
+	case i < TorsoGesture:
+		return Both
+	case i < LegsWalkCR, i >= TorsoGetFlag && i < MaxAnimations:
+		return Torso
+	default:
+		return Legs
+	}
+}
+
+type Sex byte
+
+const (
+	Male   Sex = 'm'
+	Female Sex = 'f'
+	Neuter Sex = 'n'
+)
+
+type Footsteps int
+
+const (
+	FootstepsNormal Footsteps = iota
+	FootstepsBoot
+	FootstepsFlesh
+	FootstepsMech
+	FootstepsEnergy
+)
+
+// Animation is a range of frames in a player model.
+type Animation struct {
+	// FirstFrame is the index of the animation's first frame in the model
+	// it belongs to. For legs animations, this has already been adjusted to
+	// skip the torso frames, which aren't present in the legs model.
+	FirstFrame int
+	NumFrames  int
+	// LoopFrames is the number of frames at the end of the animation that
+	// repeat once it has played through. If zero, the animation holds its
+	// last frame.
+	LoopFrames int
+	FPS        float32
+	// Reversed animations play from their last frame to their first.
+	Reversed bool
+}
+
+// Duration returns the time it takes to play through the animation once.
+func (a *Animation) Duration() time.Duration {
+	return time.Duration(float64(a.NumFrames) / float64(a.FPS) * float64(time.Second))
+}
+
+// Frame returns the model frame for the given step of the animation, where
+// step 0 is its first frame, wrapping around its loop frames or holding its
+// last frame as the engine does.
+func (a *Animation) Frame(step int) int {
+	if step >= a.NumFrames {
+		if a.LoopFrames > 0 {
+			step = a.NumFrames - a.LoopFrames + (step-a.NumFrames)%a.LoopFrames
+		} else {
+			step = a.NumFrames - 1
+		}
+	}
+
+	if a.Reversed {
+		return a.FirstFrame + a.NumFrames - 1 - step
+	}
+	return a.FirstFrame + step
+}
+
+// FramesAt returns the pair of model frames to interpolate between at time t
+// into the animation and the fraction to interpolate by, suitable for passing
+// to md3.Surface.LerpVertices or md3.Tag.Lerp.
+func (a *Animation) FramesAt(t time.Duration) (frameA, frameB int, frac float32) {
+	if a.NumFrames <= 0 {
+		return a.FirstFrame, a.FirstFrame, 0
+	}
+
+	if t < 0 {
+		t = 0
+	}
+
+	steps := t.Seconds() * float64(a.FPS)
+	step := math.Floor(steps)
+	if step >= math.MaxInt32 {
+		step = math.MaxInt32 - 1
+	}
+
+	frameA = a.Frame(int(step))
+	frameB = a.Frame(int(step) + 1)
+	if frameA == frameB {
+		return frameA, frameB, 0
+	}
+	return frameA, frameB, float32(steps - step)
+}
+
+// Config is the contents of a player model's animation.cfg file.
+type Config struct {
+	Sex        Sex
+	Footsteps  Footsteps
+	HeadOffset md3.Vec3
+	FixedLegs  bool
+	FixedTorso bool
+	Animations [NumAnimations]Animation
+}
+
+// Animation returns the animation with the given index.
+func (c *Config) Animation(index Index) *Animation {
+	return &c.Animations[index]
+}
+
+// FramesAt returns the frames and interpolation fraction of the animation
+// with the given index at time t, as Animation.FramesAt does.
+func (c *Config) FramesAt(index Index, t time.Duration) (frameA, frameB int, frac float32) {
+	return c.Animations[index].FramesAt(t)
+}
+
+// Validate checks that every animation's frames are present in the model it
+// belongs to: legs animations in legs, torso animations in torso, and both
+// animations in each of them. Either model may be nil, in which case the
+// animations belonging to it are not checked.
+func (c *Config) Validate(legs, torso *md3.Model) error {
+	for index := Index(0); index < NumAnimations; index++ {
+		var models []*md3.Model
+		switch index.Part() {
+		case Both:
+			models = []*md3.Model{legs, torso}
+		case Torso:
+			models = []*md3.Model{torso}
+		case Legs:
+			models = []*md3.Model{legs}
+		}
+
+		a := &c.Animations[index]
+		for _, model := range models {
+			if model == nil {
+				continue
+			}
+
+			numFrames := model.NumFrames()
+			switch {
+			case a.FirstFrame < 0, a.NumFrames < 0, a.FirstFrame+a.NumFrames > numFrames:
+				return fmt.Errorf("anim: %v frames [%d, %d) are outside of model %q's %d frames",
+					index, a.FirstFrame, a.FirstFrame+a.NumFrames, model.Name(), numFrames)
+			case a.LoopFrames < 0, a.LoopFrames > a.NumFrames:
+				return fmt.Errorf("anim: %v has %d loop frames but only %d frames", index, a.LoopFrames, a.NumFrames)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package anim
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/token"
+)
+
+// Parse reads an animation.cfg file from r.
+//
+// As in Quake 3, the file may begin with any of the options "sex",
+// "footsteps", "headoffset", "fixedlegs", and "fixedtorso", followed by the
+// first frame, number of frames, number of looping frames, and frames per
+// second of each animation, in the order given by Index. Unrecognized options
+// are ignored, as they are by the engine.
+//
+// Legs animations are numbered in the file as though the legs model held the
+// torso animations' frames as well. Parse adjusts their first frames so that
+// they index the legs model's frames instead.
+func Parse(r io.Reader) (*Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s := token.NewScanner(data)
+	c := &Config{Sex: Male}
+
+	if err := c.parseOptions(s); err != nil {
+		return nil, err
+	}
+
+	if err := c.parseAnimations(s); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Config) parseOptions(s *token.Scanner) error {
+	for {
+		tok, ok := s.Peek()
+		if !ok {
+			return nil
+		} else if tok == "" {
+			return fmt.Errorf("anim: line %d: empty token", s.Line())
+		} else if (tok[0] >= '0' && tok[0] <= '9') || tok[0] == '-' {
+			return nil
+		}
+		s.Next()
+
+		switch strings.ToLower(tok) {
+		case "footsteps":
+			tok, _ = s.Next()
+			switch strings.ToLower(tok) {
+			case "default", "normal":
+				c.Footsteps = FootstepsNormal
+			case "boot":
+				c.Footsteps = FootstepsBoot
+			case "flesh":
+				c.Footsteps = FootstepsFlesh
+			case "mech":
+				c.Footsteps = FootstepsMech
+			case "energy":
+				c.Footsteps = FootstepsEnergy
+			default:
+				return fmt.Errorf("anim: line %d: invalid footsteps %q", s.Line(), tok)
+			}
+		case "headoffset":
+			var v [3]float32
+			for i := range v {
+				f, err := parseFloat(s)
+				if err != nil {
+					return err
+				}
+				v[i] = f
+			}
+			c.HeadOffset = md3.Vec3{X: v[0], Y: v[1], Z: v[2]}
+		case "sex":
+			tok, _ = s.Next()
+			switch strings.ToLower(tok + " ")[0] {
+			case 'f':
+				c.Sex = Female
+			case 'n':
+				c.Sex = Neuter
+			default:
+				c.Sex = Male
+			}
+		case "fixedlegs":
+			c.FixedLegs = true
+		case "fixedtorso":
+			c.FixedTorso = true
+		}
+	}
+}
+
+func (c *Config) parseAnimations(s *token.Scanner) error {
+	var skip int
+
+	for index := Index(0); index < MaxAnimations; index++ {
+		a := &c.Animations[index]
+
+		if _, ok := s.Peek(); !ok {
+			// Files predating Team Arena lack its torso animations, which
+			// the engine replaces with the gesture animation.
+			if index >= TorsoGetFlag {
+				*a = c.Animations[TorsoGesture]
+				a.Reversed = false
+				continue
+			}
+			return fmt.Errorf("anim: line %d: expected %d animations, found %d", s.Line(), MaxAnimations, index)
+		}
+
+		var fields [3]int
+		for i := range fields {
+			n, err := parseInt(s)
+			if err != nil {
+				return fmt.Errorf("%v (reading %v)", err, index)
+			}
+			fields[i] = n
+		}
+
+		fps, err := parseFloat(s)
+		if err != nil {
+			return fmt.Errorf("%v (reading %v)", err, index)
+		}
+
+		a.FirstFrame, a.NumFrames, a.LoopFrames, a.FPS = fields[0], fields[1], fields[2], fps
+
+		// The legs model lacks the torso animations' frames, so the legs
+		// animations' first frames are shifted down past them.
+		if index == LegsWalkCR {
+			skip = a.FirstFrame - c.Animations[TorsoGesture].FirstFrame
+		}
+		if index >= LegsWalkCR && index < TorsoGetFlag {
+			a.FirstFrame -= skip
+		}
+
+		if a.NumFrames < 0 {
+			a.NumFrames = -a.NumFrames
+			a.Reversed = true
+		}
+
+		if a.FPS == 0 {
+			a.FPS = 1
+		}
+	}
+
+	c.Animations[LegsBackCR] = c.Animations[LegsWalkCR]
+	c.Animations[LegsBackCR].Reversed = true
+	c.Animations[LegsBackWalk] = c.Animations[LegsWalk]
+	c.Animations[LegsBackWalk].Reversed = true
+
+	return nil
+}
+
+func parseInt(s *token.Scanner) (int, error) {
+	tok, ok := s.Next()
+	if !ok {
+		return 0, fmt.Errorf("anim: line %d: unexpected end of file", s.Line())
+	}
+
+	n, err := strconv.Atoi(tok)
+	if err != nil {
+		return 0, fmt.Errorf("anim: line %d: invalid integer %q", s.Line(), tok)
+	}
+	return n, nil
+}
+
+func parseFloat(s *token.Scanner) (float32, error) {
+	tok, ok := s.Next()
+	if !ok {
+		return 0, fmt.Errorf("anim: line %d: unexpected end of file", s.Line())
+	}
+
+	f, err := strconv.ParseFloat(tok, 32)
+	if err != nil {
+		return 0, fmt.Errorf("anim: line %d: invalid number %q", s.Line(), tok)
+	}
+	return float32(f), nil
+}
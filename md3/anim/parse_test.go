@@ -0,0 +1,212 @@
+package anim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// sargeAnimations are the animations of baseq3's sarge, which predate Team
+// Arena's torso animations.
+const sargeAnimations = `
+0	30	0	25		// BOTH_DEATH1
+29	1	0	25		// BOTH_DEAD1
+30	30	0	25		// BOTH_DEATH2
+59	1	0	25		// BOTH_DEAD2
+60	30	0	25		// BOTH_DEATH3
+89	1	0	25		// BOTH_DEAD3
+
+90	40	0	20		// TORSO_GESTURE
+130	6	0	15		// TORSO_ATTACK
+136	6	0	15		// TORSO_ATTACK2
+142	5	0	20		// TORSO_DROP
+147	4	0	20		// TORSO_RAISE
+151	1	0	15		// TORSO_STAND
+152	1	0	15		// TORSO_STAND2
+
+153	8	8	20		// LEGS_WALKCR
+161	12	12	20		// LEGS_WALK
+173	9	9	18		// LEGS_RUN
+182	-10	10	20		// LEGS_BACK
+192	10	10	15		// LEGS_SWIM
+202	8	0	15		// LEGS_JUMP
+210	1	0	15		// LEGS_LAND
+211	8	0	15		// LEGS_JUMPB
+219	1	0	15		// LEGS_LANDB
+220	10	10	15		// LEGS_IDLE
+230	10	10	15		// LEGS_IDLECR
+240	7	7	0		// LEGS_TURN
+`
+
+func mustParse(t *testing.T, cfg string) *Config {
+	t.Helper()
+	c, err := Parse(strings.NewReader(cfg))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return c
+}
+
+func TestParseOptions(t *testing.T) {
+	c := mustParse(t, `// animation config file
+sex f
+footsteps boot
+headoffset 1.5 -2 3
+fixedlegs
+fixedtorso
+unknownoption
+`+sargeAnimations)
+
+	if c.Sex != Female {
+		t.Errorf("Sex = %q, want %q", c.Sex, Female)
+	}
+	if c.Footsteps != FootstepsBoot {
+		t.Errorf("Footsteps = %d, want %d", c.Footsteps, FootstepsBoot)
+	}
+	if want := (md3.Vec3{X: 1.5, Y: -2, Z: 3}); c.HeadOffset != want {
+		t.Errorf("HeadOffset = %v, want %v", c.HeadOffset, want)
+	}
+	if !c.FixedLegs || !c.FixedTorso {
+		t.Errorf("FixedLegs, FixedTorso = %t, %t; want true, true", c.FixedLegs, c.FixedTorso)
+	}
+
+	c = mustParse(t, sargeAnimations)
+	if c.Sex != Male || c.Footsteps != FootstepsNormal || c.FixedLegs || c.FixedTorso {
+		t.Errorf("defaults = %q, %d, %t, %t; want %q, %d, false, false",
+			c.Sex, c.Footsteps, c.FixedLegs, c.FixedTorso, Male, FootstepsNormal)
+	}
+}
+
+func TestParseAnimations(t *testing.T) {
+	c := mustParse(t, sargeAnimations)
+
+	tests := []struct {
+		index Index
+		want  Animation
+	}{
+		{BothDeath1, Animation{FirstFrame: 0, NumFrames: 30, FPS: 25}},
+		{TorsoGesture, Animation{FirstFrame: 90, NumFrames: 40, FPS: 20}},
+		{TorsoStand2, Animation{FirstFrame: 152, NumFrames: 1, FPS: 15}},
+
+		// Legs animations skip the 63 frames of torso animations.
+		{LegsWalkCR, Animation{FirstFrame: 90, NumFrames: 8, LoopFrames: 8, FPS: 20}},
+		{LegsIdle, Animation{FirstFrame: 157, NumFrames: 10, LoopFrames: 10, FPS: 15}},
+
+		// Negative frame counts play in reverse, and zero FPS becomes one.
+		{LegsBack, Animation{FirstFrame: 119, NumFrames: 10, LoopFrames: 10, FPS: 20, Reversed: true}},
+		{LegsTurn, Animation{FirstFrame: 177, NumFrames: 7, LoopFrames: 7, FPS: 1}},
+
+		// Team Arena's torso animations fall back to TORSO_GESTURE.
+		{TorsoGetFlag, Animation{FirstFrame: 90, NumFrames: 40, FPS: 20}},
+		{TorsoNegative, Animation{FirstFrame: 90, NumFrames: 40, FPS: 20}},
+
+		// The backwards walks are the forward walks reversed.
+		{LegsBackCR, Animation{FirstFrame: 90, NumFrames: 8, LoopFrames: 8, FPS: 20, Reversed: true}},
+		{LegsBackWalk, Animation{FirstFrame: 98, NumFrames: 12, LoopFrames: 12, FPS: 20, Reversed: true}},
+	}
+
+	for _, tt := range tests {
+		if got := *c.Animation(tt.index); got != tt.want {
+			t.Errorf("%v = %+v, want %+v", tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestParseTeamArenaAnimations(t *testing.T) {
+	c := mustParse(t, sargeAnimations+`
+90	40	0	20	// TORSO_GETFLAG
+130	-6	0	15	// TORSO_GUARDBASE
+136	6	0	15	// TORSO_PATROL
+142	5	0	20	// TORSO_FOLLOWME
+147	4	0	20	// TORSO_AFFIRMATIVE
+151	1	0	15	// TORSO_NEGATIVE
+`)
+
+	// Team Arena's torso animations aren't shifted as the legs animations
+	// before them are.
+	want := Animation{FirstFrame: 130, NumFrames: 6, FPS: 15, Reversed: true}
+	if got := *c.Animation(TorsoGuardBase); got != want {
+		t.Errorf("%v = %+v, want %+v", TorsoGuardBase, got, want)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name, cfg string
+	}{
+		{"empty", ""},
+		{"empty token", "sex m\n\"\" 0 1 0 20\n"},
+		{"empty animation token", "0 30 \"\" 25\n"},
+		{"invalid footsteps", "footsteps tiptoe\n" + sargeAnimations},
+		{"missing footsteps", "footsteps"},
+		{"short headoffset", "headoffset 1 2"},
+		{"invalid integer", strings.Replace(sargeAnimations, "29", "2x9", 1)},
+		{"invalid number", strings.Replace(sargeAnimations, "25", "fast", 1)},
+		{"truncated animation", "0 30 0"},
+		{"too few animations", sargeAnimations[:strings.Index(sargeAnimations, "153")]},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(strings.NewReader(tt.cfg)); err == nil {
+			t.Errorf("%s: Parse() error = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestAnimationFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     Animation
+		steps []int
+	}{
+		{"looping", Animation{FirstFrame: 10, NumFrames: 4, LoopFrames: 2}, []int{10, 11, 12, 13, 12, 13, 12}},
+		{"holding", Animation{FirstFrame: 10, NumFrames: 4}, []int{10, 11, 12, 13, 13, 13, 13}},
+		{"reversed", Animation{FirstFrame: 10, NumFrames: 4, LoopFrames: 4, Reversed: true}, []int{13, 12, 11, 10, 13, 12, 11}},
+	}
+
+	for _, tt := range tests {
+		for step, want := range tt.steps {
+			if got := tt.a.Frame(step); got != want {
+				t.Errorf("%s: Frame(%d) = %d, want %d", tt.name, step, got, want)
+			}
+		}
+	}
+}
+
+func TestAnimationFramesAt(t *testing.T) {
+	looping := Animation{FirstFrame: 10, NumFrames: 4, LoopFrames: 2, FPS: 10}
+	holding := Animation{FirstFrame: 10, NumFrames: 4, FPS: 10}
+
+	tests := []struct {
+		name           string
+		a              Animation
+		t              time.Duration
+		frameA, frameB int
+		frac           float32
+	}{
+		{"start", looping, 0, 10, 11, 0},
+		{"before start", looping, -time.Second, 10, 11, 0},
+		{"between", looping, 150 * time.Millisecond, 11, 12, 0.5},
+		{"into loop", looping, 350 * time.Millisecond, 13, 12, 0.5},
+		{"looped", looping, 1050 * time.Millisecond, 12, 13, 0.5},
+		{"held", holding, time.Second, 13, 13, 0},
+		{"empty", Animation{FirstFrame: 7}, time.Second, 7, 7, 0},
+	}
+
+	for _, tt := range tests {
+		frameA, frameB, frac := tt.a.FramesAt(tt.t)
+		if frameA != tt.frameA || frameB != tt.frameB || abs(frac-tt.frac) > 1e-4 {
+			t.Errorf("%s: FramesAt(%v) = %d, %d, %f; want %d, %d, %f",
+				tt.name, tt.t, frameA, frameB, frac, tt.frameA, tt.frameB, tt.frac)
+		}
+	}
+}
+
+func abs(f float32) float32 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
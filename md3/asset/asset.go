@@ -0,0 +1,136 @@
+// Package asset loads MD3 models along with the skins, shaders and textures
+// they reference, from any fs.FS such as a pk3.FS over a game directory.
+package asset
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/shader"
+	"github.com/nilium/go-md3/md3/skin"
+)
+
+// Asset is a model and the files it references.
+type Asset struct {
+	// Name is the path of the model within its filesystem.
+	Name  string
+	Model *md3.Model
+	// Skins holds the skins found beside the model, keyed by skin name:
+	// "models/players/sarge/upper_red.skin" is the "red" skin of
+	// "models/players/sarge/upper.md3".
+	Skins map[string]*skin.Skin
+	// Shaders resolves the model's shader names against the shader scripts
+	// and images of the filesystem.
+	Shaders *shader.Resolver
+}
+
+// Load reads the named model from fsys along with its skins and the shader
+// scripts of fsys.
+func Load(fsys fs.FS, name string) (*Asset, error) {
+	model, err := md3.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("asset: %s: %w", name, err)
+	}
+
+	a := &Asset{
+		Name:    name,
+		Model:   model,
+		Skins:   make(map[string]*skin.Skin),
+		Shaders: shader.NewResolver(fsys),
+	}
+
+	if err := a.Shaders.LoadScripts(fsys); err != nil {
+		return nil, fmt.Errorf("asset: %w", err)
+	}
+
+	if err := a.loadSkins(fsys); err != nil {
+		return nil, fmt.Errorf("asset: %w", err)
+	}
+
+	return a, nil
+}
+
+// loadSkins reads every skin file beside the model whose name begins with the
+// model's base name and an underscore.
+func (a *Asset) loadSkins(fsys fs.FS) error {
+	dir := path.Dir(a.Name)
+	base := path.Base(a.Name)
+	prefix := strings.ToLower(strings.TrimSuffix(base, path.Ext(base)) + "_")
+
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		lower := strings.ToLower(entry.Name())
+		if entry.IsDir() || !strings.HasPrefix(lower, prefix) || path.Ext(lower) != ".skin" {
+			continue
+		}
+
+		file, err := fsys.Open(path.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		s, err := skin.Parse(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path.Join(dir, entry.Name()), err)
+		}
+
+		a.Skins[strings.TrimSuffix(lower[len(prefix):], ".skin")] = s
+	}
+
+	return nil
+}
+
+// SkinNames returns the names of the model's skins in sorted order.
+func (a *Asset) SkinNames() []string {
+	names := make([]string, 0, len(a.Skins))
+	for name := range a.Skins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Material returns the shader used for the surface with the given skin, which
+// may be empty to use the surface's own shader. It returns false if the
+// shader has neither a script definition nor an image.
+func (a *Asset) Material(surf *md3.Surface, skinName string) (*shader.Shader, bool) {
+	name := a.Skins[skinName].Material(surf)
+	if name == "" {
+		return nil, false
+	}
+	return a.Shaders.Resolve(name)
+}
+
+// Textures returns the base textures of the model's surfaces with the given
+// skin, which may be empty to use the surfaces' own shaders. Each texture is
+// listed once, in the order of the surfaces first using it. Surfaces whose
+// shaders can't be resolved are skipped.
+func (a *Asset) Textures(skinName string) []string {
+	var textures []string
+	seen := make(map[string]bool)
+
+	for _, surf := range a.Model.AllSurfaces() {
+		sh, ok := a.Material(surf, skinName)
+		if !ok {
+			continue
+		}
+
+		texture := sh.BaseTexture()
+		if texture == "" || seen[strings.ToLower(texture)] {
+			continue
+		}
+		seen[strings.ToLower(texture)] = true
+		textures = append(textures, texture)
+	}
+
+	return textures
+}
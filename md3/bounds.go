@@ -0,0 +1,135 @@
+package md3
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Limits on the number of elements in an MD3 file, as enforced by the
+// Quake 3 renderer. Counts outside of these are rejected before anything is
+// allocated for them.
+const (
+	maxFrames    = 1024
+	maxTags      = 16
+	maxSurfaces  = 32
+	maxShaders   = 256
+	maxVertices  = 4096
+	maxTriangles = 8192
+)
+
+var (
+	// ErrOutOfBounds is wrapped by a FormatError when an offset or size in
+	// the file refers to data outside of it.
+	ErrOutOfBounds = errors.New("out of bounds")
+	// ErrLimitExceeded is wrapped by a FormatError when a count in the file is
+	// negative or exceeds the limits of the MD3 format.
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrFrameMismatch is wrapped by a FormatError when a surface or tag in
+	// the file does not have the same number of frames as the model.
+	ErrFrameMismatch = errors.New("frame count mismatch")
+)
+
+func checkCount(name string, count int32, limit int) error {
+	if count < 0 || int(count) > limit {
+		return fmt.Errorf("%w: %s count %d not in range [0, %d]", ErrLimitExceeded, name, count, limit)
+	}
+	return nil
+}
+
+// checkRange returns an error if the length bytes at offset do not lie within
+// [0, size).
+func checkRange(name string, offset, length, size int64) error {
+	if offset < 0 || length < 0 || offset > size || length > size-offset {
+		return fmt.Errorf("%w: %s at offset %d with length %d exceeds file size %d", ErrOutOfBounds, name, offset, length, size)
+	}
+	return nil
+}
+
+// checkHeader validates the counts and offsets of the file header against the
+// limits of the format and the size of the file.
+func (d *Decoder) checkHeader(h *fileHeader) error {
+	var (
+		numFrames = int64(h.num_frames)
+		numTags   = int64(h.num_tags)
+	)
+
+	errs := [...]error{
+		checkCount("frame", h.num_frames, maxFrames),
+		checkCount("tag", h.num_tags, maxTags),
+		checkCount("surface", h.num_surfaces, maxSurfaces),
+		checkRange("frames", int64(h.ofs_frames), numFrames*md3FrameSize, d.size),
+		checkRange("tags", int64(h.ofs_tags), numFrames*numTags*md3TagSize, d.size),
+		checkRange("surfaces", int64(h.ofs_surfaces), 0, d.size),
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSurfaceHeader validates the counts and offsets of a surface header,
+// whose surface begins at offset, against the limits of the format, the size
+// of the file, and the number of frames given by the file header.
+func (d *Decoder) checkSurfaceHeader(h *surfaceHeader, offset int64, numModelFrames int32) error {
+	var (
+		numFrames    = int64(h.num_frames)
+		numShaders   = int64(h.num_shaders)
+		numVerts     = int64(h.num_verts)
+		numTriangles = int64(h.num_triangles)
+	)
+
+	if h.ofs_end < md3SurfaceHeaderSize {
+		return fmt.Errorf("%w: surface end offset %d precedes end of surface header", ErrOutOfBounds, h.ofs_end)
+	}
+
+	end := int64(h.ofs_end)
+	errs := [...]error{
+		checkCount("frame", h.num_frames, maxFrames),
+		checkCount("shader", h.num_shaders, maxShaders),
+		checkCount("vertex", h.num_verts, maxVertices),
+		checkCount("triangle", h.num_triangles, maxTriangles),
+		checkRange("surface", offset, end, d.size),
+		checkRange("triangles", int64(h.ofs_triangles), numTriangles*md3TriangleSize, end),
+		checkRange("shaders", int64(h.ofs_shaders), numShaders*md3ShaderSize, end),
+		checkRange("texcoords", int64(h.ofs_st), numVerts*md3TexCoordSize, end),
+		checkRange("vertices", int64(h.ofs_xyznormal), numFrames*numVerts*md3VertexSize, end),
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.num_frames != numModelFrames {
+		return fmt.Errorf("%w: surface frame count %d differs from model frame count %d", ErrFrameMismatch, h.num_frames, numModelFrames)
+	}
+	return nil
+}
+
+// checkTriangles returns an error if any triangle refers to a vertex outside
+// of [0, numVertices).
+func checkTriangles(tris []Triangle, numVertices int) error {
+	for index, tri := range tris {
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			if v < 0 || int(v) >= numVertices {
+				return fmt.Errorf("%w: triangle %d refers to vertex %d of %d", ErrOutOfBounds, index, v, numVertices)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTags returns an error if any tag does not have numFrames frames, as
+// happens when a tag's name differs between frames.
+func checkTags(tags []*Tag, numFrames int) error {
+	for _, tag := range tags {
+		if len(tag.frames) != numFrames {
+			return fmt.Errorf("%w: tag %q has %d frames of %d", ErrFrameMismatch, tag.name, len(tag.frames), numFrames)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package md3
+
+import (
+	"fmt"
+	"math"
+)
+
+// ModelBuilder constructs Models. A builder may start out empty, via
+// NewModelBuilder, or as a copy of an existing model, via
+// NewModelBuilderFrom. Once built, the resulting Model shares no memory with
+// the builder, so the builder may continue to be modified and built again.
+type ModelBuilder struct {
+	name     string
+	frames   []Frame
+	tags     []*Tag
+	surfaces []*SurfaceBuilder
+}
+
+// SurfaceBuilder constructs a single surface of a ModelBuilder's model. Every
+// surface must have one frame of vertices for each of the model's frames and
+// one texcoord for each vertex in a frame.
+type SurfaceBuilder struct {
+	name      string
+	shaders   []Shader
+	triangles []Triangle
+	texcoords []TexCoord
+	vertices  [][]Vertex
+}
+
+// NewModelBuilder returns an empty ModelBuilder for a model with the given
+// name.
+func NewModelBuilder(name string) *ModelBuilder {
+	return &ModelBuilder{name: name}
+}
+
+// NewModelBuilderFrom returns a ModelBuilder holding a copy of the model m.
+func NewModelBuilderFrom(m *Model) *ModelBuilder {
+	b := NewModelBuilder(m.name)
+
+	for _, frame := range m.frames {
+		b.frames = append(b.frames, *frame)
+	}
+
+	for _, tag := range m.tags {
+		b.AddTag(tag.name, tag.frames...)
+	}
+
+	for _, surf := range m.surfaces {
+		sb := b.AddSurface(surf.name)
+		sb.shaders = append(sb.shaders, surf.shaders...)
+		sb.triangles = append(sb.triangles, surf.triangles...)
+		sb.texcoords = append(sb.texcoords, surf.texcoords...)
+		for _, vertices := range surf.vertices {
+			sb.AddVertexFrame(vertices)
+		}
+	}
+
+	return b
+}
+
+func (b *ModelBuilder) Name() string {
+	return b.name
+}
+
+func (b *ModelBuilder) SetName(name string) {
+	b.name = name
+}
+
+func (b *ModelBuilder) NumFrames() int {
+	return len(b.frames)
+}
+
+// AddFrame adds a frame to the model and returns its index. Each surface and
+// tag must be given a frame of data to match it before the model is built.
+func (b *ModelBuilder) AddFrame(name string, min, max, origin Vec3, radius float32) int {
+	b.frames = append(b.frames, Frame{name, min, max, origin, radius})
+	return len(b.frames) - 1
+}
+
+// SetFrameName renames the frame at the given index.
+func (b *ModelBuilder) SetFrameName(index int, name string) {
+	b.frames[index].name = name
+}
+
+// ComputeFrameBounds recalculates the bounds and radius of every frame from
+// the vertices of the model's surfaces. Each frame's origin is left as-is
+// and its radius is measured from that origin to the furthest corner of its
+// bounds, as the Quake 3 tools do.
+func (b *ModelBuilder) ComputeFrameBounds() {
+	for index := range b.frames {
+		frame := &b.frames[index]
+		first := true
+		for _, surf := range b.surfaces {
+			if index >= len(surf.vertices) {
+				continue
+			}
+
+			for _, vert := range surf.vertices[index] {
+				p := vert.Origin
+				if first {
+					frame.min, frame.max = p, p
+					first = false
+					continue
+				}
+				frame.min = Vec3{min(frame.min.X, p.X), min(frame.min.Y, p.Y), min(frame.min.Z, p.Z)}
+				frame.max = Vec3{max(frame.max.X, p.X), max(frame.max.Y, p.Y), max(frame.max.Z, p.Z)}
+			}
+		}
+
+		if first {
+			frame.min, frame.max = frame.origin, frame.origin
+		}
+
+		frame.radius = radiusFromBounds(frame.min, frame.max, frame.origin)
+	}
+}
+
+// TrimFrames removes all frames outside of [first, first+count) from the
+// model and from each of its surfaces and tags. An error is returned, and the
+// model left unchanged, if the range isn't within the frames of the model
+// and of each of its surfaces and tags.
+func (b *ModelBuilder) TrimFrames(first, count int) error {
+	end := first + count
+	if first < 0 || count < 0 || end > len(b.frames) {
+		return fmt.Errorf("Frames [%d, %d) are outside of the model's %d frames", first, end, len(b.frames))
+	}
+	for _, tag := range b.tags {
+		if end > len(tag.frames) {
+			return fmt.Errorf("Frames [%d, %d) are outside of tag %q's %d frames", first, end, tag.name, len(tag.frames))
+		}
+	}
+	for _, surf := range b.surfaces {
+		if end > len(surf.vertices) {
+			return fmt.Errorf("Frames [%d, %d) are outside of surface %q's %d frames", first, end, surf.name, len(surf.vertices))
+		}
+	}
+
+	b.frames = append([]Frame(nil), b.frames[first:end]...)
+
+	for _, tag := range b.tags {
+		tag.frames = append([]TagFrame(nil), tag.frames[first:end]...)
+	}
+
+	for _, surf := range b.surfaces {
+		surf.vertices = append([][]Vertex(nil), surf.vertices[first:end]...)
+	}
+
+	return nil
+}
+
+func (b *ModelBuilder) NumTags() int {
+	return len(b.tags)
+}
+
+// AddTag adds a tag with the given name and frames. If the model already has
+// a tag with the same name, its frames are replaced.
+func (b *ModelBuilder) AddTag(name string, frames ...TagFrame) {
+	frames = append([]TagFrame(nil), frames...)
+	if tag := b.tag(name); tag != nil {
+		tag.frames = frames
+		return
+	}
+	b.tags = append(b.tags, &Tag{name, frames})
+}
+
+// SetTagFrame sets the frame of the named tag at the given index. It returns
+// false if the model has no such tag.
+func (b *ModelBuilder) SetTagFrame(name string, frame int, tf TagFrame) bool {
+	tag := b.tag(name)
+	if tag == nil {
+		return false
+	}
+	tag.frames[frame] = tf
+	return true
+}
+
+// RenameTag renames the tag named from to to. It returns false if the model
+// has no tag named from.
+func (b *ModelBuilder) RenameTag(from, to string) bool {
+	tag := b.tag(from)
+	if tag == nil {
+		return false
+	}
+	tag.name = to
+	return true
+}
+
+// RemoveTag removes the named tag from the model. It returns false if the
+// model has no such tag.
+func (b *ModelBuilder) RemoveTag(name string) bool {
+	for index, tag := range b.tags {
+		if tag.name == name {
+			b.tags = append(b.tags[:index], b.tags[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *ModelBuilder) tag(name string) *Tag {
+	for _, tag := range b.tags {
+		if tag.name == name {
+			return tag
+		}
+	}
+	return nil
+}
+
+func (b *ModelBuilder) NumSurfaces() int {
+	return len(b.surfaces)
+}
+
+// AddSurface adds an empty surface with the given name to the model and
+// returns its builder.
+func (b *ModelBuilder) AddSurface(name string) *SurfaceBuilder {
+	surf := &SurfaceBuilder{name: name}
+	b.surfaces = append(b.surfaces, surf)
+	return surf
+}
+
+func (b *ModelBuilder) Surface(index int) *SurfaceBuilder {
+	return b.surfaces[index]
+}
+
+// RemoveSurface removes the surface at the given index from the model.
+func (b *ModelBuilder) RemoveSurface(index int) {
+	b.surfaces = append(b.surfaces[:index], b.surfaces[index+1:]...)
+}
+
+// Build checks the model for consistency and returns it. An error is
+// returned if the model cannot be written as an MD3 file, such as when a
+// surface or tag is missing frames, a triangle refers to a vertex that
+// doesn't exist, or a name is too long.
+func (b *ModelBuilder) Build() (*Model, error) {
+	m := &Model{
+		name:     b.name,
+		frames:   make([]*Frame, len(b.frames)),
+		tags:     make([]*Tag, len(b.tags)),
+		surfaces: make([]*Surface, len(b.surfaces)),
+	}
+
+	for index := range b.frames {
+		frame := b.frames[index]
+		m.frames[index] = &frame
+	}
+
+	for index, tag := range b.tags {
+		m.tags[index] = &Tag{tag.name, append([]TagFrame(nil), tag.frames...)}
+	}
+
+	for index, surf := range b.surfaces {
+		m.surfaces[index] = surf.build()
+	}
+
+	if err := checkModel(m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *SurfaceBuilder) Name() string {
+	return s.name
+}
+
+func (s *SurfaceBuilder) SetName(name string) {
+	s.name = name
+}
+
+func (s *SurfaceBuilder) NumShaders() int {
+	return len(s.shaders)
+}
+
+// AddShader adds a shader with the given name to the surface.
+func (s *SurfaceBuilder) AddShader(name string) {
+	s.shaders = append(s.shaders, Shader{Name: name, Index: int32(len(s.shaders))})
+}
+
+// SetShader renames the shader at the given index.
+func (s *SurfaceBuilder) SetShader(index int, name string) {
+	s.shaders[index].Name = name
+}
+
+func (s *SurfaceBuilder) NumVertices() int {
+	return len(s.texcoords)
+}
+
+// SetTexCoords sets the texcoords of the surface's vertices. The number of
+// texcoords determines the number of vertices in each of the surface's
+// frames.
+func (s *SurfaceBuilder) SetTexCoords(texcoords []TexCoord) {
+	s.texcoords = append([]TexCoord(nil), texcoords...)
+}
+
+func (s *SurfaceBuilder) NumTriangles() int {
+	return len(s.triangles)
+}
+
+// AddTriangle adds a triangle of the three vertex indices to the surface.
+func (s *SurfaceBuilder) AddTriangle(a, b, c int32) {
+	s.triangles = append(s.triangles, Triangle{a, b, c})
+}
+
+// SetTriangles replaces the surface's triangles.
+func (s *SurfaceBuilder) SetTriangles(triangles []Triangle) {
+	s.triangles = append([]Triangle(nil), triangles...)
+}
+
+func (s *SurfaceBuilder) NumFrames() int {
+	return len(s.vertices)
+}
+
+// AddVertexFrame adds a frame of vertices to the surface and returns its
+// index.
+func (s *SurfaceBuilder) AddVertexFrame(vertices []Vertex) int {
+	s.vertices = append(s.vertices, append([]Vertex(nil), vertices...))
+	return len(s.vertices) - 1
+}
+
+// SetVertexFrame replaces the vertices of the given frame.
+func (s *SurfaceBuilder) SetVertexFrame(frame int, vertices []Vertex) {
+	s.vertices[frame] = append([]Vertex(nil), vertices...)
+}
+
+func (s *SurfaceBuilder) build() *Surface {
+	surf := &Surface{
+		name:      s.name,
+		numFrames: len(s.vertices),
+		shaders:   append([]Shader(nil), s.shaders...),
+		triangles: append([]Triangle(nil), s.triangles...),
+		texcoords: append([]TexCoord(nil), s.texcoords...),
+		vertices:  make([][]Vertex, len(s.vertices)),
+	}
+
+	for frame, vertices := range s.vertices {
+		surf.vertices[frame] = append([]Vertex(nil), vertices...)
+	}
+
+	return surf
+}
+
+// radiusFromBounds returns the distance from origin to the corner of the
+// bounds [min, max] furthest from it.
+func radiusFromBounds(min, max, origin Vec3) float32 {
+	corner := func(lo, hi, o float32) float64 {
+		return math.Max(math.Abs(float64(lo-o)), math.Abs(float64(hi-o)))
+	}
+	x := corner(min.X, max.X, origin.X)
+	y := corner(min.Y, max.Y, origin.Y)
+	z := corner(min.Z, max.Z, origin.Z)
+	return float32(math.Sqrt(x*x + y*y + z*z))
+}
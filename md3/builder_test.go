@@ -0,0 +1,200 @@
+package md3
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildRejectsInconsistent(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(b *ModelBuilder)
+	}{
+		{"tag missing frame", func(b *ModelBuilder) {
+			b.AddTag("tag_head", TagFrame{})
+		}},
+		{"surface missing frame", func(b *ModelBuilder) {
+			b.AddFrame("extra", Vec3{}, Vec3{}, Vec3{}, 0)
+			b.AddTag("tag_head", TagFrame{}, TagFrame{}, TagFrame{})
+			b.AddTag("tag_weapon", TagFrame{}, TagFrame{}, TagFrame{})
+		}},
+		{"frame missing vertices", func(b *ModelBuilder) {
+			b.Surface(0).SetVertexFrame(1, make([]Vertex, 3))
+		}},
+		{"triangle past vertices", func(b *ModelBuilder) {
+			b.Surface(1).AddTriangle(0, 1, 3)
+		}},
+		{"negative triangle index", func(b *ModelBuilder) {
+			b.Surface(1).AddTriangle(-1, 1, 2)
+		}},
+		{"long model name", func(b *ModelBuilder) {
+			b.SetName(strings.Repeat("m", maxQPath))
+		}},
+		{"long frame name", func(b *ModelBuilder) {
+			b.SetFrameName(0, strings.Repeat("f", maxFrameLength))
+		}},
+		{"long shader name", func(b *ModelBuilder) {
+			b.Surface(0).SetShader(0, strings.Repeat("s", maxQPath))
+		}},
+		{"too many tags", func(b *ModelBuilder) {
+			for index := range maxTags {
+				b.AddTag(strings.Repeat("t", index+1), TagFrame{}, TagFrame{})
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewModelBuilderFrom(testModel(t))
+			tt.modify(b)
+			if m, err := b.Build(); err == nil {
+				t.Errorf("Build() = %v, want error", m)
+			}
+		})
+	}
+}
+
+func TestNewModelBuilderFromCopies(t *testing.T) {
+	m := testModel(t)
+	want := testModel(t)
+
+	b := NewModelBuilderFrom(m)
+	b.SetName("models/test/other.md3")
+	b.SetFrameName(0, "other")
+	b.SetTagFrame("tag_head", 0, TagFrame{Origin: Vec3{X: 100}})
+	b.RenameTag("tag_weapon", "tag_flag")
+	surf := b.Surface(0)
+	surf.SetName("other")
+	surf.SetShader(0, "textures/test/other.tga")
+	surf.SetVertexFrame(0, make([]Vertex, surf.NumVertices()))
+	b.Surface(1).AddTriangle(0, 1, 2)
+	if _, err := b.Build(); err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("modifying the builder modified its source model")
+	}
+
+	// Nor should building hand the builder's memory to the model.
+	built, err := NewModelBuilderFrom(m).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	b = NewModelBuilderFrom(built)
+	b.Surface(0).SetVertexFrame(1, make([]Vertex, 4))
+	if !reflect.DeepEqual(built, want) {
+		t.Errorf("modifying a builder modified a model built from it")
+	}
+}
+
+func TestComputeFrameBounds(t *testing.T) {
+	b := NewModelBuilder("bounds")
+	b.AddFrame("offset", Vec3{}, Vec3{}, Vec3{X: 1}, 0)
+	b.AddFrame("empty", Vec3{}, Vec3{}, Vec3{Z: 2}, 0)
+
+	a := b.AddSurface("a")
+	a.SetTexCoords(make([]TexCoord, 2))
+	a.AddVertexFrame([]Vertex{{Origin: Vec3{-2, 0, 1}}, {Origin: Vec3{3, 4, -1}}})
+	a.AddVertexFrame([]Vertex{})
+
+	c := b.AddSurface("c")
+	c.SetTexCoords(make([]TexCoord, 1))
+	c.AddVertexFrame([]Vertex{{Origin: Vec3{0, -5, 2}}})
+
+	b.ComputeFrameBounds()
+
+	frame := b.frames[0]
+	if want := (Vec3{-2, -5, -1}); frame.min != want {
+		t.Errorf("frame 0 min = %v, want %v", frame.min, want)
+	}
+	if want := (Vec3{3, 4, 2}); frame.max != want {
+		t.Errorf("frame 0 max = %v, want %v", frame.max, want)
+	}
+	if want := (Vec3{X: 1}); frame.origin != want {
+		t.Errorf("frame 0 origin = %v, want %v", frame.origin, want)
+	}
+	// The corner furthest from the origin is (-2, -5, 2), or (-3, -5, 2)
+	// from the origin.
+	if want := float32(math.Sqrt(9 + 25 + 4)); math.Abs(float64(frame.radius-want)) > 1e-5 {
+		t.Errorf("frame 0 radius = %v, want %v", frame.radius, want)
+	}
+
+	// A frame with no vertices collapses to its origin.
+	frame = b.frames[1]
+	if want := (Vec3{Z: 2}); frame.min != want || frame.max != want || frame.radius != 0 {
+		t.Errorf("frame 1 bounds = [%v, %v] radius %v, want [%v, %v] radius 0", frame.min, frame.max, frame.radius, want, want)
+	}
+}
+
+func TestTrimFrames(t *testing.T) {
+	b := NewModelBuilderFrom(testModel(t))
+	if err := b.TrimFrames(1, 1); err != nil {
+		t.Fatalf("TrimFrames(1, 1) error = %v", err)
+	}
+
+	m, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	want := testModel(t)
+	if m.NumFrames() != 1 || m.Frame(0).Name() != "walk" {
+		t.Errorf("frames after trim = %d, first %q; want 1, %q", m.NumFrames(), m.Frame(0).Name(), "walk")
+	}
+	if got, want := m.Tag(0).Frame(0), want.Tag(0).Frame(1); got != want {
+		t.Errorf("tag frame after trim = %v, want %v", got, want)
+	}
+	if got, want := m.Surface(1).Vertex(0, 2), want.Surface(1).Vertex(1, 2); got != want {
+		t.Errorf("vertex after trim = %v, want %v", got, want)
+	}
+}
+
+// frameCounts returns the number of frames of the builder's model, followed
+// by those of each of its tags and surfaces.
+func frameCounts(b *ModelBuilder) []int {
+	counts := []int{len(b.frames)}
+	for _, tag := range b.tags {
+		counts = append(counts, len(tag.frames))
+	}
+	for _, surf := range b.surfaces {
+		counts = append(counts, len(surf.vertices))
+	}
+	return counts
+}
+
+func TestTrimFramesRejectsRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		first, count int
+		modify       func(b *ModelBuilder)
+	}{
+		{"negative first", -1, 1, nil},
+		{"negative count", 1, -1, nil},
+		{"past end", 1, 2, nil},
+		{"past tag frames", 0, 2, func(b *ModelBuilder) {
+			b.AddTag("tag_head", TagFrame{})
+		}},
+		{"past surface frames", 1, 1, func(b *ModelBuilder) {
+			b.Surface(1).vertices = b.Surface(1).vertices[:1]
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewModelBuilderFrom(testModel(t))
+			if tt.modify != nil {
+				tt.modify(b)
+			}
+			before := frameCounts(b)
+
+			if err := b.TrimFrames(tt.first, tt.count); err == nil {
+				t.Fatalf("TrimFrames(%d, %d) returned no error", tt.first, tt.count)
+			}
+			if after := frameCounts(b); !reflect.DeepEqual(after, before) {
+				t.Errorf("TrimFrames(%d, %d) changed frame counts from %v to %v", tt.first, tt.count, before, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package md3
+
+import "fmt"
+
+// FormatError is returned when part of an MD3 file cannot be decoded, either
+// because the data is truncated or because it is malformed.
+type FormatError struct {
+	// Section names the part of the file being read, such as "header",
+	// "frames", "tags", "surface header", "triangles", "shaders",
+	// "texcoords", or "vertices".
+	Section string
+	// Surface is the index of the surface being read, or -1 if the section
+	// does not belong to a surface.
+	Surface int
+	// Offset is the byte offset in the file of the data that could not be
+	// read.
+	Offset int64
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *FormatError) Error() string {
+	if e.Surface >= 0 {
+		return fmt.Sprintf("md3: error reading %s of surface %d at offset %d: %v", e.Section, e.Surface, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("md3: error reading %s at offset %d: %v", e.Section, e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
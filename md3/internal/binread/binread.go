@@ -0,0 +1,66 @@
+// Package binread decodes the little-endian structures of binary model
+// files, such as MDR, MDC and IQM files, held in memory, checking every
+// range against the data before decoding or allocating anything for it.
+package binread
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// CheckRange returns an error if count elements of the given size at ofs
+// don't fit in data.
+func CheckRange(data []byte, ofs, count, size int64) error {
+	switch {
+	case count < 0:
+		return fmt.Errorf("negative count %d", count)
+	case count == 0:
+		return nil
+	case count > int64(len(data))/size:
+		return fmt.Errorf("%d elements don't fit in the file", count)
+	case ofs < 0 || ofs+count*size > int64(len(data)):
+		return errors.New("outside of file")
+	}
+	return nil
+}
+
+// ReadAt decodes size bytes of data at ofs into dst.
+func ReadAt(data []byte, ofs, size int64, dst any) error {
+	if err := CheckRange(data, ofs, 1, size); err != nil {
+		return err
+	}
+	return binary.Read(bytes.NewReader(data[ofs:ofs+size]), binary.LittleEndian, dst)
+}
+
+// ReadSlice decodes count elements of the given size from data at ofs. The
+// range is checked against data before anything is allocated, so counts
+// from a damaged header can't exhaust memory.
+func ReadSlice[T any](data []byte, ofs, count, size int64) ([]T, error) {
+	if err := CheckRange(data, ofs, count, size); err != nil || count == 0 {
+		return nil, err
+	}
+
+	s := make([]T, count)
+	if err := binary.Read(bytes.NewReader(data[ofs:ofs+count*size]), binary.LittleEndian, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Vec3 converts an array of X, Y and Z components to a vector.
+func Vec3(v [3]float32) md3.Vec3 {
+	return md3.Vec3{X: v[0], Y: v[1], Z: v[2]}
+}
+
+// NulString returns the contents of a fixed-size string field, up to its
+// first NUL byte.
+func NulString(b []byte) string {
+	if index := bytes.IndexByte(b, 0); index != -1 {
+		b = b[:index]
+	}
+	return string(b)
+}
@@ -0,0 +1,154 @@
+// Package token splits Quake 3 script files, such as animation.cfg and
+// .shader files, into tokens the same way the engine's COM_ParseExt does:
+// tokens are separated by whitespace, may be quoted, and "//" and "/* */"
+// comments are skipped.
+package token
+
+// Scanner reads tokens from a script.
+type Scanner struct {
+	data []byte
+	pos  int
+	line int
+}
+
+// NewScanner returns a Scanner reading tokens from data.
+func NewScanner(data []byte) *Scanner {
+	return &Scanner{data: data, line: 1}
+}
+
+// Line returns the line number of the scanner's position, starting at 1.
+func (s *Scanner) Line() int {
+	return s.line
+}
+
+// Next returns the next token, crossing line breaks if needed. It returns
+// false once there are no tokens left.
+func (s *Scanner) Next() (string, bool) {
+	return s.next(true)
+}
+
+// NextOnLine returns the next token on the current line. It returns false if
+// there are no tokens left on the line, leaving the scanner at the line
+// break.
+func (s *Scanner) NextOnLine() (string, bool) {
+	return s.next(false)
+}
+
+// Peek returns the next token, as Next does, without consuming it.
+func (s *Scanner) Peek() (string, bool) {
+	m := s.Mark()
+	tok, ok := s.Next()
+	s.Reset(m)
+	return tok, ok
+}
+
+// Mark is a position in a script, as returned by Scanner.Mark.
+type Mark struct {
+	pos, line int
+}
+
+// Mark returns the scanner's current position.
+func (s *Scanner) Mark() Mark {
+	return Mark{s.pos, s.line}
+}
+
+// Reset returns the scanner to a position returned by Mark.
+func (s *Scanner) Reset(m Mark) {
+	s.pos, s.line = m.pos, m.line
+}
+
+// SkipBracedSection skips the next token, which should be "{", and every
+// token up to and including its matching "}", as the engine's
+// SkipBracedSection does. It stops at the end of the script if the braces
+// aren't balanced.
+func (s *Scanner) SkipBracedSection() {
+	depth := 0
+	for {
+		tok, ok := s.Next()
+		if !ok {
+			return
+		}
+
+		switch tok {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+		if depth <= 0 {
+			return
+		}
+	}
+}
+
+// skipSpace skips whitespace and comments. If lineBreaks is false, it stops
+// at a line break and returns false.
+func (s *Scanner) skipSpace(lineBreaks bool) bool {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case c == '\n':
+			if !lineBreaks {
+				return false
+			}
+			s.line++
+			s.pos++
+		case c <= ' ':
+			s.pos++
+		case c == '/' && s.peekByte(1) == '/':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+		case c == '/' && s.peekByte(1) == '*':
+			s.pos += 2
+			for s.pos < len(s.data) && !(s.data[s.pos] == '*' && s.peekByte(1) == '/') {
+				if s.data[s.pos] == '\n' {
+					s.line++
+				}
+				s.pos++
+			}
+			s.pos += 2
+			if s.pos > len(s.data) {
+				s.pos = len(s.data)
+			}
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+func (s *Scanner) peekByte(offset int) byte {
+	if s.pos+offset < len(s.data) {
+		return s.data[s.pos+offset]
+	}
+	return 0
+}
+
+func (s *Scanner) next(lineBreaks bool) (string, bool) {
+	if !s.skipSpace(lineBreaks) || s.pos >= len(s.data) {
+		return "", false
+	}
+
+	if s.data[s.pos] == '"' {
+		s.pos++
+		start := s.pos
+		for s.pos < len(s.data) && s.data[s.pos] != '"' {
+			if s.data[s.pos] == '\n' {
+				s.line++
+			}
+			s.pos++
+		}
+		tok := string(s.data[start:s.pos])
+		if s.pos < len(s.data) {
+			s.pos++
+		}
+		return tok, true
+	}
+
+	start := s.pos
+	for s.pos < len(s.data) && s.data[s.pos] > ' ' {
+		s.pos++
+	}
+	return string(s.data[start:s.pos]), true
+}
@@ -0,0 +1,190 @@
+package iqm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// maxFrameName is the size of an MD3 frame name, including its terminating
+// NUL.
+const maxFrameName = 16
+
+// TagPrefix is the prefix of the names of joints that become MD3 tags.
+const TagPrefix = "tag_"
+
+// JointTransforms returns the transform of each joint from its own space to
+// the model's in the given frame, or in the bind pose if frame is -1.
+func (m *Model) JointTransforms(frame int) []md3.TagFrame {
+	transforms := make([]md3.TagFrame, len(m.Joints))
+	for index, j := range m.Joints {
+		local := j.Base
+		if frame >= 0 {
+			local = m.Frames[frame][index]
+		}
+
+		transforms[index] = local.TagFrame()
+		if j.Parent >= 0 {
+			transforms[index] = transforms[j.Parent].Compose(transforms[index])
+		}
+	}
+	return transforms
+}
+
+// Skin returns the model's vertices posed by the given joint transforms, as
+// returned by JointTransforms. Each vertex is moved from its bind pose by
+// each of its joints' change from their own bind poses, blended by their
+// weights. If the model has no normals, each vertex is given the average of
+// the normals of the triangles using it, weighted by their area.
+//
+// The vertices are written to dst, which is grown if it isn't large enough
+// to hold them, and the resulting slice is returned.
+func (m *Model) Skin(dst []md3.Vertex, joints []md3.TagFrame) []md3.Vertex {
+	if cap(dst) < len(m.Vertices) {
+		dst = make([]md3.Vertex, len(m.Vertices))
+	}
+	dst = dst[:len(m.Vertices)]
+
+	bind := m.JointTransforms(-1)
+	skin := make([]md3.TagFrame, len(joints))
+	for index, j := range joints {
+		skin[index] = j.Compose(bind[index].Inverse())
+	}
+
+	for index, v := range m.Vertices {
+		var origin, normal md3.Vec3
+		var total float32
+		for k, j := range v.Joints {
+			w := v.Weights[k]
+			if w == 0 || int(j) >= len(skin) {
+				continue
+			}
+			origin = origin.Add(skin[j].Transform(v.Position).Scale(w))
+			normal = normal.Add(skin[j].Rotate(v.Normal).Scale(w))
+			total += w
+		}
+
+		if total == 0 {
+			origin, normal = v.Position, v.Normal
+		} else if total != 1 {
+			origin, normal = origin.Scale(1/total), normal.Scale(1/total)
+		}
+		dst[index] = md3.Vertex{Origin: origin, Normal: normal.Normalize()}
+	}
+
+	if !m.HasNormals {
+		m.smoothNormals(dst)
+	}
+
+	return dst
+}
+
+// smoothNormals sets the normal of each of vertices to the average of the
+// normals of the triangles using it, weighted by their area.
+func (m *Model) smoothNormals(vertices []md3.Vertex) {
+	normals := make([]md3.Vec3, len(vertices))
+	for _, tri := range m.Triangles {
+		a, b, c := vertices[tri.A].Origin, vertices[tri.B].Origin, vertices[tri.C].Origin
+		// MD3 triangles are wound clockwise.
+		n := c.Sub(a).Cross(b.Sub(a))
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			normals[v] = normals[v].Add(n)
+		}
+	}
+
+	for index, n := range normals {
+		if n.Len() == 0 {
+			n = md3.Vec3{Z: 1}
+		}
+		vertices[index].Normal = n.Normalize()
+	}
+}
+
+// ToMD3 bakes the model into an MD3 model with the given name, skinning its
+// vertices for each of its frames, or in the bind pose if it has none. Each
+// mesh becomes a surface whose only shader is the mesh's material, and each
+// joint whose name starts with TagPrefix becomes a tag following the joint.
+// Frames are named after the animations they belong to, truncated to fit
+// MD3's limit, and their bounds are computed from their vertices.
+func (m *Model) ToMD3(name string) (*md3.Model, error) {
+	b := md3.NewModelBuilder(name)
+
+	for index, mesh := range m.Meshes {
+		surfName := mesh.Name
+		if surfName == "" {
+			surfName = fmt.Sprintf("mesh%d", index)
+		}
+
+		sb := b.AddSurface(surfName)
+		if mesh.Material != "" {
+			sb.AddShader(mesh.Material)
+		}
+
+		base := int32(mesh.FirstVertex)
+		for _, tri := range m.Triangles[mesh.FirstTriangle : mesh.FirstTriangle+mesh.NumTriangles] {
+			sb.AddTriangle(tri.A-base, tri.B-base, tri.C-base)
+		}
+
+		texcoords := make([]md3.TexCoord, mesh.NumVertices)
+		for index, v := range m.Vertices[mesh.FirstVertex : mesh.FirstVertex+mesh.NumVertices] {
+			texcoords[index] = v.TexCoord
+		}
+		sb.SetTexCoords(texcoords)
+	}
+
+	var tags []int
+	for index, j := range m.Joints {
+		if strings.HasPrefix(strings.ToLower(j.Name), TagPrefix) {
+			tags = append(tags, index)
+		}
+	}
+
+	frames := []int{-1}
+	if len(m.Frames) > 0 {
+		frames = frames[:0]
+		for frame := range m.Frames {
+			frames = append(frames, frame)
+		}
+	}
+
+	tagFrames := make([][]md3.TagFrame, len(tags))
+	var vertices []md3.Vertex
+	for _, frame := range frames {
+		b.AddFrame(m.frameName(frame), md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+
+		joints := m.JointTransforms(frame)
+		vertices = m.Skin(vertices, joints)
+		for index, mesh := range m.Meshes {
+			surfVertices := vertices[mesh.FirstVertex : mesh.FirstVertex+mesh.NumVertices]
+			b.Surface(index).AddVertexFrame(append([]md3.Vertex(nil), surfVertices...))
+		}
+
+		for index, joint := range tags {
+			tagFrames[index] = append(tagFrames[index], joints[joint].Orthonormalize())
+		}
+	}
+
+	for index, joint := range tags {
+		b.AddTag(m.Joints[joint].Name, tagFrames[index]...)
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
+
+// frameName returns the name of the first animation including the given
+// frame, truncated to fit in an MD3 frame name, or an empty string if no
+// animation includes it.
+func (m *Model) frameName(frame int) string {
+	for _, a := range m.Anims {
+		if frame >= a.FirstFrame && frame < a.FirstFrame+a.NumFrames {
+			name := a.Name
+			if len(name) >= maxFrameName {
+				name = name[:maxFrameName-1]
+			}
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,635 @@
+// Package iqm reads and writes Inter-Quake Models (IQM version 2) and bakes
+// their skeletal animation into MD3 models.
+//
+// IQM files are read as ioquake3 reads them: in Quake's axes, with texcoords
+// and triangle winding the same as MD3's, so no conversion is needed between
+// the two.
+package iqm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/binread"
+)
+
+const (
+	iqmMagic   = "INTERQUAKEMODEL\x00"
+	iqmVersion = 2
+
+	iqmHeaderSize      = 124
+	iqmMeshSize        = 24
+	iqmVertexArraySize = 20
+	iqmTriangleSize    = 12
+	iqmJointSize       = 48
+	iqmPoseSize        = 88
+	iqmAnimSize        = 20
+	iqmBoundsSize      = 32
+
+	// Vertex array types.
+	iqmPosition     = 0
+	iqmTexCoord     = 1
+	iqmNormal       = 2
+	iqmBlendIndexes = 4
+	iqmBlendWeights = 5
+
+	// Vertex array formats.
+	iqmByte   = 0
+	iqmUByte  = 1
+	iqmShort  = 2
+	iqmUShort = 3
+	iqmInt    = 4
+	iqmUInt   = 5
+	iqmHalf   = 6
+	iqmFloat  = 7
+	iqmDouble = 8
+
+	iqmAnimLoop = 1
+
+	// Pose channels: translation, rotation as a quaternion, and scale.
+	numChannels = 10
+
+	// MaxJoints is the largest number of joints a model may have, as in
+	// ioquake3.
+	MaxJoints = 128
+	// MaxFrames is the largest number of frames a model may have, the most
+	// an MD3 model can hold. Frames whose channels are all constant take no
+	// space in the file, so their count can't be checked against its size.
+	MaxFrames = 1024
+)
+
+// Transform is a joint's translation, rotation and scale relative to its
+// parent, applied in the order scale, rotation, translation.
+type Transform struct {
+	Translate md3.Vec3
+	Rotate    md3.Quat
+	Scale     md3.Vec3
+}
+
+// IdentityTransform returns a transform that leaves points as they are.
+func IdentityTransform() Transform {
+	return Transform{Rotate: md3.Quat{W: 1}, Scale: md3.Vec3{X: 1, Y: 1, Z: 1}}
+}
+
+// TagFrame returns the transform as a tag frame, whose axes are the rotated
+// and scaled basis vectors.
+func (t Transform) TagFrame() md3.TagFrame {
+	x, y, z := t.Rotate.Normalize().Axes()
+	return md3.TagFrame{
+		Origin:       t.Translate,
+		XOrientation: x.Scale(t.Scale.X),
+		YOrientation: y.Scale(t.Scale.Y),
+		ZOrientation: z.Scale(t.Scale.Z),
+	}
+}
+
+// Joint is a bone of the model's skeleton. Its base transform places it in
+// its bind pose relative to its parent, which precedes it in the model's
+// list of joints, or relative to the model if Parent is -1.
+type Joint struct {
+	Name   string
+	Parent int
+	Base   Transform
+}
+
+// Mesh is a range of the model's vertices and triangles drawn with a single
+// material. Its triangles only refer to its own vertices.
+type Mesh struct {
+	Name          string
+	Material      string
+	FirstVertex   int
+	NumVertices   int
+	FirstTriangle int
+	NumTriangles  int
+}
+
+// Vertex is a vertex in the bind pose, with the indices of up to four joints
+// influencing it and their weights. Vertices of models without joints, or
+// whose weights are all zero, aren't moved by animation.
+type Vertex struct {
+	Position md3.Vec3
+	Normal   md3.Vec3
+	TexCoord md3.TexCoord
+	Joints   [4]uint8
+	Weights  [4]float32
+}
+
+// Anim is a named range of the model's frames.
+type Anim struct {
+	Name       string
+	FirstFrame int
+	NumFrames  int
+	FrameRate  float32
+	Loop       bool
+}
+
+// Bounds are the bounds of a frame: its box, and the radii of the spheres
+// around the model's origin enclosing the box in the XY plane and in full.
+type Bounds struct {
+	Min, Max         md3.Vec3
+	XYRadius, Radius float32
+}
+
+// Model is the contents of an IQM file. Triangles index the model's whole
+// list of vertices. Each frame holds a transform for every joint, relative
+// to its parent, replacing the joint's base transform. Bounds, if present,
+// hold the bounds of each frame.
+type Model struct {
+	Meshes     []Mesh
+	Vertices   []Vertex
+	Triangles  []md3.Triangle
+	Joints     []Joint
+	Frames     [][]Transform
+	Anims      []Anim
+	Bounds     []Bounds
+	HasNormals bool
+}
+
+type header struct {
+	Magic            [16]byte
+	Version          uint32
+	FileSize         uint32
+	Flags            uint32
+	NumText          uint32
+	OfsText          uint32
+	NumMeshes        uint32
+	OfsMeshes        uint32
+	NumVertexArrays  uint32
+	NumVertexes      uint32
+	OfsVertexArrays  uint32
+	NumTriangles     uint32
+	OfsTriangles     uint32
+	OfsAdjacency     uint32
+	NumJoints        uint32
+	OfsJoints        uint32
+	NumPoses         uint32
+	OfsPoses         uint32
+	NumAnims         uint32
+	OfsAnims         uint32
+	NumFrames        uint32
+	NumFrameChannels uint32
+	OfsFrames        uint32
+	OfsBounds        uint32
+	NumComment       uint32
+	OfsComment       uint32
+	NumExtensions    uint32
+	OfsExtensions    uint32
+}
+
+type mesh struct {
+	Name          uint32
+	Material      uint32
+	FirstVertex   uint32
+	NumVertexes   uint32
+	FirstTriangle uint32
+	NumTriangles  uint32
+}
+
+type vertexArray struct {
+	Type   uint32
+	Flags  uint32
+	Format uint32
+	Size   uint32
+	Offset uint32
+}
+
+type joint struct {
+	Name      uint32
+	Parent    int32
+	Translate [3]float32
+	Rotate    [4]float32
+	Scale     [3]float32
+}
+
+type pose struct {
+	Parent        int32
+	Mask          uint32
+	ChannelOffset [numChannels]float32
+	ChannelScale  [numChannels]float32
+}
+
+type anim struct {
+	Name       uint32
+	FirstFrame uint32
+	NumFrames  uint32
+	FrameRate  float32
+	Flags      uint32
+}
+
+type bounds struct {
+	Min, Max         [3]float32
+	XYRadius, Radius float32
+}
+
+// formatSizes holds the size of a single component of each vertex array
+// format.
+var formatSizes = [...]int64{
+	iqmByte:   1,
+	iqmUByte:  1,
+	iqmShort:  2,
+	iqmUShort: 2,
+	iqmInt:    4,
+	iqmUInt:   4,
+	iqmHalf:   2,
+	iqmFloat:  4,
+	iqmDouble: 8,
+}
+
+// Decode reads an IQM model from r.
+func Decode(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read reads an IQM model from data. Every offset is checked against the
+// size of data and every index against the list it refers to, so a model
+// returned without error is safe to pose.
+func Read(data []byte) (*Model, error) {
+	var h header
+	if err := binread.ReadAt(data, 0, iqmHeaderSize, &h); err != nil {
+		return nil, fmt.Errorf("iqm: header: %v", err)
+	}
+
+	switch {
+	case string(h.Magic[:]) != iqmMagic:
+		return nil, fmt.Errorf("iqm: invalid magic %q", h.Magic[:])
+	case h.Version != iqmVersion:
+		return nil, fmt.Errorf("iqm: unsupported version %d", h.Version)
+	case h.NumJoints > MaxJoints:
+		return nil, fmt.Errorf("iqm: joint count %d is greater than %d", h.NumJoints, MaxJoints)
+	case h.NumFrames > MaxFrames:
+		return nil, fmt.Errorf("iqm: frame count %d is greater than %d", h.NumFrames, MaxFrames)
+	}
+
+	text, err := binread.ReadSlice[byte](data, int64(h.OfsText), int64(h.NumText), 1)
+	if err != nil {
+		return nil, fmt.Errorf("iqm: text: %v", err)
+	}
+	str := func(ofs uint32) (string, error) {
+		if int64(ofs) >= int64(len(text)) {
+			if ofs == 0 {
+				return "", nil
+			}
+			return "", fmt.Errorf("string at %d is outside of the text's %d bytes", ofs, len(text))
+		}
+		return binread.NulString(text[ofs:]), nil
+	}
+
+	m := &Model{}
+	steps := []struct {
+		name string
+		read func() error
+	}{
+		{"vertices", func() error { return m.readVertices(data, &h) }},
+		{"triangles", func() error { return m.readTriangles(data, &h) }},
+		{"meshes", func() error { return m.readMeshes(data, &h, str) }},
+		{"joints", func() error { return m.readJoints(data, &h, str) }},
+		{"frames", func() error { return m.readFrames(data, &h) }},
+		{"anims", func() error { return m.readAnims(data, &h, str) }},
+		{"bounds", func() error { return m.readBounds(data, &h) }},
+	}
+	for _, step := range steps {
+		if err := step.read(); err != nil {
+			return nil, fmt.Errorf("iqm: %s: %v", step.name, err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Model) readVertices(data []byte, h *header) error {
+	arrays, err := binread.ReadSlice[vertexArray](data, int64(h.OfsVertexArrays), int64(h.NumVertexArrays), iqmVertexArraySize)
+	if err != nil {
+		return err
+	}
+
+	numVertices := int64(h.NumVertexes)
+	if err := binread.CheckRange(data, 0, numVertices, 1); err != nil {
+		return err
+	}
+	m.Vertices = make([]Vertex, numVertices)
+	if numVertices == 0 {
+		// Empty arrays take no space, so their offsets aren't checked and
+		// mustn't be used.
+		return nil
+	}
+
+	for index, va := range arrays {
+		if va.Format >= uint32(len(formatSizes)) || va.Size == 0 {
+			return fmt.Errorf("array %d has invalid format %d or size %d", index, va.Format, va.Size)
+		}
+
+		size := int64(va.Size)
+		compSize := formatSizes[va.Format]
+		if err := binread.CheckRange(data, int64(va.Offset), numVertices*size, compSize); err != nil {
+			return fmt.Errorf("array %d: %v", index, err)
+		}
+
+		// Arrays of types other than these, such as tangents, colors and
+		// custom arrays, are skipped.
+		switch va.Type {
+		case iqmPosition, iqmNormal, iqmTexCoord, iqmBlendIndexes, iqmBlendWeights:
+		default:
+			continue
+		}
+
+		src := data[va.Offset:]
+		for v := range m.Vertices {
+			var values [4]float32
+			for k := range min(size, 4) {
+				values[k] = decodeComponent(src[(int64(v)*size+k)*compSize:], va.Format, va.Type == iqmBlendWeights)
+			}
+
+			vert := &m.Vertices[v]
+			switch va.Type {
+			case iqmPosition:
+				vert.Position = md3.Vec3{X: values[0], Y: values[1], Z: values[2]}
+			case iqmNormal:
+				vert.Normal = md3.Vec3{X: values[0], Y: values[1], Z: values[2]}
+			case iqmTexCoord:
+				vert.TexCoord = md3.TexCoord{S: values[0], T: values[1]}
+			case iqmBlendIndexes:
+				for k, value := range values {
+					if value < 0 || value > 255 {
+						return fmt.Errorf("vertex %d has invalid joint index %v", v, value)
+					}
+					vert.Joints[k] = uint8(value)
+				}
+			case iqmBlendWeights:
+				vert.Weights = values
+			}
+		}
+
+		if va.Type == iqmNormal {
+			m.HasNormals = true
+		}
+	}
+
+	return nil
+}
+
+// decodeComponent decodes a single vertex array component of the given
+// format. Integer weights are normalized to [0, 1].
+func decodeComponent(b []byte, format uint32, normalize bool) float32 {
+	var value, max float64
+	switch format {
+	case iqmByte:
+		value, max = float64(int8(b[0])), math.MaxInt8
+	case iqmUByte:
+		value, max = float64(b[0]), math.MaxUint8
+	case iqmShort:
+		value, max = float64(int16(binary.LittleEndian.Uint16(b))), math.MaxInt16
+	case iqmUShort:
+		value, max = float64(binary.LittleEndian.Uint16(b)), math.MaxUint16
+	case iqmInt:
+		value, max = float64(int32(binary.LittleEndian.Uint32(b))), math.MaxInt32
+	case iqmUInt:
+		value, max = float64(binary.LittleEndian.Uint32(b)), math.MaxUint32
+	case iqmHalf:
+		return halfToFloat(binary.LittleEndian.Uint16(b))
+	case iqmFloat:
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	case iqmDouble:
+		return float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+	}
+
+	if normalize {
+		value /= max
+	}
+	return float32(value)
+}
+
+// halfToFloat converts an IEEE 754 half-precision float to a float32.
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal halves are normal floats.
+		value := float32(mant) / (1 << 24)
+		if sign != 0 {
+			value = -value
+		}
+		return value
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+func (m *Model) readTriangles(data []byte, h *header) error {
+	triangles, err := binread.ReadSlice[md3.Triangle](data, int64(h.OfsTriangles), int64(h.NumTriangles), iqmTriangleSize)
+	if err != nil {
+		return err
+	}
+
+	for index, tri := range triangles {
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			if v < 0 || int(v) >= len(m.Vertices) {
+				return fmt.Errorf("triangle %d refers to vertex %d of %d", index, v, len(m.Vertices))
+			}
+		}
+	}
+	m.Triangles = triangles
+	return nil
+}
+
+func (m *Model) readMeshes(data []byte, h *header, str func(uint32) (string, error)) error {
+	meshes, err := binread.ReadSlice[mesh](data, int64(h.OfsMeshes), int64(h.NumMeshes), iqmMeshSize)
+	if err != nil {
+		return err
+	}
+
+	for index, me := range meshes {
+		var (
+			firstVertex, numVertices   = int64(me.FirstVertex), int64(me.NumVertexes)
+			firstTriangle, numTriangle = int64(me.FirstTriangle), int64(me.NumTriangles)
+		)
+		if firstVertex+numVertices > int64(len(m.Vertices)) || firstTriangle+numTriangle > int64(len(m.Triangles)) {
+			return fmt.Errorf("mesh %d is outside of the model's vertices or triangles", index)
+		}
+
+		for _, tri := range m.Triangles[firstTriangle : firstTriangle+numTriangle] {
+			for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+				if int64(v) < firstVertex || int64(v) >= firstVertex+numVertices {
+					return fmt.Errorf("mesh %d refers to vertex %d outside of its own", index, v)
+				}
+			}
+		}
+
+		name, err := str(me.Name)
+		if err != nil {
+			return err
+		}
+		material, err := str(me.Material)
+		if err != nil {
+			return err
+		}
+
+		m.Meshes = append(m.Meshes, Mesh{
+			Name:          name,
+			Material:      material,
+			FirstVertex:   int(firstVertex),
+			NumVertices:   int(numVertices),
+			FirstTriangle: int(firstTriangle),
+			NumTriangles:  int(numTriangle),
+		})
+	}
+
+	return nil
+}
+
+func (m *Model) readJoints(data []byte, h *header, str func(uint32) (string, error)) error {
+	joints, err := binread.ReadSlice[joint](data, int64(h.OfsJoints), int64(h.NumJoints), iqmJointSize)
+	if err != nil {
+		return err
+	}
+
+	for index, j := range joints {
+		if j.Parent >= int32(index) || j.Parent < -1 {
+			return fmt.Errorf("joint %d has invalid parent %d", index, j.Parent)
+		}
+
+		name, err := str(j.Name)
+		if err != nil {
+			return err
+		}
+
+		m.Joints = append(m.Joints, Joint{
+			Name:   name,
+			Parent: int(j.Parent),
+			Base: Transform{
+				Translate: binread.Vec3(j.Translate),
+				Rotate:    md3.Quat{X: j.Rotate[0], Y: j.Rotate[1], Z: j.Rotate[2], W: j.Rotate[3]},
+				Scale:     binread.Vec3(j.Scale),
+			},
+		})
+	}
+
+	for index, v := range m.Vertices {
+		for k, j := range v.Joints {
+			if v.Weights[k] != 0 && int(j) >= len(m.Joints) {
+				return fmt.Errorf("vertex %d refers to joint %d of %d", index, j, len(m.Joints))
+			}
+		}
+	}
+
+	return nil
+}
+
+// readFrames decodes the model's frames. Each frame holds, for each pose, a
+// value for every channel set in the pose's mask, scaled by the channel's
+// scale and added to its offset; channels not in the mask are constant.
+func (m *Model) readFrames(data []byte, h *header) error {
+	if h.NumFrames == 0 {
+		return nil
+	}
+
+	if h.NumPoses != h.NumJoints {
+		return fmt.Errorf("model has %d poses for %d joints", h.NumPoses, h.NumJoints)
+	}
+
+	poses, err := binread.ReadSlice[pose](data, int64(h.OfsPoses), int64(h.NumPoses), iqmPoseSize)
+	if err != nil {
+		return err
+	}
+
+	var numChannelsUsed int64
+	for _, p := range poses {
+		for k := range numChannels {
+			if p.Mask&(1<<k) != 0 {
+				numChannelsUsed++
+			}
+		}
+	}
+	if numChannelsUsed != int64(h.NumFrameChannels) {
+		return fmt.Errorf("poses use %d channels, expected %d", numChannelsUsed, h.NumFrameChannels)
+	}
+
+	values, err := binread.ReadSlice[uint16](data, int64(h.OfsFrames), int64(h.NumFrames)*int64(h.NumFrameChannels), 2)
+	if err != nil {
+		return err
+	}
+
+	m.Frames = make([][]Transform, h.NumFrames)
+	for frame := range m.Frames {
+		transforms := make([]Transform, len(poses))
+		for index, p := range poses {
+			var channels [numChannels]float32
+			for k := range channels {
+				channels[k] = p.ChannelOffset[k]
+				if p.Mask&(1<<k) != 0 {
+					channels[k] += float32(values[0]) * p.ChannelScale[k]
+					values = values[1:]
+				}
+			}
+			transforms[index] = Transform{
+				Translate: md3.Vec3{X: channels[0], Y: channels[1], Z: channels[2]},
+				Rotate:    md3.Quat{X: channels[3], Y: channels[4], Z: channels[5], W: channels[6]},
+				Scale:     md3.Vec3{X: channels[7], Y: channels[8], Z: channels[9]},
+			}
+		}
+		m.Frames[frame] = transforms
+	}
+
+	return nil
+}
+
+func (m *Model) readAnims(data []byte, h *header, str func(uint32) (string, error)) error {
+	anims, err := binread.ReadSlice[anim](data, int64(h.OfsAnims), int64(h.NumAnims), iqmAnimSize)
+	if err != nil {
+		return err
+	}
+
+	for index, a := range anims {
+		if int64(a.FirstFrame)+int64(a.NumFrames) > int64(len(m.Frames)) {
+			return fmt.Errorf("anim %d has frames [%d, %d) of %d", index, a.FirstFrame, int64(a.FirstFrame)+int64(a.NumFrames), len(m.Frames))
+		}
+
+		name, err := str(a.Name)
+		if err != nil {
+			return err
+		}
+
+		m.Anims = append(m.Anims, Anim{
+			Name:       name,
+			FirstFrame: int(a.FirstFrame),
+			NumFrames:  int(a.NumFrames),
+			FrameRate:  a.FrameRate,
+			Loop:       a.Flags&iqmAnimLoop != 0,
+		})
+	}
+
+	return nil
+}
+
+func (m *Model) readBounds(data []byte, h *header) error {
+	if h.OfsBounds == 0 {
+		return nil
+	}
+
+	all, err := binread.ReadSlice[bounds](data, int64(h.OfsBounds), int64(h.NumFrames), iqmBoundsSize)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range all {
+		m.Bounds = append(m.Bounds, Bounds{
+			Min:      binread.Vec3(b.Min),
+			Max:      binread.Vec3(b.Max),
+			XYRadius: b.XYRadius,
+			Radius:   b.Radius,
+		})
+	}
+	return nil
+}
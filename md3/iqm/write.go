@@ -0,0 +1,231 @@
+package iqm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// Write writes the model to w as an IQM file. Positions and texcoords are
+// always written; normals are written if the model has them, and joint
+// indices and weights if it has joints. Each frame's channels are quantized
+// to 16 bits over the range the channel covers across all frames, and
+// channels that don't change are stored once, in their poses.
+func Write(w io.Writer, m *Model) error {
+	for frame, transforms := range m.Frames {
+		if len(transforms) != len(m.Joints) {
+			return fmt.Errorf("iqm: frame %d has %d transforms for %d joints", frame, len(transforms), len(m.Joints))
+		}
+	}
+	if len(m.Bounds) != 0 && len(m.Bounds) != len(m.Frames) {
+		return fmt.Errorf("iqm: model has %d bounds for %d frames", len(m.Bounds), len(m.Frames))
+	}
+
+	var (
+		h    = header{Version: iqmVersion}
+		body bytes.Buffer
+		text = []byte{0}
+		strs = map[string]uint32{"": 0}
+	)
+	copy(h.Magic[:], iqmMagic)
+
+	str := func(s string) uint32 {
+		if ofs, ok := strs[s]; ok {
+			return ofs
+		}
+		ofs := uint32(len(text))
+		text = append(append(text, s...), 0)
+		strs[s] = ofs
+		return ofs
+	}
+
+	// section appends the little-endian encoding of data to the body,
+	// aligned to four bytes, and returns its offset in the file.
+	section := func(data any) uint32 {
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+		ofs := uint32(iqmHeaderSize + body.Len())
+		binary.Write(&body, binary.LittleEndian, data)
+		return ofs
+	}
+
+	meshes := make([]mesh, len(m.Meshes))
+	for index, me := range m.Meshes {
+		meshes[index] = mesh{
+			Name:          str(me.Name),
+			Material:      str(me.Material),
+			FirstVertex:   uint32(me.FirstVertex),
+			NumVertexes:   uint32(me.NumVertices),
+			FirstTriangle: uint32(me.FirstTriangle),
+			NumTriangles:  uint32(me.NumTriangles),
+		}
+	}
+
+	joints := make([]joint, len(m.Joints))
+	for index, j := range m.Joints {
+		q := j.Base.Rotate
+		joints[index] = joint{
+			Name:      str(j.Name),
+			Parent:    int32(j.Parent),
+			Translate: vec3Array(j.Base.Translate),
+			Rotate:    [4]float32{q.X, q.Y, q.Z, q.W},
+			Scale:     vec3Array(j.Base.Scale),
+		}
+	}
+
+	anims := make([]anim, len(m.Anims))
+	for index, a := range m.Anims {
+		anims[index] = anim{
+			Name:       str(a.Name),
+			FirstFrame: uint32(a.FirstFrame),
+			NumFrames:  uint32(a.NumFrames),
+			FrameRate:  a.FrameRate,
+		}
+		if a.Loop {
+			anims[index].Flags = iqmAnimLoop
+		}
+	}
+
+	arrays := m.vertexArrays()
+	for index := range arrays {
+		arrays[index].array.Offset = section(arrays[index].data)
+	}
+
+	h.NumText, h.OfsText = uint32(len(text)), section(text)
+	h.NumMeshes, h.OfsMeshes = uint32(len(meshes)), section(meshes)
+
+	vas := make([]vertexArray, len(arrays))
+	for index, a := range arrays {
+		vas[index] = a.array
+	}
+	h.NumVertexArrays, h.NumVertexes, h.OfsVertexArrays = uint32(len(vas)), uint32(len(m.Vertices)), section(vas)
+	h.NumTriangles, h.OfsTriangles = uint32(len(m.Triangles)), section(m.Triangles)
+	h.NumJoints, h.OfsJoints = uint32(len(joints)), section(joints)
+
+	if len(m.Frames) > 0 {
+		poses, values := m.encodeFrames()
+		h.NumPoses, h.OfsPoses = uint32(len(poses)), section(poses)
+		h.NumFrames, h.NumFrameChannels = uint32(len(m.Frames)), uint32(len(values)/len(m.Frames))
+		h.OfsFrames = section(values)
+	}
+
+	h.NumAnims, h.OfsAnims = uint32(len(anims)), section(anims)
+
+	if len(m.Bounds) > 0 {
+		all := make([]bounds, len(m.Bounds))
+		for index, b := range m.Bounds {
+			all[index] = bounds{vec3Array(b.Min), vec3Array(b.Max), b.XYRadius, b.Radius}
+		}
+		h.OfsBounds = section(all)
+	}
+
+	h.FileSize = uint32(iqmHeaderSize + body.Len())
+
+	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	_, err := body.WriteTo(w)
+	return err
+}
+
+type encodedArray struct {
+	array vertexArray
+	data  any
+}
+
+// vertexArrays returns the vertex arrays to write for the model's vertices.
+func (m *Model) vertexArrays() []encodedArray {
+	positions := make([][3]float32, len(m.Vertices))
+	texcoords := make([][2]float32, len(m.Vertices))
+	for index, v := range m.Vertices {
+		positions[index] = vec3Array(v.Position)
+		texcoords[index] = [2]float32{v.TexCoord.S, v.TexCoord.T}
+	}
+
+	arrays := []encodedArray{
+		{vertexArray{Type: iqmPosition, Format: iqmFloat, Size: 3}, positions},
+		{vertexArray{Type: iqmTexCoord, Format: iqmFloat, Size: 2}, texcoords},
+	}
+
+	if m.HasNormals {
+		normals := make([][3]float32, len(m.Vertices))
+		for index, v := range m.Vertices {
+			normals[index] = vec3Array(v.Normal)
+		}
+		arrays = append(arrays, encodedArray{vertexArray{Type: iqmNormal, Format: iqmFloat, Size: 3}, normals})
+	}
+
+	if len(m.Joints) > 0 {
+		indices := make([][4]uint8, len(m.Vertices))
+		weights := make([][4]uint8, len(m.Vertices))
+		for index, v := range m.Vertices {
+			indices[index] = v.Joints
+			for k, w := range v.Weights {
+				weights[index][k] = uint8(math.Round(float64(min(max(w, 0), 1)) * 255))
+			}
+		}
+		arrays = append(arrays,
+			encodedArray{vertexArray{Type: iqmBlendIndexes, Format: iqmUByte, Size: 4}, indices},
+			encodedArray{vertexArray{Type: iqmBlendWeights, Format: iqmUByte, Size: 4}, weights})
+	}
+
+	return arrays
+}
+
+// encodeFrames returns a pose for each joint and the quantized values of the
+// channels that change across the model's frames.
+func (m *Model) encodeFrames() ([]pose, []uint16) {
+	channels := func(t Transform) [numChannels]float32 {
+		return [...]float32{
+			t.Translate.X, t.Translate.Y, t.Translate.Z,
+			t.Rotate.X, t.Rotate.Y, t.Rotate.Z, t.Rotate.W,
+			t.Scale.X, t.Scale.Y, t.Scale.Z,
+		}
+	}
+
+	poses := make([]pose, len(m.Joints))
+	for index, j := range m.Joints {
+		p := &poses[index]
+		p.Parent = int32(j.Parent)
+
+		lo, hi := channels(m.Frames[0][index]), channels(m.Frames[0][index])
+		for _, frame := range m.Frames[1:] {
+			values := channels(frame[index])
+			for k := range values {
+				lo[k], hi[k] = min(lo[k], values[k]), max(hi[k], values[k])
+			}
+		}
+
+		for k := range numChannels {
+			p.ChannelOffset[k] = lo[k]
+			if hi[k] > lo[k] {
+				p.Mask |= 1 << k
+				p.ChannelScale[k] = (hi[k] - lo[k]) / math.MaxUint16
+			}
+		}
+	}
+
+	var values []uint16
+	for _, frame := range m.Frames {
+		for index, t := range frame {
+			p := &poses[index]
+			for k, value := range channels(t) {
+				if p.Mask&(1<<k) != 0 {
+					q := math.Round(float64((value - p.ChannelOffset[k]) / p.ChannelScale[k]))
+					values = append(values, uint16(min(max(q, 0), math.MaxUint16)))
+				}
+			}
+		}
+	}
+
+	return poses, values
+}
+
+func vec3Array(v md3.Vec3) [3]float32 {
+	return [3]float32{v.X, v.Y, v.Z}
+}
@@ -0,0 +1,73 @@
+package md3
+
+// LerpVertices interpolates the surface's vertices between frameA and frameB
+// by t, where t is 0 for frameA and 1 for frameB, the same way the Quake 3
+// renderer does between keyframes: positions are interpolated linearly and
+// normals are interpolated linearly then renormalized.
+//
+// The interpolated vertices are written to dst, which is grown if it isn't
+// large enough to hold them, and the resulting slice is returned.
+func (s *Surface) LerpVertices(dst []Vertex, frameA, frameB int, t float32) []Vertex {
+	var (
+		numVertices = len(s.texcoords)
+		a           = s.vertices[frameA]
+		b           = s.vertices[frameB]
+	)
+
+	if cap(dst) < numVertices {
+		dst = make([]Vertex, numVertices)
+	}
+	dst = dst[:numVertices]
+
+	for index := range dst {
+		va, vb := a[index], b[index]
+		normal := va.Normal.Lerp(vb.Normal, t)
+		if normal.Dot(normal) == 0 {
+			normal = va.Normal
+		}
+		dst[index] = Vertex{
+			Origin: va.Origin.Lerp(vb.Origin, t),
+			Normal: normal.Normalize(),
+		}
+	}
+
+	return dst
+}
+
+// Pose interpolates the vertices of every surface of the model between
+// frameA and frameB by t, as LerpVertices does. The vertices of each surface
+// are written to the slice of dst at the surface's index, reusing it if it's
+// large enough, and the resulting slices are returned.
+func (m *Model) Pose(dst [][]Vertex, frameA, frameB int, t float32) [][]Vertex {
+	numSurfaces := len(m.surfaces)
+	if cap(dst) < numSurfaces {
+		dst = append(dst[:cap(dst)], make([][]Vertex, numSurfaces-cap(dst))...)
+	}
+	dst = dst[:numSurfaces]
+
+	for index, surf := range m.surfaces {
+		dst[index] = surf.LerpVertices(dst[index], frameA, frameB, t)
+	}
+
+	return dst
+}
+
+// LerpFrame returns a frame whose bounds, origin and radius are interpolated
+// between frameA and frameB by t. The returned frame takes its name from
+// whichever of the two frames t is closer to.
+func (m *Model) LerpFrame(frameA, frameB int, t float32) *Frame {
+	a, b := m.frames[frameA], m.frames[frameB]
+
+	name := a.name
+	if t > 0.5 {
+		name = b.name
+	}
+
+	return &Frame{
+		name:   name,
+		min:    a.min.Lerp(b.min, t),
+		max:    a.max.Lerp(b.max, t),
+		origin: a.origin.Lerp(b.origin, t),
+		radius: a.radius + (b.radius-a.radius)*t,
+	}
+}
@@ -0,0 +1,107 @@
+package md3
+
+import "testing"
+
+func TestLerpVertices(t *testing.T) {
+	m := testModel(t)
+	quad := m.Surface(0)
+
+	for frame := range m.NumFrames() {
+		for index, got := range quad.LerpVertices(nil, frame, 1-frame, 0) {
+			if want := quad.Vertex(frame, index); !vecNear(got.Origin, want.Origin) || !vecNear(got.Normal, want.Normal) {
+				t.Errorf("LerpVertices(%d, %d, 0)[%d] = %v, want %v", frame, 1-frame, index, got, want)
+			}
+		}
+	}
+
+	got := quad.LerpVertices(nil, 0, 1, 0.5)
+	tests := []Vertex{
+		{Vec3{-4, -4, 0.75}, Vec3{1, 0, 1}.Normalize()},
+		{Vec3{4, -4, 0.75}, Vec3{1, 0, 1}.Normalize()},
+		{Vec3{4, 4, 0.75}, Vec3{0, -1, 1}.Normalize()},
+		{Vec3{-4, 4, 0.75}, Vec3{0, 0.3, 0.9}.Normalize()},
+	}
+	for index, want := range tests {
+		if !vecNear(got[index].Origin, want.Origin) || !vecNear(got[index].Normal, want.Normal) {
+			t.Errorf("LerpVertices(0, 1, 0.5)[%d] = %v, want %v", index, got[index], want)
+		}
+	}
+}
+
+func TestLerpVerticesOpposingNormals(t *testing.T) {
+	b := NewModelBuilder("flip")
+	b.AddFrame("up", Vec3{}, Vec3{}, Vec3{}, 0)
+	b.AddFrame("down", Vec3{}, Vec3{}, Vec3{}, 0)
+	surf := b.AddSurface("flip")
+	surf.SetTexCoords(make([]TexCoord, 1))
+	surf.AddVertexFrame([]Vertex{{Normal: Vec3{Z: 1}}})
+	surf.AddVertexFrame([]Vertex{{Normal: Vec3{Z: -1}}})
+	m, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	// Halfway between opposite normals, the first frame's normal is kept
+	// rather than normalizing a zero vector.
+	got := m.Surface(0).LerpVertices(nil, 0, 1, 0.5)
+	if want := (Vec3{Z: 1}); got[0].Normal != want {
+		t.Errorf("LerpVertices(0, 1, 0.5) normal = %v, want %v", got[0].Normal, want)
+	}
+}
+
+func TestLerpVerticesReusesDst(t *testing.T) {
+	quad := testModel(t).Surface(0)
+	dst := make([]Vertex, 1, 8)
+	got := quad.LerpVertices(dst, 0, 1, 0.5)
+	if len(got) != quad.NumVertices() || &got[0] != &dst[0] {
+		t.Errorf("LerpVertices() didn't reuse dst with room for %d vertices", quad.NumVertices())
+	}
+
+	got = quad.LerpVertices(make([]Vertex, 2), 0, 1, 0.5)
+	if len(got) != quad.NumVertices() {
+		t.Errorf("LerpVertices() returned %d vertices, want %d", len(got), quad.NumVertices())
+	}
+}
+
+func TestPose(t *testing.T) {
+	m := testModel(t)
+	dst := m.Pose(nil, 0, 1, 0.25)
+	if len(dst) != m.NumSurfaces() {
+		t.Fatalf("Pose() returned %d surfaces, want %d", len(dst), m.NumSurfaces())
+	}
+	for index, surf := range m.AllSurfaces() {
+		want := surf.LerpVertices(nil, 0, 1, 0.25)
+		for v := range want {
+			if dst[index][v] != want[v] {
+				t.Errorf("Pose() surface %d vertex %d = %v, want %v", index, v, dst[index][v], want[v])
+			}
+		}
+	}
+}
+
+func TestLerpFrame(t *testing.T) {
+	m := testModel(t)
+	a, b := m.Frame(0), m.Frame(1)
+
+	tests := []struct {
+		t    float32
+		name string
+	}{
+		{0, "idle"},
+		{0.5, "idle"},
+		{0.75, "walk"},
+		{1, "walk"},
+	}
+	for _, tt := range tests {
+		got := m.LerpFrame(0, 1, tt.t)
+		if got.Name() != tt.name {
+			t.Errorf("LerpFrame(0, 1, %v) name = %q, want %q", tt.t, got.Name(), tt.name)
+		}
+		if want := a.Origin().Lerp(b.Origin(), tt.t); !vecNear(got.Origin(), want) {
+			t.Errorf("LerpFrame(0, 1, %v) origin = %v, want %v", tt.t, got.Origin(), want)
+		}
+		if want := a.Max().Lerp(b.Max(), tt.t); !vecNear(got.Max(), want) {
+			t.Errorf("LerpFrame(0, 1, %v) max = %v, want %v", tt.t, got.Max(), want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package md3
+
+import "math"
+
+// Mat4 is a 4x4 matrix stored in column-major order, as used by OpenGL.
+type Mat4 [16]float32
+
+// Mat3x4 is a 3x4 affine matrix stored in row-major order, as used by the
+// Quake 3 skeletal formats: each row holds three rotation/scale elements
+// followed by a translation element.
+type Mat3x4 [12]float32
+
+// Mul returns the product m * n.
+func (m Mat4) Mul(n Mat4) Mat4 {
+	var result Mat4
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float32
+			for k := 0; k < 4; k++ {
+				sum += m[k*4+row] * n[col*4+k]
+			}
+			result[col*4+row] = sum
+		}
+	}
+	return result
+}
+
+// Transform returns the point v transformed by m.
+func (m Mat4) Transform(v Vec3) Vec3 {
+	return Vec3{
+		m[0]*v.X + m[4]*v.Y + m[8]*v.Z + m[12],
+		m[1]*v.X + m[5]*v.Y + m[9]*v.Z + m[13],
+		m[2]*v.X + m[6]*v.Y + m[10]*v.Z + m[14],
+	}
+}
+
+// Mat4 returns m extended to a 4x4 matrix.
+func (m Mat3x4) Mat4() Mat4 {
+	return Mat4{
+		m[0], m[4], m[8], 0,
+		m[1], m[5], m[9], 0,
+		m[2], m[6], m[10], 0,
+		m[3], m[7], m[11], 1,
+	}
+}
+
+// Mat3x4 returns the upper three rows of m. The bottom row is assumed to be
+// (0, 0, 0, 1).
+func (m Mat4) Mat3x4() Mat3x4 {
+	return Mat3x4{
+		m[0], m[4], m[8], m[12],
+		m[1], m[5], m[9], m[13],
+		m[2], m[6], m[10], m[14],
+	}
+}
+
+// Quat is a rotation quaternion.
+type Quat struct {
+	X, Y, Z, W float32
+}
+
+// QuatFromAxes returns the quaternion for the rotation whose basis vectors
+// are x, y and z. The axes are assumed to be orthonormal.
+func QuatFromAxes(x, y, z Vec3) Quat {
+	var (
+		r00, r10, r20 = float64(x.X), float64(x.Y), float64(x.Z)
+		r01, r11, r21 = float64(y.X), float64(y.Y), float64(y.Z)
+		r02, r12, r22 = float64(z.X), float64(z.Y), float64(z.Z)
+		trace         = r00 + r11 + r22
+		qx, qy, qz, w float64
+	)
+
+	switch {
+	case trace > 0:
+		s := math.Sqrt(trace+1) * 2
+		w, qx, qy, qz = s/4, (r21-r12)/s, (r02-r20)/s, (r10-r01)/s
+	case r00 > r11 && r00 > r22:
+		s := math.Sqrt(1+r00-r11-r22) * 2
+		w, qx, qy, qz = (r21-r12)/s, s/4, (r01+r10)/s, (r02+r20)/s
+	case r11 > r22:
+		s := math.Sqrt(1+r11-r00-r22) * 2
+		w, qx, qy, qz = (r02-r20)/s, (r01+r10)/s, s/4, (r12+r21)/s
+	default:
+		s := math.Sqrt(1+r22-r00-r11) * 2
+		w, qx, qy, qz = (r10-r01)/s, (r02+r20)/s, (r12+r21)/s, s/4
+	}
+
+	return Quat{float32(qx), float32(qy), float32(qz), float32(w)}.Normalize()
+}
+
+func (q Quat) Dot(r Quat) float32 {
+	return q.X*r.X + q.Y*r.Y + q.Z*r.Z + q.W*r.W
+}
+
+// Normalize returns q scaled to unit length. If q has zero length, the
+// identity rotation is returned.
+func (q Quat) Normalize() Quat {
+	l := float32(math.Sqrt(float64(q.Dot(q))))
+	if l == 0 {
+		return Quat{W: 1}
+	}
+	return Quat{q.X / l, q.Y / l, q.Z / l, q.W / l}
+}
+
+// Mul returns the product q * r, the rotation r followed by q.
+func (q Quat) Mul(r Quat) Quat {
+	return Quat{
+		q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+	}
+}
+
+// Axes returns the basis vectors of the rotation q.
+func (q Quat) Axes() (x, y, z Vec3) {
+	xx, yy, zz := q.X*q.X, q.Y*q.Y, q.Z*q.Z
+	xy, xz, yz := q.X*q.Y, q.X*q.Z, q.Y*q.Z
+	wx, wy, wz := q.W*q.X, q.W*q.Y, q.W*q.Z
+
+	x = Vec3{1 - 2*(yy+zz), 2 * (xy + wz), 2 * (xz - wy)}
+	y = Vec3{2 * (xy - wz), 1 - 2*(xx+zz), 2 * (yz + wx)}
+	z = Vec3{2 * (xz + wy), 2 * (yz - wx), 1 - 2*(xx+yy)}
+	return x, y, z
+}
+
+// Rotate returns v rotated by q.
+func (q Quat) Rotate(v Vec3) Vec3 {
+	x, y, z := q.Axes()
+	return x.Scale(v.X).Add(y.Scale(v.Y)).Add(z.Scale(v.Z))
+}
+
+// Slerp returns the spherical linear interpolation of q and r by t, where t
+// is 0 for q and 1 for r, following the shortest path between them.
+func (q Quat) Slerp(r Quat, t float32) Quat {
+	cos := float64(q.Dot(r))
+	if cos < 0 {
+		r = Quat{-r.X, -r.Y, -r.Z, -r.W}
+		cos = -cos
+	}
+
+	var sq, sr float64
+	if cos > 0.9995 {
+		// Close enough that a linear interpolation is indistinguishable and
+		// avoids dividing by a vanishing sine.
+		sq, sr = 1-float64(t), float64(t)
+	} else {
+		theta := math.Acos(cos)
+		sin := math.Sin(theta)
+		sq = math.Sin((1-float64(t))*theta) / sin
+		sr = math.Sin(float64(t)*theta) / sin
+	}
+
+	return Quat{
+		float32(float64(q.X)*sq + float64(r.X)*sr),
+		float32(float64(q.Y)*sq + float64(r.Y)*sr),
+		float32(float64(q.Z)*sq + float64(r.Z)*sr),
+		float32(float64(q.W)*sq + float64(r.W)*sr),
+	}.Normalize()
+}
@@ -0,0 +1,166 @@
+package md3
+
+import (
+	"math"
+	"testing"
+)
+
+const epsilon = 1e-5
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) <= epsilon
+}
+
+func vecNear(a, b Vec3) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+func mat4Near(a, b Mat4) bool {
+	for index := range a {
+		if !near(a[index], b[index]) {
+			return false
+		}
+	}
+	return true
+}
+
+// quatNear reports whether a and b are the same rotation. Quaternions q and
+// -q represent the same rotation.
+func quatNear(a, b Quat) bool {
+	return near(float32(math.Abs(float64(a.Dot(b)))), 1)
+}
+
+// axisAngle returns the rotation by angle radians about the unit vector axis.
+func axisAngle(axis Vec3, angle float64) Quat {
+	sin, cos := math.Sincos(angle / 2)
+	v := axis.Scale(float32(sin))
+	return Quat{v.X, v.Y, v.Z, float32(cos)}
+}
+
+// testRotations covers each branch of QuatFromAxes: a positive trace, and
+// half turns about each axis, where the largest diagonal element decides.
+var testRotations = []struct {
+	name string
+	q    Quat
+}{
+	{"identity", Quat{W: 1}},
+	{"quarter turn about z", axisAngle(Vec3{Z: 1}, math.Pi/2)},
+	{"oblique", axisAngle(Vec3{1, 2, 3}.Normalize(), 1)},
+	{"half turn about x", axisAngle(Vec3{X: 1}, math.Pi)},
+	{"half turn about y", axisAngle(Vec3{Y: 1}, math.Pi)},
+	{"half turn about z", axisAngle(Vec3{Z: 1}, math.Pi)},
+	{"near half turn", axisAngle(Vec3{1, -1, 0.5}.Normalize(), 3)},
+}
+
+func TestQuatFromAxesRoundTrip(t *testing.T) {
+	for _, tt := range testRotations {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y, z := tt.q.Axes()
+			got := QuatFromAxes(x, y, z)
+			if !quatNear(got, tt.q) {
+				t.Errorf("QuatFromAxes(%v, %v, %v) = %v, want %v", x, y, z, got, tt.q)
+			}
+
+			gx, gy, gz := got.Axes()
+			if !vecNear(gx, x) || !vecNear(gy, y) || !vecNear(gz, z) {
+				t.Errorf("Axes() = %v, %v, %v, want %v, %v, %v", gx, gy, gz, x, y, z)
+			}
+		})
+	}
+}
+
+func TestQuatRotate(t *testing.T) {
+	q := axisAngle(Vec3{Z: 1}, math.Pi/2)
+	if got, want := q.Rotate(Vec3{X: 1}), (Vec3{Y: 1}); !vecNear(got, want) {
+		t.Errorf("Rotate(X) = %v, want %v", got, want)
+	}
+	if got, want := q.Rotate(Vec3{1, 2, 3}), (Vec3{-2, 1, 3}); !vecNear(got, want) {
+		t.Errorf("Rotate(1, 2, 3) = %v, want %v", got, want)
+	}
+}
+
+func TestQuatMul(t *testing.T) {
+	v := Vec3{1, -2, 0.5}
+	for _, a := range testRotations {
+		for _, b := range testRotations {
+			got := a.q.Mul(b.q).Rotate(v)
+			want := a.q.Rotate(b.q.Rotate(v))
+			if !vecNear(got, want) {
+				t.Errorf("(%s * %s).Rotate(v) = %v, want %v", a.name, b.name, got, want)
+			}
+		}
+	}
+}
+
+func TestQuatNormalize(t *testing.T) {
+	if got, want := (Quat{}).Normalize(), (Quat{W: 1}); got != want {
+		t.Errorf("zero Normalize() = %v, want %v", got, want)
+	}
+	if got := (Quat{1, 2, 3, 4}).Normalize(); !near(got.Dot(got), 1) {
+		t.Errorf("Normalize() = %v, want unit length", got)
+	}
+}
+
+func TestQuatSlerp(t *testing.T) {
+	a := Quat{W: 1}
+	b := axisAngle(Vec3{Z: 1}, math.Pi/2)
+
+	tests := []struct {
+		name string
+		q, r Quat
+		t    float32
+		want Quat
+	}{
+		{"start", a, b, 0, a},
+		{"end", a, b, 1, b},
+		{"middle", a, b, 0.5, axisAngle(Vec3{Z: 1}, math.Pi/4)},
+		{"quarter", a, b, 0.25, axisAngle(Vec3{Z: 1}, math.Pi/8)},
+		// -b is the same rotation as b, so the shortest path is the same.
+		{"shortest path", a, Quat{-b.X, -b.Y, -b.Z, -b.W}, 0.5, axisAngle(Vec3{Z: 1}, math.Pi/4)},
+		{"nearly equal", b, axisAngle(Vec3{Z: 1}, math.Pi/2+1e-4), 0.5, axisAngle(Vec3{Z: 1}, math.Pi/2+5e-5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.q.Slerp(tt.r, tt.t)
+			if !quatNear(got, tt.want) {
+				t.Errorf("Slerp(%v, %v, %v) = %v, want %v", tt.q, tt.r, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMat4Mul(t *testing.T) {
+	identity := IdentityTagFrame().Matrix()
+	m := TagFrameFromQuat(axisAngle(Vec3{1, 1, 0}.Normalize(), 0.7), Vec3{1, 2, 3}).Matrix()
+
+	if got := identity.Mul(m); !mat4Near(got, m) {
+		t.Errorf("identity * m = %v, want %v", got, m)
+	}
+	if got := m.Mul(identity); !mat4Near(got, m) {
+		t.Errorf("m * identity = %v, want %v", got, m)
+	}
+
+	// Translating by (1, 0, 0) then scaling by 2 puts the origin at (2, 0, 0).
+	scale := Mat4{2, 0, 0, 0, 0, 2, 0, 0, 0, 0, 2, 0, 0, 0, 0, 1}
+	translate := Mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 1, 0, 0, 1}
+	if got, want := scale.Mul(translate).Transform(Vec3{}), (Vec3{X: 2}); !vecNear(got, want) {
+		t.Errorf("(scale * translate).Transform(0) = %v, want %v", got, want)
+	}
+	if got, want := translate.Mul(scale).Transform(Vec3{}), (Vec3{X: 1}); !vecNear(got, want) {
+		t.Errorf("(translate * scale).Transform(0) = %v, want %v", got, want)
+	}
+}
+
+func TestMat3x4RoundTrip(t *testing.T) {
+	m := Mat3x4{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+	if got := m.Mat4().Mat3x4(); got != m {
+		t.Errorf("Mat4().Mat3x4() = %v, want %v", got, m)
+	}
+
+	// Each row of a Mat3x4 holds the rotation of one output axis followed by
+	// its translation.
+	if got, want := m.Mat4().Transform(Vec3{1, 0, 0}), (Vec3{1 + 4, 5 + 8, 9 + 12}); got != want {
+		t.Errorf("Mat4().Transform(X) = %v, want %v", got, want)
+	}
+}
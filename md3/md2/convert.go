@@ -0,0 +1,70 @@
+package md2
+
+import "github.com/nilium/go-md3/md3"
+
+// ToMD3 converts the model to an MD3 model with the given name, holding a
+// single surface of the same name. The model's skins become the surface's
+// shaders and its frames keep their names, truncated to fit MD3's limit.
+//
+// MD2 triangles index positions and texcoords separately, while MD3 vertices
+// carry both, so each distinct pair of position and texcoord used by a
+// triangle becomes an MD3 vertex, in the order triangles first use them.
+// Positions that are never used by a triangle are dropped.
+func (m *Model) ToMD3(name string) (*md3.Model, error) {
+	b := md3.NewModelBuilder(name)
+	sb := b.AddSurface(name)
+
+	for _, skin := range m.Skins {
+		sb.AddShader(skin)
+	}
+
+	type pair struct{ vertex, texcoord uint16 }
+	indices := make(map[pair]int32)
+	var pairs []pair
+
+	for _, tri := range m.Triangles {
+		var corners [3]int32
+		for k := range corners {
+			p := pair{tri.Vertices[k], tri.TexCoords[k]}
+			index, ok := indices[p]
+			if !ok {
+				index = int32(len(pairs))
+				indices[p] = index
+				pairs = append(pairs, p)
+			}
+			corners[k] = index
+		}
+		sb.AddTriangle(corners[0], corners[1], corners[2])
+	}
+
+	texcoords := make([]md3.TexCoord, len(pairs))
+	for index, p := range pairs {
+		tc := m.TexCoords[p.texcoord]
+		texcoords[index] = md3.TexCoord{
+			S: float32(tc.S) / float32(m.SkinWidth),
+			T: float32(tc.T) / float32(m.SkinHeight),
+		}
+	}
+	sb.SetTexCoords(texcoords)
+
+	for index := range m.Frames {
+		frame := &m.Frames[index]
+		frameName := frame.Name
+		if len(frameName) >= maxFrameName {
+			frameName = frameName[:maxFrameName-1]
+		}
+		b.AddFrame(frameName, md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+
+		vertices := make([]md3.Vertex, len(pairs))
+		for index, p := range pairs {
+			vertices[index] = md3.Vertex{
+				Origin: frame.Position(int(p.vertex)),
+				Normal: frame.Normal(int(p.vertex)),
+			}
+		}
+		sb.AddVertexFrame(vertices)
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
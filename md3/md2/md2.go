@@ -0,0 +1,290 @@
+// Package md2 reads Quake 2 MD2 models and converts them to MD3 models.
+package md2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/binread"
+)
+
+const (
+	md2Ident   = "IDP2"
+	md2Version = 8
+
+	md2HeaderSize   = 68
+	md2SkinSize     = 64
+	md2TexCoordSize = 4
+	md2TriangleSize = 12
+	md2FrameHeader  = 40
+	md2VertexSize   = 4
+
+	maxSkins     = 32
+	maxVertices  = 2048
+	maxTriangles = 4096
+	maxFrames    = 512
+	maxFrameName = 16
+
+	// NumNormals is the number of normals in the Normals table.
+	NumNormals = 162
+)
+
+// TexCoord is a texture coordinate in pixels of the model's skin.
+type TexCoord struct {
+	S, T int16
+}
+
+// Triangle holds the indices of a triangle's vertices in each frame and of
+// their texcoords. MD2 files index vertices and texcoords separately, so a
+// vertex may have a different texcoord in each triangle that uses it.
+type Triangle struct {
+	Vertices  [3]uint16
+	TexCoords [3]uint16
+}
+
+// Vertex is a compressed vertex of a frame: its position, scaled and
+// translated by the frame, and the index of its normal in Normals.
+type Vertex struct {
+	Position [3]uint8
+	Normal   uint8
+}
+
+// Frame is a single frame of animation.
+type Frame struct {
+	Name      string
+	Scale     md3.Vec3
+	Translate md3.Vec3
+	Vertices  []Vertex
+}
+
+// GLVertex is a vertex of a GL command: a texcoord, as a fraction of the
+// skin's size, and the index of the vertex in each frame.
+type GLVertex struct {
+	S, T  float32
+	Index int32
+}
+
+// GLCommand is a triangle strip or fan, used by Quake 2 to draw the model
+// without indexing texcoords separately.
+type GLCommand struct {
+	Fan      bool
+	Vertices []GLVertex
+}
+
+// Model is the contents of an MD2 file.
+type Model struct {
+	SkinWidth, SkinHeight int
+	Skins                 []string
+	TexCoords             []TexCoord
+	Triangles             []Triangle
+	Frames                []Frame
+	GLCommands            []GLCommand
+}
+
+type header struct {
+	Ident      [4]byte
+	Version    int32
+	SkinWidth  int32
+	SkinHeight int32
+	FrameSize  int32
+	NumSkins   int32
+	NumXYZ     int32
+	NumST      int32
+	NumTris    int32
+	NumGLCmds  int32
+	NumFrames  int32
+	OfsSkins   int32
+	OfsST      int32
+	OfsTris    int32
+	OfsFrames  int32
+	OfsGLCmds  int32
+	OfsEnd     int32
+}
+
+// Decode reads an MD2 model from r.
+func Decode(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read reads an MD2 model from data. Counts and offsets in the header are
+// checked against Quake 2's limits and the size of data, and every index is
+// checked against the list it refers to, so a model returned without error
+// is safe to use.
+func Read(data []byte) (*Model, error) {
+	var h header
+	if len(data) < md2HeaderSize {
+		return nil, errors.New("md2: file is too short for a header")
+	}
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &h)
+
+	if err := checkHeader(&h, len(data)); err != nil {
+		return nil, err
+	}
+
+	m := &Model{
+		SkinWidth:  int(h.SkinWidth),
+		SkinHeight: int(h.SkinHeight),
+		Skins:      make([]string, h.NumSkins),
+		TexCoords:  make([]TexCoord, h.NumST),
+		Triangles:  make([]Triangle, h.NumTris),
+		Frames:     make([]Frame, h.NumFrames),
+	}
+
+	for index := range m.Skins {
+		ofs := int(h.OfsSkins) + index*md2SkinSize
+		m.Skins[index] = binread.NulString(data[ofs : ofs+md2SkinSize])
+	}
+
+	binary.Read(bytes.NewReader(data[h.OfsST:]), binary.LittleEndian, m.TexCoords)
+	binary.Read(bytes.NewReader(data[h.OfsTris:]), binary.LittleEndian, m.Triangles)
+
+	for index, tri := range m.Triangles {
+		for k := range 3 {
+			if int32(tri.Vertices[k]) >= h.NumXYZ || int32(tri.TexCoords[k]) >= h.NumST {
+				return nil, fmt.Errorf("md2: triangle %d refers to vertex %d and texcoord %d of %d and %d",
+					index, tri.Vertices[k], tri.TexCoords[k], h.NumXYZ, h.NumST)
+			}
+		}
+	}
+
+	for index := range m.Frames {
+		frame := data[int(h.OfsFrames)+index*int(h.FrameSize):]
+		r := bytes.NewReader(frame)
+		var scale, translate [3]float32
+		binary.Read(r, binary.LittleEndian, &scale)
+		binary.Read(r, binary.LittleEndian, &translate)
+
+		vertices := make([]Vertex, h.NumXYZ)
+		binary.Read(bytes.NewReader(frame[md2FrameHeader:]), binary.LittleEndian, vertices)
+
+		m.Frames[index] = Frame{
+			Name:      binread.NulString(frame[24 : 24+maxFrameName]),
+			Scale:     md3.Vec3{X: scale[0], Y: scale[1], Z: scale[2]},
+			Translate: md3.Vec3{X: translate[0], Y: translate[1], Z: translate[2]},
+			Vertices:  vertices,
+		}
+	}
+
+	cmds, err := readGLCommands(data[h.OfsGLCmds:h.OfsGLCmds+4*h.NumGLCmds], h.NumXYZ)
+	if err != nil {
+		return nil, err
+	}
+	m.GLCommands = cmds
+
+	return m, nil
+}
+
+func checkHeader(h *header, size int) error {
+	switch {
+	case string(h.Ident[:]) != md2Ident:
+		return fmt.Errorf("md2: invalid ident %q", h.Ident[:])
+	case h.Version != md2Version:
+		return fmt.Errorf("md2: unsupported version %d", h.Version)
+	case h.SkinWidth <= 0 || h.SkinHeight <= 0:
+		return fmt.Errorf("md2: invalid skin size %dx%d", h.SkinWidth, h.SkinHeight)
+	}
+
+	counts := []struct {
+		kind       string
+		count, max int32
+	}{
+		{"skin", h.NumSkins, maxSkins},
+		{"vertex", h.NumXYZ, maxVertices},
+		{"texcoord", h.NumST, maxVertices},
+		{"triangle", h.NumTris, maxTriangles},
+		{"frame", h.NumFrames, maxFrames},
+		{"GL command", h.NumGLCmds, maxTriangles * 16},
+	}
+	for _, c := range counts {
+		if c.count < 0 || c.count > c.max {
+			return fmt.Errorf("md2: %s count %d is outside of [0, %d]", c.kind, c.count, c.max)
+		}
+	}
+
+	if h.FrameSize < md2FrameHeader+md2VertexSize*h.NumXYZ {
+		return fmt.Errorf("md2: frame size %d is too small for %d vertices", h.FrameSize, h.NumXYZ)
+	}
+
+	sections := []struct {
+		kind        string
+		ofs, length int64
+	}{
+		{"skins", int64(h.OfsSkins), int64(h.NumSkins) * md2SkinSize},
+		{"texcoords", int64(h.OfsST), int64(h.NumST) * md2TexCoordSize},
+		{"triangles", int64(h.OfsTris), int64(h.NumTris) * md2TriangleSize},
+		{"frames", int64(h.OfsFrames), int64(h.NumFrames) * int64(h.FrameSize)},
+		{"GL commands", int64(h.OfsGLCmds), int64(h.NumGLCmds) * 4},
+	}
+	for _, s := range sections {
+		if s.ofs < md2HeaderSize || s.ofs+s.length > int64(size) {
+			return fmt.Errorf("md2: %s at [%d, %d) are outside of the file's %d bytes",
+				s.kind, s.ofs, s.ofs+s.length, size)
+		}
+	}
+
+	return nil
+}
+
+// readGLCommands reads a list of GL commands, which ends with a zero count or
+// at the end of data.
+func readGLCommands(data []byte, numVertices int32) ([]GLCommand, error) {
+	var cmds []GLCommand
+	for len(data) >= 4 {
+		count := int64(int32(binary.LittleEndian.Uint32(data)))
+		data = data[4:]
+		if count == 0 {
+			break
+		}
+
+		cmd := GLCommand{Fan: count < 0}
+		if cmd.Fan {
+			count = -count
+		}
+
+		if count*12 > int64(len(data)) {
+			return nil, fmt.Errorf("md2: GL command %d has %d vertices, past the end of the list", len(cmds), count)
+		}
+
+		cmd.Vertices = make([]GLVertex, count)
+		binary.Read(bytes.NewReader(data), binary.LittleEndian, cmd.Vertices)
+		data = data[12*count:]
+
+		for _, v := range cmd.Vertices {
+			if v.Index < 0 || v.Index >= numVertices {
+				return nil, fmt.Errorf("md2: GL command %d refers to vertex %d of %d", len(cmds), v.Index, numVertices)
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+// Position returns the uncompressed position of the vertex at the given
+// index.
+func (f *Frame) Position(index int) md3.Vec3 {
+	p := f.Vertices[index].Position
+	return md3.Vec3{
+		X: float32(p[0])*f.Scale.X + f.Translate.X,
+		Y: float32(p[1])*f.Scale.Y + f.Translate.Y,
+		Z: float32(p[2])*f.Scale.Z + f.Translate.Z,
+	}
+}
+
+// Normal returns the normal of the vertex at the given index. Normal indices
+// outside of the table, which some exporters write, give an upward normal.
+func (f *Frame) Normal(index int) md3.Vec3 {
+	n := f.Vertices[index].Normal
+	if int(n) >= NumNormals {
+		return md3.Vec3{Z: 1}
+	}
+	return Normals[n]
+}
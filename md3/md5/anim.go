@@ -0,0 +1,269 @@
+package md5
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/token"
+)
+
+// Flags of an animated joint, selecting which of its components are given
+// by each frame rather than its base frame.
+const (
+	AnimPositionX = 1 << iota
+	AnimPositionY
+	AnimPositionZ
+	AnimOrientX
+	AnimOrientY
+	AnimOrientZ
+)
+
+// AnimJoint is a joint of an animation's hierarchy. Flags selects the
+// components of the joint that are animated, which are read in order from
+// each frame's components starting at StartIndex.
+type AnimJoint struct {
+	Name       string
+	Parent     int
+	Flags      int
+	StartIndex int
+}
+
+// Bounds is the box enclosing a frame of an animation.
+type Bounds struct {
+	Min, Max md3.Vec3
+}
+
+// BaseJoint is a joint's position and orientation relative to its parent,
+// or to the model if it has none, before a frame's components are applied.
+type BaseJoint struct {
+	Position md3.Vec3
+	Orient   md3.Quat
+}
+
+// Anim is the contents of an .md5anim file.
+type Anim struct {
+	FrameRate int
+	Joints    []AnimJoint
+	Bounds    []Bounds
+	BaseFrame []BaseJoint
+	// Frames holds the animated components of each frame.
+	Frames [][]float32
+}
+
+// ParseAnim reads an .md5anim file from r. Every joint's parent and
+// animated components are checked against the animation's joints and
+// frames, so an animation returned without error is safe to pose.
+func ParseAnim(r io.Reader) (*Anim, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{s: token.NewScanner(data)}
+	if err := p.header(); err != nil {
+		return nil, err
+	}
+
+	var counts [4]int
+	for index, key := range [...]string{"numFrames", "numJoints", "frameRate", "numAnimatedComponents"} {
+		if counts[index], err = p.keyCount(key); err != nil {
+			return nil, err
+		}
+	}
+	numFrames, numJoints, numComponents := counts[0], counts[1], counts[3]
+
+	// Each joint animates at most six components, which bounds the
+	// components allocated for each frame before any are read.
+	if numComponents > 6*numJoints {
+		return nil, p.errorf("%d animated components is more than %d joints can have", numComponents, numJoints)
+	}
+
+	a := &Anim{FrameRate: counts[2]}
+	if err := p.hierarchy(a, numJoints, numComponents); err != nil {
+		return nil, err
+	}
+
+	if err := p.section("bounds", func() error {
+		for range numFrames {
+			var (
+				b   Bounds
+				err error
+			)
+			if b.Min, err = p.vec3(); err != nil {
+				return err
+			}
+			if b.Max, err = p.vec3(); err != nil {
+				return err
+			}
+			a.Bounds = append(a.Bounds, b)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := p.section("baseframe", func() error {
+		for range numJoints {
+			var (
+				b   BaseJoint
+				err error
+			)
+			if b.Position, err = p.vec3(); err != nil {
+				return err
+			}
+			if b.Orient, err = p.quat(); err != nil {
+				return err
+			}
+			a.BaseFrame = append(a.BaseFrame, b)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for frame := range numFrames {
+		if err := p.expect("frame"); err != nil {
+			return nil, err
+		}
+		if index, err := p.int(); err != nil {
+			return nil, err
+		} else if index != frame {
+			return nil, p.errorf("frame %d is out of order, expected %d", index, frame)
+		}
+
+		components := make([]float32, numComponents)
+		if err := p.section("", func() error {
+			for index := range components {
+				f, err := p.float()
+				if err != nil {
+					return err
+				}
+				components[index] = f
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		a.Frames = append(a.Frames, components)
+	}
+
+	return a, nil
+}
+
+// section reads a block in braces, introduced by key if it isn't empty,
+// whose contents are read by body.
+func (p *parser) section(key string, body func() error) error {
+	if key != "" {
+		if err := p.expect(key); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	if err := body(); err != nil {
+		return err
+	}
+	return p.expect("}")
+}
+
+func (p *parser) hierarchy(a *Anim, numJoints, numComponents int) error {
+	return p.section("hierarchy", func() error {
+		for index := range numJoints {
+			var (
+				j   AnimJoint
+				err error
+			)
+			if j.Name, err = p.next(); err != nil {
+				return err
+			}
+			if j.Parent, err = p.int(); err != nil {
+				return err
+			}
+			if j.Parent < -1 || j.Parent >= index {
+				return p.errorf("joint %q has invalid parent %d", j.Name, j.Parent)
+			}
+			if j.Flags, err = p.count(); err != nil {
+				return err
+			}
+			if j.StartIndex, err = p.count(); err != nil {
+				return err
+			}
+
+			var numAnimated int
+			for bit := range 6 {
+				if j.Flags&(1<<bit) != 0 {
+					numAnimated++
+				}
+			}
+			if j.StartIndex > numComponents || numAnimated > numComponents-j.StartIndex {
+				return p.errorf("joint %q animates components [%d, %d) of %d",
+					j.Name, j.StartIndex, j.StartIndex+numAnimated, numComponents)
+			}
+
+			a.Joints = append(a.Joints, j)
+		}
+		return nil
+	})
+}
+
+// Skeleton returns the pose of the animation's joints in the given frame,
+// in model space.
+func (a *Anim) Skeleton(frame int) Skeleton {
+	components := a.Frames[frame]
+	skel := make(Skeleton, len(a.Joints))
+
+	for index, j := range a.Joints {
+		base := a.BaseFrame[index]
+		pos := [3]float32{base.Position.X, base.Position.Y, base.Position.Z}
+		orient := [3]float32{base.Orient.X, base.Orient.Y, base.Orient.Z}
+
+		next := j.StartIndex
+		for bit := range 6 {
+			if j.Flags&(1<<bit) == 0 {
+				continue
+			}
+			if bit < 3 {
+				pos[bit] = components[next]
+			} else {
+				orient[bit-3] = components[next]
+			}
+			next++
+		}
+
+		joint := Joint{
+			Name:     j.Name,
+			Parent:   j.Parent,
+			Position: md3.Vec3{X: pos[0], Y: pos[1], Z: pos[2]},
+			Orient:   unitQuat(orient[0], orient[1], orient[2]),
+		}
+
+		if j.Parent >= 0 {
+			parent := skel[j.Parent]
+			joint.Position = parent.Position.Add(parent.Orient.Rotate(joint.Position))
+			joint.Orient = parent.Orient.Mul(joint.Orient).Normalize()
+		}
+
+		skel[index] = joint
+	}
+
+	return skel
+}
+
+// Check returns an error if the animation's joints don't match the model's
+// by count, name and parent, as Doom 3 requires.
+func (a *Anim) Check(m *Model) error {
+	if len(a.Joints) != len(m.Joints) {
+		return fmt.Errorf("md5: animation has %d joints, model has %d", len(a.Joints), len(m.Joints))
+	}
+
+	for index, j := range a.Joints {
+		if mj := m.Joints[index]; j.Name != mj.Name || j.Parent != mj.Parent {
+			return fmt.Errorf("md5: animation joint %d (%q, parent %d) doesn't match the model's (%q, parent %d)",
+				index, j.Name, j.Parent, mj.Name, mj.Parent)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package md5
+
+import (
+	"strings"
+	"testing"
+)
+
+const testAnim = `MD5Version 10
+commandline ""
+
+numFrames 2
+numJoints 2
+frameRate 24
+numAnimatedComponents 4
+
+hierarchy {
+	"origin" -1 0 0
+	"arm" 0 7 0
+}
+
+bounds {
+	( -1 -1 -1 ) ( 1 1 1 )
+	( -2 -2 -2 ) ( 2 2 2 )
+}
+
+baseframe {
+	( 0 0 0 ) ( 0 0 0 )
+	( 1 0 0 ) ( 0 0 0 )
+}
+
+frame 0 {
+	1 0 0 0.5
+}
+
+frame 1 {
+	2 0 1 0.5
+}
+`
+
+func TestParseAnim(t *testing.T) {
+	a, err := ParseAnim(strings.NewReader(testAnim))
+	if err != nil {
+		t.Fatalf("ParseAnim() error = %v", err)
+	}
+	if a.FrameRate != 24 || len(a.Joints) != 2 || len(a.Bounds) != 2 || len(a.BaseFrame) != 2 {
+		t.Fatalf("ParseAnim() = %d fps, %d joints, %d bounds, %d base joints; want 24, 2, 2, 2",
+			a.FrameRate, len(a.Joints), len(a.Bounds), len(a.BaseFrame))
+	}
+	if got, want := a.Frames[1], []float32{2, 0, 1, 0.5}; len(got) != len(want) || got[0] != want[0] || got[3] != want[3] {
+		t.Errorf("frame 1 components = %v, want %v", got, want)
+	}
+}
+
+func TestParseAnimRejectsCounts(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+	}{
+		// Allocating this many components for the first frame would panic
+		// or exhaust memory before the first of them is read.
+		{"huge components", "numAnimatedComponents 4", "numAnimatedComponents 100000000000000"},
+		{"components past joints", "numAnimatedComponents 4", "numAnimatedComponents 13"},
+		{"joint past components", `"arm" 0 7 0`, `"arm" 0 7 2`},
+		{"missing frame", "numFrames 2", "numFrames 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := strings.Replace(testAnim, tt.old, tt.new, 1)
+			if a, err := ParseAnim(strings.NewReader(src)); err == nil {
+				t.Errorf("ParseAnim() = %v, want error", a)
+			}
+		})
+	}
+}
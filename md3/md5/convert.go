@@ -0,0 +1,129 @@
+package md5
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// TagPrefix is the prefix of the names of joints that become MD3 tags
+// without being named by ToMD3's tags.
+const TagPrefix = "tag_"
+
+// Skin returns the mesh's vertices posed by the given skeleton. Each
+// vertex's position is the sum of its weights' positions transformed by
+// their joints and scaled by their biases. MD5 meshes have no normals, so
+// each vertex is given the average of the normals of the triangles sharing
+// its position, weighted by their area, which smooths across the seams
+// between vertices with different texcoords.
+//
+// The vertices are written to dst, which is grown if it isn't large enough
+// to hold them, and the resulting slice is returned.
+func (m *Mesh) Skin(dst []md3.Vertex, skel Skeleton) []md3.Vertex {
+	if cap(dst) < len(m.Vertices) {
+		dst = make([]md3.Vertex, len(m.Vertices))
+	}
+	dst = dst[:len(m.Vertices)]
+
+	for index, v := range m.Vertices {
+		var origin md3.Vec3
+		for _, w := range m.Weights[v.FirstWeight : v.FirstWeight+v.NumWeights] {
+			j := skel[w.Joint]
+			origin = origin.Add(j.Position.Add(j.Orient.Rotate(w.Position)).Scale(w.Bias))
+		}
+		dst[index] = md3.Vertex{Origin: origin}
+	}
+
+	normals := make(map[md3.Vec3]md3.Vec3)
+	for _, tri := range m.Triangles {
+		a, b, c := dst[tri.A].Origin, dst[tri.B].Origin, dst[tri.C].Origin
+		// Triangles are wound clockwise, as in MD3.
+		n := c.Sub(a).Cross(b.Sub(a))
+		for _, p := range [...]md3.Vec3{a, b, c} {
+			normals[p] = normals[p].Add(n)
+		}
+	}
+
+	for index := range dst {
+		n := normals[dst[index].Origin]
+		if n.Len() == 0 {
+			n = md3.Vec3{Z: 1}
+		}
+		dst[index].Normal = n.Normalize()
+	}
+
+	return dst
+}
+
+// ToMD3 bakes the model into an MD3 model with the given name, skinning its
+// meshes for each frame of anim, or in the bind pose if anim is nil or has no
+// frames. Each mesh becomes a surface whose only shader is the mesh's shader.
+//
+// Joints become tags if tags maps their names to tag names, or if their
+// names start with TagPrefix, keeping their names. Each frame's bounds are
+// computed from its vertices.
+func (m *Model) ToMD3(name string, anim *Anim, tags map[string]string) (*md3.Model, error) {
+	if anim != nil {
+		if err := anim.Check(m); err != nil {
+			return nil, err
+		}
+	}
+
+	b := md3.NewModelBuilder(name)
+	for index, mesh := range m.Meshes {
+		sb := b.AddSurface(fmt.Sprintf("mesh%d", index))
+		if mesh.Shader != "" {
+			sb.AddShader(mesh.Shader)
+		}
+		sb.SetTriangles(mesh.Triangles)
+
+		texcoords := make([]md3.TexCoord, len(mesh.Vertices))
+		for index, v := range mesh.Vertices {
+			texcoords[index] = v.TexCoord
+		}
+		sb.SetTexCoords(texcoords)
+	}
+
+	type tag struct {
+		name   string
+		joint  int
+		frames []md3.TagFrame
+	}
+	var tagJoints []*tag
+	for index, j := range m.Joints {
+		tagName, ok := tags[j.Name]
+		if !ok && strings.HasPrefix(strings.ToLower(j.Name), TagPrefix) {
+			tagName, ok = j.Name, true
+		}
+		if ok {
+			tagJoints = append(tagJoints, &tag{name: tagName, joint: index})
+		}
+	}
+
+	skeletons := []Skeleton{m.Joints}
+	if anim != nil && len(anim.Frames) > 0 {
+		skeletons = skeletons[:0]
+		for frame := range anim.Frames {
+			skeletons = append(skeletons, anim.Skeleton(frame))
+		}
+	}
+
+	for _, skel := range skeletons {
+		b.AddFrame("", md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+		for index := range m.Meshes {
+			b.Surface(index).AddVertexFrame(m.Meshes[index].Skin(nil, skel))
+		}
+		for _, t := range tagJoints {
+			j := skel[t.joint]
+			t.frames = append(t.frames, md3.TagFrameFromQuat(j.Orient, j.Position))
+		}
+	}
+
+	for _, t := range tagJoints {
+		b.AddTag(t.name, t.frames...)
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
@@ -0,0 +1,250 @@
+// Package md5 reads Doom 3's MD5 skeletal models and animations and bakes
+// them into MD3 models.
+//
+// Models are read from .md5mesh files, holding a skeleton in its bind pose
+// and meshes whose vertices are built from weighted positions relative to
+// its joints, and animations from .md5anim files, holding the skeleton's
+// pose in each frame. Both formats use Quake's axes, texture space and
+// triangle winding, so no conversion is needed to MD3's.
+package md5
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/token"
+)
+
+// Joint is a joint of a skeleton: its position and orientation in model
+// space, and the index of its parent, or -1 if it has none.
+type Joint struct {
+	Name     string
+	Parent   int
+	Position md3.Vec3
+	Orient   md3.Quat
+}
+
+// Skeleton is a pose of a model's joints, in the model's order.
+type Skeleton []Joint
+
+// Vertex is a vertex of a mesh: its texcoord and the range of the mesh's
+// weights giving its position.
+type Vertex struct {
+	TexCoord    md3.TexCoord
+	FirstWeight int
+	NumWeights  int
+}
+
+// Weight is a position relative to a joint and the share of a vertex's
+// position it contributes.
+type Weight struct {
+	Joint    int
+	Bias     float32
+	Position md3.Vec3
+}
+
+// Mesh is a triangle mesh with a single shader.
+type Mesh struct {
+	Shader    string
+	Vertices  []Vertex
+	Triangles []md3.Triangle
+	Weights   []Weight
+}
+
+// Model is the contents of an .md5mesh file: a skeleton in its bind pose and
+// the meshes weighted to it.
+type Model struct {
+	Joints Skeleton
+	Meshes []Mesh
+}
+
+// ParseMesh reads an .md5mesh file from r. Every index is checked against
+// the list it refers to, so a model returned without error is safe to pose.
+func ParseMesh(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{s: token.NewScanner(data)}
+	if err := p.header(); err != nil {
+		return nil, err
+	}
+
+	numJoints, err := p.keyCount("numJoints")
+	if err != nil {
+		return nil, err
+	}
+	numMeshes, err := p.keyCount("numMeshes")
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Model{}
+	if m.Joints, err = p.joints(numJoints); err != nil {
+		return nil, err
+	}
+
+	for range numMeshes {
+		mesh, err := p.mesh(numJoints)
+		if err != nil {
+			return nil, err
+		}
+		m.Meshes = append(m.Meshes, mesh)
+	}
+
+	return m, nil
+}
+
+func (p *parser) joints(numJoints int) (Skeleton, error) {
+	if err := p.expect("joints"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var joints Skeleton
+	for index := range numJoints {
+		var (
+			j   Joint
+			err error
+		)
+		if j.Name, err = p.next(); err != nil {
+			return nil, err
+		}
+		if j.Parent, err = p.int(); err != nil {
+			return nil, err
+		}
+		if j.Parent < -1 || j.Parent >= index {
+			return nil, p.errorf("joint %q has invalid parent %d", j.Name, j.Parent)
+		}
+		if j.Position, err = p.vec3(); err != nil {
+			return nil, err
+		}
+		if j.Orient, err = p.quat(); err != nil {
+			return nil, err
+		}
+		joints = append(joints, j)
+	}
+
+	return joints, p.expect("}")
+}
+
+func (p *parser) mesh(numJoints int) (Mesh, error) {
+	var mesh Mesh
+	if err := p.expect("mesh"); err != nil {
+		return mesh, err
+	}
+	if err := p.expect("{"); err != nil {
+		return mesh, err
+	}
+
+	for {
+		key, err := p.next()
+		if err != nil {
+			return mesh, err
+		}
+
+		switch key {
+		case "}":
+			return mesh, mesh.check()
+		case "shader":
+			mesh.Shader, err = p.next()
+		case "numverts":
+			err = list(p, &mesh.Vertices, "vert", func(v *Vertex) (err error) {
+				var tc [2]float32
+				if err = p.floats(tc[:]); err != nil {
+					return err
+				}
+				v.TexCoord = md3.TexCoord{S: tc[0], T: tc[1]}
+				if v.FirstWeight, err = p.count(); err != nil {
+					return err
+				}
+				v.NumWeights, err = p.count()
+				return err
+			})
+		case "numtris":
+			err = list(p, &mesh.Triangles, "tri", func(tri *md3.Triangle) error {
+				for _, v := range [...]*int32{&tri.A, &tri.B, &tri.C} {
+					n, err := p.count()
+					if err != nil {
+						return err
+					} else if n > math.MaxInt32 {
+						return p.errorf("vertex index %d is out of range", n)
+					}
+					*v = int32(n)
+				}
+				return nil
+			})
+		case "numweights":
+			err = list(p, &mesh.Weights, "weight", func(w *Weight) (err error) {
+				if w.Joint, err = p.index(numJoints); err != nil {
+					return err
+				}
+				if w.Bias, err = p.float(); err != nil {
+					return err
+				}
+				w.Position, err = p.vec3()
+				return err
+			})
+		default:
+			return mesh, p.errorf("unexpected %q in mesh", key)
+		}
+
+		if err != nil {
+			return mesh, err
+		}
+	}
+}
+
+// list reads a count followed by that many elements, each introduced by key
+// and its index, in order, and read by elem.
+func list[T any](p *parser, dst *[]T, key string, elem func(*T) error) error {
+	n, err := p.count()
+	if err != nil {
+		return err
+	}
+
+	*dst = make([]T, 0, min(n, 1<<16))
+	for index := range n {
+		if err := p.expect(key); err != nil {
+			return err
+		}
+		if i, err := p.int(); err != nil {
+			return err
+		} else if i != index {
+			return p.errorf("%s %d is out of order, expected %d", key, i, index)
+		}
+
+		var v T
+		if err := elem(&v); err != nil {
+			return err
+		}
+		*dst = append(*dst, v)
+	}
+	return nil
+}
+
+// check returns an error if any of the mesh's triangles or vertices refer to
+// vertices or weights it doesn't have.
+func (m *Mesh) check() error {
+	for index, v := range m.Vertices {
+		if v.FirstWeight > len(m.Weights) || v.NumWeights > len(m.Weights)-v.FirstWeight {
+			return fmt.Errorf("md5: vertex %d refers to weights [%d, %d) of %d",
+				index, v.FirstWeight, v.FirstWeight+v.NumWeights, len(m.Weights))
+		}
+	}
+
+	for index, tri := range m.Triangles {
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			if v < 0 || int(v) >= len(m.Vertices) {
+				return fmt.Errorf("md5: triangle %d refers to vertex %d of %d", index, v, len(m.Vertices))
+			}
+		}
+	}
+
+	return nil
+}
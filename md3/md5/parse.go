@@ -0,0 +1,153 @@
+package md5
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/token"
+)
+
+// md5Version is the only version of MD5 files supported, as written by
+// Doom 3's exporters.
+const md5Version = 10
+
+// parser reads the tokens of an MD5 file, reporting errors with the line
+// they occurred on.
+type parser struct {
+	s *token.Scanner
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("md5: line %d: %s", p.s.Line(), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) next() (string, error) {
+	tok, ok := p.s.Next()
+	if !ok {
+		return "", p.errorf("unexpected end of file")
+	}
+	return tok, nil
+}
+
+func (p *parser) expect(want string) error {
+	tok, err := p.next()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return p.errorf("expected %q, found %q", want, tok)
+	}
+	return nil
+}
+
+func (p *parser) int() (int, error) {
+	tok, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil {
+		return 0, p.errorf("invalid integer %q", tok)
+	}
+	return n, nil
+}
+
+// count reads a count, which must be at least zero.
+func (p *parser) count() (int, error) {
+	n, err := p.int()
+	if err == nil && n < 0 {
+		err = p.errorf("negative count %d", n)
+	}
+	return n, err
+}
+
+// index reads an index into a list of n elements.
+func (p *parser) index(n int) (int, error) {
+	index, err := p.int()
+	if err == nil && (index < 0 || index >= n) {
+		err = p.errorf("index %d is out of range: %d defined", index, n)
+	}
+	return index, err
+}
+
+func (p *parser) float() (float32, error) {
+	tok, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(tok, 32)
+	if err != nil {
+		return 0, p.errorf("invalid number %q", tok)
+	}
+	return float32(f), nil
+}
+
+// floats reads a parenthesized list of len(dst) numbers into dst.
+func (p *parser) floats(dst []float32) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for index := range dst {
+		f, err := p.float()
+		if err != nil {
+			return err
+		}
+		dst[index] = f
+	}
+	return p.expect(")")
+}
+
+func (p *parser) vec3() (md3.Vec3, error) {
+	var v [3]float32
+	err := p.floats(v[:])
+	return md3.Vec3{X: v[0], Y: v[1], Z: v[2]}, err
+}
+
+// quat reads a parenthesized unit quaternion, stored as its X, Y and Z
+// components.
+func (p *parser) quat() (md3.Quat, error) {
+	var v [3]float32
+	err := p.floats(v[:])
+	return unitQuat(v[0], v[1], v[2]), err
+}
+
+// unitQuat returns the unit quaternion with the given X, Y and Z components.
+// Doom 3 rotates by the conjugate of the quaternion with a positive W, so W
+// is taken to be negative here to rotate the same way with md3.Quat.
+func unitQuat(x, y, z float32) md3.Quat {
+	w := 1 - x*x - y*y - z*z
+	if w < 0 {
+		return md3.Quat{X: x, Y: y, Z: z}.Normalize()
+	}
+	return md3.Quat{X: x, Y: y, Z: z, W: -float32(math.Sqrt(float64(w)))}
+}
+
+// header reads the version and command line every MD5 file begins with.
+func (p *parser) header() error {
+	if err := p.expect("MD5Version"); err != nil {
+		return err
+	}
+	version, err := p.int()
+	if err != nil {
+		return err
+	}
+	if version != md5Version {
+		return p.errorf("unsupported version %d", version)
+	}
+
+	if tok, ok := p.s.Peek(); ok && tok == "commandline" {
+		p.s.Next()
+		_, err = p.next()
+	}
+	return err
+}
+
+// keyCount reads the given key and the count following it.
+func (p *parser) keyCount(key string) (int, error) {
+	if err := p.expect(key); err != nil {
+		return 0, err
+	}
+	return p.count()
+}
@@ -0,0 +1,265 @@
+package mdc
+
+import "github.com/nilium/go-md3/md3"
+
+// anorms256 is the table of normals the high byte of a compressed vertex
+// indexes, from the RTCW renderer's anorms256.h. Entry 16*p+y is the forward
+// vector of pitch p and yaw y, each in steps of 11.25 degrees.
+var anorms256 = [256]md3.Vec3{
+	{X: 1.000000, Y: 0.000000, Z: 0.000000},
+	{X: 0.980785, Y: 0.195090, Z: 0.000000},
+	{X: 0.923880, Y: 0.382683, Z: 0.000000},
+	{X: 0.831470, Y: 0.555570, Z: 0.000000},
+	{X: 0.707107, Y: 0.707107, Z: 0.000000},
+	{X: 0.555570, Y: 0.831470, Z: 0.000000},
+	{X: 0.382683, Y: 0.923880, Z: 0.000000},
+	{X: 0.195090, Y: 0.980785, Z: 0.000000},
+	{X: 0.000000, Y: 1.000000, Z: 0.000000},
+	{X: -0.195090, Y: 0.980785, Z: 0.000000},
+	{X: -0.382683, Y: 0.923880, Z: 0.000000},
+	{X: -0.555570, Y: 0.831470, Z: 0.000000},
+	{X: -0.707107, Y: 0.707107, Z: 0.000000},
+	{X: -0.831470, Y: 0.555570, Z: 0.000000},
+	{X: -0.923880, Y: 0.382683, Z: 0.000000},
+	{X: -0.980785, Y: 0.195090, Z: 0.000000},
+	{X: 0.980785, Y: 0.000000, Z: -0.195090},
+	{X: 0.961940, Y: 0.191342, Z: -0.195090},
+	{X: 0.906127, Y: 0.375330, Z: -0.195090},
+	{X: 0.815493, Y: 0.544895, Z: -0.195090},
+	{X: 0.693520, Y: 0.693520, Z: -0.195090},
+	{X: 0.544895, Y: 0.815493, Z: -0.195090},
+	{X: 0.375330, Y: 0.906127, Z: -0.195090},
+	{X: 0.191342, Y: 0.961940, Z: -0.195090},
+	{X: 0.000000, Y: 0.980785, Z: -0.195090},
+	{X: -0.191342, Y: 0.961940, Z: -0.195090},
+	{X: -0.375330, Y: 0.906127, Z: -0.195090},
+	{X: -0.544895, Y: 0.815493, Z: -0.195090},
+	{X: -0.693520, Y: 0.693520, Z: -0.195090},
+	{X: -0.815493, Y: 0.544895, Z: -0.195090},
+	{X: -0.906127, Y: 0.375330, Z: -0.195090},
+	{X: -0.961940, Y: 0.191342, Z: -0.195090},
+	{X: 0.923880, Y: 0.000000, Z: -0.382683},
+	{X: 0.906127, Y: 0.180240, Z: -0.382683},
+	{X: 0.853553, Y: 0.353553, Z: -0.382683},
+	{X: 0.768178, Y: 0.513280, Z: -0.382683},
+	{X: 0.653281, Y: 0.653281, Z: -0.382683},
+	{X: 0.513280, Y: 0.768178, Z: -0.382683},
+	{X: 0.353553, Y: 0.853553, Z: -0.382683},
+	{X: 0.180240, Y: 0.906127, Z: -0.382683},
+	{X: 0.000000, Y: 0.923880, Z: -0.382683},
+	{X: -0.180240, Y: 0.906127, Z: -0.382683},
+	{X: -0.353553, Y: 0.853553, Z: -0.382683},
+	{X: -0.513280, Y: 0.768178, Z: -0.382683},
+	{X: -0.653281, Y: 0.653281, Z: -0.382683},
+	{X: -0.768178, Y: 0.513280, Z: -0.382683},
+	{X: -0.853553, Y: 0.353553, Z: -0.382683},
+	{X: -0.906127, Y: 0.180240, Z: -0.382683},
+	{X: 0.831470, Y: 0.000000, Z: -0.555570},
+	{X: 0.815493, Y: 0.162212, Z: -0.555570},
+	{X: 0.768178, Y: 0.318190, Z: -0.555570},
+	{X: 0.691342, Y: 0.461940, Z: -0.555570},
+	{X: 0.587938, Y: 0.587938, Z: -0.555570},
+	{X: 0.461940, Y: 0.691342, Z: -0.555570},
+	{X: 0.318190, Y: 0.768178, Z: -0.555570},
+	{X: 0.162212, Y: 0.815493, Z: -0.555570},
+	{X: 0.000000, Y: 0.831470, Z: -0.555570},
+	{X: -0.162212, Y: 0.815493, Z: -0.555570},
+	{X: -0.318190, Y: 0.768178, Z: -0.555570},
+	{X: -0.461940, Y: 0.691342, Z: -0.555570},
+	{X: -0.587938, Y: 0.587938, Z: -0.555570},
+	{X: -0.691342, Y: 0.461940, Z: -0.555570},
+	{X: -0.768178, Y: 0.318190, Z: -0.555570},
+	{X: -0.815493, Y: 0.162212, Z: -0.555570},
+	{X: 0.707107, Y: 0.000000, Z: -0.707107},
+	{X: 0.693520, Y: 0.137950, Z: -0.707107},
+	{X: 0.653281, Y: 0.270598, Z: -0.707107},
+	{X: 0.587938, Y: 0.392847, Z: -0.707107},
+	{X: 0.500000, Y: 0.500000, Z: -0.707107},
+	{X: 0.392847, Y: 0.587938, Z: -0.707107},
+	{X: 0.270598, Y: 0.653281, Z: -0.707107},
+	{X: 0.137950, Y: 0.693520, Z: -0.707107},
+	{X: 0.000000, Y: 0.707107, Z: -0.707107},
+	{X: -0.137950, Y: 0.693520, Z: -0.707107},
+	{X: -0.270598, Y: 0.653281, Z: -0.707107},
+	{X: -0.392847, Y: 0.587938, Z: -0.707107},
+	{X: -0.500000, Y: 0.500000, Z: -0.707107},
+	{X: -0.587938, Y: 0.392847, Z: -0.707107},
+	{X: -0.653281, Y: 0.270598, Z: -0.707107},
+	{X: -0.693520, Y: 0.137950, Z: -0.707107},
+	{X: 0.555570, Y: 0.000000, Z: -0.831470},
+	{X: 0.544895, Y: 0.108386, Z: -0.831470},
+	{X: 0.513280, Y: 0.212608, Z: -0.831470},
+	{X: 0.461940, Y: 0.308658, Z: -0.831470},
+	{X: 0.392847, Y: 0.392847, Z: -0.831470},
+	{X: 0.308658, Y: 0.461940, Z: -0.831470},
+	{X: 0.212608, Y: 0.513280, Z: -0.831470},
+	{X: 0.108386, Y: 0.544895, Z: -0.831470},
+	{X: 0.000000, Y: 0.555570, Z: -0.831470},
+	{X: -0.108386, Y: 0.544895, Z: -0.831470},
+	{X: -0.212608, Y: 0.513280, Z: -0.831470},
+	{X: -0.308658, Y: 0.461940, Z: -0.831470},
+	{X: -0.392847, Y: 0.392847, Z: -0.831470},
+	{X: -0.461940, Y: 0.308658, Z: -0.831470},
+	{X: -0.513280, Y: 0.212608, Z: -0.831470},
+	{X: -0.544895, Y: 0.108386, Z: -0.831470},
+	{X: 0.382683, Y: 0.000000, Z: -0.923880},
+	{X: 0.375330, Y: 0.074658, Z: -0.923880},
+	{X: 0.353553, Y: 0.146447, Z: -0.923880},
+	{X: 0.318190, Y: 0.212608, Z: -0.923880},
+	{X: 0.270598, Y: 0.270598, Z: -0.923880},
+	{X: 0.212608, Y: 0.318190, Z: -0.923880},
+	{X: 0.146447, Y: 0.353553, Z: -0.923880},
+	{X: 0.074658, Y: 0.375330, Z: -0.923880},
+	{X: 0.000000, Y: 0.382683, Z: -0.923880},
+	{X: -0.074658, Y: 0.375330, Z: -0.923880},
+	{X: -0.146447, Y: 0.353553, Z: -0.923880},
+	{X: -0.212608, Y: 0.318190, Z: -0.923880},
+	{X: -0.270598, Y: 0.270598, Z: -0.923880},
+	{X: -0.318190, Y: 0.212608, Z: -0.923880},
+	{X: -0.353553, Y: 0.146447, Z: -0.923880},
+	{X: -0.375330, Y: 0.074658, Z: -0.923880},
+	{X: 0.195090, Y: 0.000000, Z: -0.980785},
+	{X: 0.191342, Y: 0.038060, Z: -0.980785},
+	{X: 0.180240, Y: 0.074658, Z: -0.980785},
+	{X: 0.162212, Y: 0.108386, Z: -0.980785},
+	{X: 0.137950, Y: 0.137950, Z: -0.980785},
+	{X: 0.108386, Y: 0.162212, Z: -0.980785},
+	{X: 0.074658, Y: 0.180240, Z: -0.980785},
+	{X: 0.038060, Y: 0.191342, Z: -0.980785},
+	{X: 0.000000, Y: 0.195090, Z: -0.980785},
+	{X: -0.038060, Y: 0.191342, Z: -0.980785},
+	{X: -0.074658, Y: 0.180240, Z: -0.980785},
+	{X: -0.108386, Y: 0.162212, Z: -0.980785},
+	{X: -0.137950, Y: 0.137950, Z: -0.980785},
+	{X: -0.162212, Y: 0.108386, Z: -0.980785},
+	{X: -0.180240, Y: 0.074658, Z: -0.980785},
+	{X: -0.191342, Y: 0.038060, Z: -0.980785},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: 0.000000, Y: 0.000000, Z: -1.000000},
+	{X: -0.195090, Y: 0.000000, Z: -0.980785},
+	{X: -0.191342, Y: -0.038060, Z: -0.980785},
+	{X: -0.180240, Y: -0.074658, Z: -0.980785},
+	{X: -0.162212, Y: -0.108386, Z: -0.980785},
+	{X: -0.137950, Y: -0.137950, Z: -0.980785},
+	{X: -0.108386, Y: -0.162212, Z: -0.980785},
+	{X: -0.074658, Y: -0.180240, Z: -0.980785},
+	{X: -0.038060, Y: -0.191342, Z: -0.980785},
+	{X: 0.000000, Y: -0.195090, Z: -0.980785},
+	{X: 0.038060, Y: -0.191342, Z: -0.980785},
+	{X: 0.074658, Y: -0.180240, Z: -0.980785},
+	{X: 0.108386, Y: -0.162212, Z: -0.980785},
+	{X: 0.137950, Y: -0.137950, Z: -0.980785},
+	{X: 0.162212, Y: -0.108386, Z: -0.980785},
+	{X: 0.180240, Y: -0.074658, Z: -0.980785},
+	{X: 0.191342, Y: -0.038060, Z: -0.980785},
+	{X: -0.382683, Y: 0.000000, Z: -0.923880},
+	{X: -0.375330, Y: -0.074658, Z: -0.923880},
+	{X: -0.353553, Y: -0.146447, Z: -0.923880},
+	{X: -0.318190, Y: -0.212608, Z: -0.923880},
+	{X: -0.270598, Y: -0.270598, Z: -0.923880},
+	{X: -0.212608, Y: -0.318190, Z: -0.923880},
+	{X: -0.146447, Y: -0.353553, Z: -0.923880},
+	{X: -0.074658, Y: -0.375330, Z: -0.923880},
+	{X: 0.000000, Y: -0.382683, Z: -0.923880},
+	{X: 0.074658, Y: -0.375330, Z: -0.923880},
+	{X: 0.146447, Y: -0.353553, Z: -0.923880},
+	{X: 0.212608, Y: -0.318190, Z: -0.923880},
+	{X: 0.270598, Y: -0.270598, Z: -0.923880},
+	{X: 0.318190, Y: -0.212608, Z: -0.923880},
+	{X: 0.353553, Y: -0.146447, Z: -0.923880},
+	{X: 0.375330, Y: -0.074658, Z: -0.923880},
+	{X: -0.555570, Y: 0.000000, Z: -0.831470},
+	{X: -0.544895, Y: -0.108386, Z: -0.831470},
+	{X: -0.513280, Y: -0.212608, Z: -0.831470},
+	{X: -0.461940, Y: -0.308658, Z: -0.831470},
+	{X: -0.392847, Y: -0.392847, Z: -0.831470},
+	{X: -0.308658, Y: -0.461940, Z: -0.831470},
+	{X: -0.212608, Y: -0.513280, Z: -0.831470},
+	{X: -0.108386, Y: -0.544895, Z: -0.831470},
+	{X: 0.000000, Y: -0.555570, Z: -0.831470},
+	{X: 0.108386, Y: -0.544895, Z: -0.831470},
+	{X: 0.212608, Y: -0.513280, Z: -0.831470},
+	{X: 0.308658, Y: -0.461940, Z: -0.831470},
+	{X: 0.392847, Y: -0.392847, Z: -0.831470},
+	{X: 0.461940, Y: -0.308658, Z: -0.831470},
+	{X: 0.513280, Y: -0.212608, Z: -0.831470},
+	{X: 0.544895, Y: -0.108386, Z: -0.831470},
+	{X: -0.707107, Y: 0.000000, Z: -0.707107},
+	{X: -0.693520, Y: -0.137950, Z: -0.707107},
+	{X: -0.653281, Y: -0.270598, Z: -0.707107},
+	{X: -0.587938, Y: -0.392847, Z: -0.707107},
+	{X: -0.500000, Y: -0.500000, Z: -0.707107},
+	{X: -0.392847, Y: -0.587938, Z: -0.707107},
+	{X: -0.270598, Y: -0.653281, Z: -0.707107},
+	{X: -0.137950, Y: -0.693520, Z: -0.707107},
+	{X: 0.000000, Y: -0.707107, Z: -0.707107},
+	{X: 0.137950, Y: -0.693520, Z: -0.707107},
+	{X: 0.270598, Y: -0.653281, Z: -0.707107},
+	{X: 0.392847, Y: -0.587938, Z: -0.707107},
+	{X: 0.500000, Y: -0.500000, Z: -0.707107},
+	{X: 0.587938, Y: -0.392847, Z: -0.707107},
+	{X: 0.653281, Y: -0.270598, Z: -0.707107},
+	{X: 0.693520, Y: -0.137950, Z: -0.707107},
+	{X: -0.831470, Y: 0.000000, Z: -0.555570},
+	{X: -0.815493, Y: -0.162212, Z: -0.555570},
+	{X: -0.768178, Y: -0.318190, Z: -0.555570},
+	{X: -0.691342, Y: -0.461940, Z: -0.555570},
+	{X: -0.587938, Y: -0.587938, Z: -0.555570},
+	{X: -0.461940, Y: -0.691342, Z: -0.555570},
+	{X: -0.318190, Y: -0.768178, Z: -0.555570},
+	{X: -0.162212, Y: -0.815493, Z: -0.555570},
+	{X: 0.000000, Y: -0.831470, Z: -0.555570},
+	{X: 0.162212, Y: -0.815493, Z: -0.555570},
+	{X: 0.318190, Y: -0.768178, Z: -0.555570},
+	{X: 0.461940, Y: -0.691342, Z: -0.555570},
+	{X: 0.587938, Y: -0.587938, Z: -0.555570},
+	{X: 0.691342, Y: -0.461940, Z: -0.555570},
+	{X: 0.768178, Y: -0.318190, Z: -0.555570},
+	{X: 0.815493, Y: -0.162212, Z: -0.555570},
+	{X: -0.923880, Y: 0.000000, Z: -0.382683},
+	{X: -0.906127, Y: -0.180240, Z: -0.382683},
+	{X: -0.853553, Y: -0.353553, Z: -0.382683},
+	{X: -0.768178, Y: -0.513280, Z: -0.382683},
+	{X: -0.653281, Y: -0.653281, Z: -0.382683},
+	{X: -0.513280, Y: -0.768178, Z: -0.382683},
+	{X: -0.353553, Y: -0.853553, Z: -0.382683},
+	{X: -0.180240, Y: -0.906127, Z: -0.382683},
+	{X: 0.000000, Y: -0.923880, Z: -0.382683},
+	{X: 0.180240, Y: -0.906127, Z: -0.382683},
+	{X: 0.353553, Y: -0.853553, Z: -0.382683},
+	{X: 0.513280, Y: -0.768178, Z: -0.382683},
+	{X: 0.653281, Y: -0.653281, Z: -0.382683},
+	{X: 0.768178, Y: -0.513280, Z: -0.382683},
+	{X: 0.853553, Y: -0.353553, Z: -0.382683},
+	{X: 0.906127, Y: -0.180240, Z: -0.382683},
+	{X: -0.980785, Y: 0.000000, Z: -0.195090},
+	{X: -0.961940, Y: -0.191342, Z: -0.195090},
+	{X: -0.906127, Y: -0.375330, Z: -0.195090},
+	{X: -0.815493, Y: -0.544895, Z: -0.195090},
+	{X: -0.693520, Y: -0.693520, Z: -0.195090},
+	{X: -0.544895, Y: -0.815493, Z: -0.195090},
+	{X: -0.375330, Y: -0.906127, Z: -0.195090},
+	{X: -0.191342, Y: -0.961940, Z: -0.195090},
+	{X: 0.000000, Y: -0.980785, Z: -0.195090},
+	{X: 0.191342, Y: -0.961940, Z: -0.195090},
+	{X: 0.375330, Y: -0.906127, Z: -0.195090},
+	{X: 0.544895, Y: -0.815493, Z: -0.195090},
+	{X: 0.693520, Y: -0.693520, Z: -0.195090},
+	{X: 0.815493, Y: -0.544895, Z: -0.195090},
+	{X: 0.906127, Y: -0.375330, Z: -0.195090},
+	{X: 0.961940, Y: -0.191342, Z: -0.195090},
+}
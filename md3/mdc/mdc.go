@@ -0,0 +1,347 @@
+// Package mdc reads the compressed MD3 models, or MDC files, used by Return to
+// Castle Wolfenstein and Enemy Territory, decoding them into md3.Models.
+//
+// MDC files share MD3's layout, but store most frames of each surface as
+// small offsets from a full "base" frame, and store tags as fixed-point
+// origins and angles rather than axes.
+package mdc
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/binread"
+)
+
+const (
+	mdcIdent   = "IDPC"
+	mdcVersion = 2
+
+	mdcHeaderSize        = 112
+	mdcSurfaceHeaderSize = 124
+	mdcFrameSize         = 56
+	mdcTagNameSize       = 64
+	mdcTagSize           = 12
+	mdcShaderSize        = 68
+	mdcTriangleSize      = 12
+	mdcTexCoordSize      = 8
+	mdcVertexSize        = 8
+	mdcCompVertexSize    = 4
+
+	maxQPath       = 64
+	maxFrameLength = 16
+
+	// Compressed vertices are offsets of up to 127 steps of 0.05 units in
+	// each direction from their base frame.
+	compMaxOffset = 127
+	compScale     = 0.05
+
+	// Tag angles are in steps of 360/32700 degrees.
+	tagAngleScale = 360.0 / 32700.0
+
+	xyzScale = 1.0 / 64.0
+)
+
+// Limits on the number of elements in an MD3 model, which MDC files share.
+// Counts outside of these are rejected before anything is allocated for them.
+const (
+	maxFrames    = 1024
+	maxTags      = 16
+	maxSurfaces  = 32
+	maxShaders   = 256
+	maxVertices  = 4096
+	maxTriangles = 8192
+)
+
+type header struct {
+	Ident       [4]byte
+	Version     int32
+	Name        [maxQPath]byte
+	Flags       int32
+	NumFrames   int32
+	NumTags     int32
+	NumSurfaces int32
+	NumSkins    int32
+	OfsFrames   int32
+	OfsTagNames int32
+	OfsTags     int32
+	OfsSurfaces int32
+	OfsEnd      int32
+}
+
+type surfaceHeader struct {
+	Ident              [4]byte
+	Name               [maxQPath]byte
+	Flags              int32
+	NumCompFrames      int32
+	NumBaseFrames      int32
+	NumShaders         int32
+	NumVerts           int32
+	NumTriangles       int32
+	OfsTriangles       int32
+	OfsShaders         int32
+	OfsST              int32
+	OfsXYZNormals      int32
+	OfsXYZCompressed   int32
+	OfsFrameBaseFrames int32
+	OfsFrameCompFrames int32
+	OfsEnd             int32
+}
+
+type frame struct {
+	Min, Max, Origin [3]float32
+	Radius           float32
+	Name             [maxFrameLength]byte
+}
+
+type tag struct {
+	Origin [3]int16
+	Angles [3]int16
+}
+
+type shader struct {
+	Name  [maxQPath]byte
+	Index int32
+}
+
+type vertex struct {
+	Origin  [3]int16
+	Zenith  uint8
+	Azimuth uint8
+}
+
+// Decode reads an MDC model from r.
+func Decode(r io.Reader) (*md3.Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read decodes the MDC model in data into an md3.Model, with every frame of
+// every surface uncompressed.
+func Read(data []byte) (*md3.Model, error) {
+	var h header
+	if err := binread.ReadAt(data, 0, mdcHeaderSize, &h); err != nil {
+		return nil, fmt.Errorf("mdc: header: %v", err)
+	}
+
+	switch {
+	case string(h.Ident[:]) != mdcIdent:
+		return nil, fmt.Errorf("mdc: invalid ident %q", h.Ident[:])
+	case h.Version != mdcVersion:
+		return nil, fmt.Errorf("mdc: unsupported version %d", h.Version)
+	}
+
+	if err := checkCounts([]count{
+		{"frame", h.NumFrames, maxFrames},
+		{"tag", h.NumTags, maxTags},
+		{"surface", h.NumSurfaces, maxSurfaces},
+	}); err != nil {
+		return nil, fmt.Errorf("mdc: %v", err)
+	}
+
+	b := md3.NewModelBuilder(binread.NulString(h.Name[:]))
+
+	frames, err := binread.ReadSlice[frame](data, int64(h.OfsFrames), int64(h.NumFrames), mdcFrameSize)
+	if err != nil {
+		return nil, fmt.Errorf("mdc: frames: %v", err)
+	}
+	for _, f := range frames {
+		b.AddFrame(binread.NulString(f.Name[:]), binread.Vec3(f.Min), binread.Vec3(f.Max), binread.Vec3(f.Origin), f.Radius)
+	}
+
+	if err := readTags(b, data, &h); err != nil {
+		return nil, err
+	}
+
+	ofs := int64(h.OfsSurfaces)
+	for index := 0; index < int(h.NumSurfaces); index++ {
+		end, err := readSurface(b, data, ofs, int(h.NumFrames))
+		if err != nil {
+			return nil, fmt.Errorf("mdc: surface %d: %v", index, err)
+		}
+		ofs = end
+	}
+
+	return b.Build()
+}
+
+func readTags(b *md3.ModelBuilder, data []byte, h *header) error {
+	names, err := binread.ReadSlice[[mdcTagNameSize]byte](data, int64(h.OfsTagNames), int64(h.NumTags), mdcTagNameSize)
+	if err != nil {
+		return fmt.Errorf("mdc: tag names: %v", err)
+	}
+
+	tags, err := binread.ReadSlice[tag](data, int64(h.OfsTags), int64(h.NumFrames)*int64(h.NumTags), mdcTagSize)
+	if err != nil {
+		return fmt.Errorf("mdc: tags: %v", err)
+	}
+
+	// Tags are stored frame-major, as in MD3 files.
+	for index, name := range names {
+		frames := make([]md3.TagFrame, h.NumFrames)
+		for frame := range frames {
+			frames[frame] = decodeTag(tags[frame*int(h.NumTags)+index])
+		}
+		b.AddTag(binread.NulString(name[:]), frames...)
+	}
+
+	return nil
+}
+
+// decodeTag converts a compressed tag to a tag frame. Its angles are pitch,
+// yaw and roll, converted to axes as the engine's AnglesToAxis does.
+func decodeTag(t tag) md3.TagFrame {
+	var origin, angles [3]float64
+	for k := range 3 {
+		origin[k] = float64(t.Origin[k]) * xyzScale
+		angles[k] = float64(t.Angles[k]) * tagAngleScale * math.Pi / 180
+	}
+
+	sp, cp := math.Sincos(angles[0])
+	sy, cy := math.Sincos(angles[1])
+	sr, cr := math.Sincos(angles[2])
+
+	return md3.TagFrame{
+		Origin:       md3.Vec3{X: float32(origin[0]), Y: float32(origin[1]), Z: float32(origin[2])},
+		XOrientation: md3.Vec3{X: float32(cp * cy), Y: float32(cp * sy), Z: float32(-sp)},
+		YOrientation: md3.Vec3{X: float32(sr*sp*cy - cr*sy), Y: float32(sr*sp*sy + cr*cy), Z: float32(sr * cp)},
+		ZOrientation: md3.Vec3{X: float32(cr*sp*cy + sr*sy), Y: float32(cr*sp*sy - sr*cy), Z: float32(cr * cp)},
+	}
+}
+
+// readSurface reads the surface at offset ofs into b and returns the offset
+// of the surface following it.
+func readSurface(b *md3.ModelBuilder, data []byte, ofs int64, numFrames int) (int64, error) {
+	var h surfaceHeader
+	if err := binread.ReadAt(data, ofs, mdcSurfaceHeaderSize, &h); err != nil {
+		return 0, fmt.Errorf("header: %v", err)
+	}
+
+	if string(h.Ident[:]) != mdcIdent {
+		return 0, fmt.Errorf("invalid ident %q", h.Ident[:])
+	}
+
+	if err := checkCounts([]count{
+		{"shader", h.NumShaders, maxShaders},
+		{"vertex", h.NumVerts, maxVertices},
+		{"triangle", h.NumTriangles, maxTriangles},
+		{"base frame", h.NumBaseFrames, maxFrames},
+		{"compressed frame", h.NumCompFrames, maxFrames},
+	}); err != nil {
+		return 0, err
+	}
+
+	numVerts := int64(h.NumVerts)
+	shaders, err := binread.ReadSlice[shader](data, ofs+int64(h.OfsShaders), int64(h.NumShaders), mdcShaderSize)
+	if err != nil {
+		return 0, fmt.Errorf("shaders: %v", err)
+	}
+	triangles, err := binread.ReadSlice[md3.Triangle](data, ofs+int64(h.OfsTriangles), int64(h.NumTriangles), mdcTriangleSize)
+	if err != nil {
+		return 0, fmt.Errorf("triangles: %v", err)
+	}
+	texcoords, err := binread.ReadSlice[md3.TexCoord](data, ofs+int64(h.OfsST), numVerts, mdcTexCoordSize)
+	if err != nil {
+		return 0, fmt.Errorf("texcoords: %v", err)
+	}
+	base, err := binread.ReadSlice[vertex](data, ofs+int64(h.OfsXYZNormals), numVerts*int64(h.NumBaseFrames), mdcVertexSize)
+	if err != nil {
+		return 0, fmt.Errorf("base frames: %v", err)
+	}
+	comp, err := binread.ReadSlice[uint32](data, ofs+int64(h.OfsXYZCompressed), numVerts*int64(h.NumCompFrames), mdcCompVertexSize)
+	if err != nil {
+		return 0, fmt.Errorf("compressed frames: %v", err)
+	}
+	baseFrames, err := binread.ReadSlice[int16](data, ofs+int64(h.OfsFrameBaseFrames), int64(numFrames), 2)
+	if err != nil {
+		return 0, fmt.Errorf("base frame indices: %v", err)
+	}
+	compFrames, err := binread.ReadSlice[int16](data, ofs+int64(h.OfsFrameCompFrames), int64(numFrames), 2)
+	if err != nil {
+		return 0, fmt.Errorf("compressed frame indices: %v", err)
+	}
+
+	sb := b.AddSurface(binread.NulString(h.Name[:]))
+	for _, sh := range shaders {
+		sb.AddShader(binread.NulString(sh.Name[:]))
+	}
+
+	for index, tri := range triangles {
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			if v < 0 || int64(v) >= numVerts {
+				return 0, fmt.Errorf("triangle %d refers to vertex %d of %d", index, v, numVerts)
+			}
+		}
+	}
+	sb.SetTriangles(triangles)
+	sb.SetTexCoords(texcoords)
+
+	for frame := range numFrames {
+		baseFrame, compFrame := int(baseFrames[frame]), int(compFrames[frame])
+		if baseFrame < 0 || baseFrame >= int(h.NumBaseFrames) {
+			return 0, fmt.Errorf("frame %d refers to base frame %d of %d", frame, baseFrame, h.NumBaseFrames)
+		} else if compFrame >= int(h.NumCompFrames) {
+			return 0, fmt.Errorf("frame %d refers to compressed frame %d of %d", frame, compFrame, h.NumCompFrames)
+		}
+
+		vertices := make([]md3.Vertex, numVerts)
+		for index := range vertices {
+			v := base[baseFrame*int(numVerts)+index]
+			origin := md3.Vec3{
+				X: float32(v.Origin[0]) * xyzScale,
+				Y: float32(v.Origin[1]) * xyzScale,
+				Z: float32(v.Origin[2]) * xyzScale,
+			}
+
+			normal := md3.SphereNormal(v.Zenith, v.Azimuth)
+
+			// A negative compressed frame index means the frame is stored
+			// in full as a base frame.
+			if compFrame >= 0 {
+				var offset md3.Vec3
+				offset, normal = decodeCompressed(comp[compFrame*int(numVerts)+index])
+				origin = origin.Add(offset)
+			}
+
+			vertices[index] = md3.Vertex{Origin: origin, Normal: normal}
+		}
+		sb.AddVertexFrame(vertices)
+	}
+
+	if h.OfsEnd <= 0 {
+		return 0, fmt.Errorf("invalid end offset %d", h.OfsEnd)
+	}
+	return ofs + int64(h.OfsEnd), nil
+}
+
+// decodeCompressed returns the offset from its base frame and the normal held
+// by a compressed vertex. Its low three bytes are the offsets along each axis
+// and its high byte is the index of its normal in anorms256.
+func decodeCompressed(v uint32) (offset, normal md3.Vec3) {
+	axis := func(shift uint) float32 {
+		return (float32((v>>shift)&0xff) - compMaxOffset) * compScale
+	}
+	return md3.Vec3{X: axis(0), Y: axis(8), Z: axis(16)}, anorms256[v>>24]
+}
+
+// checkCounts returns an error if any of the given counts is negative or
+// exceeds its limit. The sizes of sections are checked against the file as
+// they're read.
+func checkCounts(counts []count) error {
+	for _, c := range counts {
+		if c.count < 0 || c.count > c.max {
+			return fmt.Errorf("%s count %d is outside of [0, %d]", c.kind, c.count, c.max)
+		}
+	}
+	return nil
+}
+
+type count struct {
+	kind       string
+	count, max int32
+}
@@ -0,0 +1,64 @@
+package mdr
+
+import (
+	"fmt"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// maxFrameName is the size of an MD3 frame name, including its terminating
+// NUL.
+const maxFrameName = 16
+
+// ToMD3 bakes the surfaces of the given LOD into an MD3 model, skinning them
+// with the bones of each frame in turn, so the MD3 has a frame of vertex
+// animation for each skeletal frame. Tags become MD3 tags following their
+// bones. Frames keep their bounds, origin and radius, and their names,
+// truncated to fit MD3's limit.
+func (m *Model) ToMD3(lod int) (*md3.Model, error) {
+	if lod < 0 || lod >= len(m.LODs) {
+		return nil, fmt.Errorf("mdr: LOD %d is outside of the model's %d LODs", lod, len(m.LODs))
+	}
+
+	b := md3.NewModelBuilder(m.Name)
+
+	surfaces := m.LODs[lod].Surfaces
+	for index := range surfaces {
+		surf := &surfaces[index]
+		sb := b.AddSurface(surf.Name)
+		if surf.Shader != "" {
+			sb.AddShader(surf.Shader)
+		}
+		sb.SetTriangles(surf.Triangles)
+
+		texcoords := make([]md3.TexCoord, len(surf.Vertices))
+		for index, v := range surf.Vertices {
+			texcoords[index] = v.TexCoord
+		}
+		sb.SetTexCoords(texcoords)
+	}
+
+	tagFrames := make([][]md3.TagFrame, len(m.Tags))
+	for index := range m.Frames {
+		frame := &m.Frames[index]
+		name := frame.Name
+		if len(name) >= maxFrameName {
+			name = name[:maxFrameName-1]
+		}
+		b.AddFrame(name, frame.Min, frame.Max, frame.Origin, frame.Radius)
+
+		for surfIndex := range surfaces {
+			b.Surface(surfIndex).AddVertexFrame(surfaces[surfIndex].Skin(nil, frame.Bones))
+		}
+
+		for tagIndex, tag := range m.Tags {
+			tagFrames[tagIndex] = append(tagFrames[tagIndex], tag.Frame(frame.Bones))
+		}
+	}
+
+	for index, tag := range m.Tags {
+		b.AddTag(tag.Name, tagFrames[index]...)
+	}
+
+	return b.Build()
+}
@@ -0,0 +1,397 @@
+// Package mdr reads the skeletal MDR models supported by ioquake3, poses
+// their bones and skins their vertices, and bakes them into MD3 models.
+//
+// MDR files hold a set of bones, whose model-space transforms are stored in
+// full for every frame, and one or more levels of detail, each a list of
+// surfaces whose vertices are weighted to those bones.
+package mdr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/internal/binread"
+)
+
+const (
+	mdrIdent   = "RDM5"
+	mdrVersion = 2
+
+	mdrHeaderSize        = 104
+	mdrSurfaceHeaderSize = 168
+	mdrLODHeaderSize     = 12
+	mdrFrameHeaderSize   = 40
+	mdrFrameNameSize     = 16
+	mdrBoneSize          = 48
+	mdrCompBoneSize      = 24
+	mdrTagSize           = 36
+	mdrTriangleSize      = 12
+	mdrVertexHeaderSize  = 24
+	mdrWeightSize        = 20
+
+	maxQPath   = 64
+	maxTagName = 32
+
+	// MaxBones is the largest number of bones a model may have.
+	MaxBones = 128
+)
+
+// Bone is a bone's transform from its rest space to model space, as a 3x4
+// matrix whose rows are each three rotation elements and a translation.
+type Bone = md3.Mat3x4
+
+// Weight is a bone's influence on a vertex: the vertex's position in the
+// bone's space and how much of the vertex's final position it contributes.
+type Weight struct {
+	Bone   int
+	Weight float32
+	Offset md3.Vec3
+}
+
+// Vertex is a vertex of a surface. Its normal is given in model space and is
+// transformed by the same weights as its position.
+type Vertex struct {
+	Normal   md3.Vec3
+	TexCoord md3.TexCoord
+	Weights  []Weight
+}
+
+// Surface is a triangle mesh with a single shader.
+type Surface struct {
+	Name      string
+	Shader    string
+	Vertices  []Vertex
+	Triangles []md3.Triangle
+	// BoneRefs lists the bones the surface's vertices are weighted to.
+	BoneRefs []int
+}
+
+// LOD is a level of detail: a complete set of surfaces drawn in place of the
+// others at some distance.
+type LOD struct {
+	Surfaces []Surface
+}
+
+// Frame is a frame of animation: its bounds and the transform of every bone.
+// Frames of compressed models have no names.
+type Frame struct {
+	Name     string
+	Min, Max md3.Vec3
+	Origin   md3.Vec3
+	Radius   float32
+	Bones    []Bone
+}
+
+// Tag is a named attachment point that follows a bone.
+type Tag struct {
+	Name string
+	Bone int
+}
+
+// Model is the contents of an MDR file. LODs are ordered from most to least
+// detailed.
+type Model struct {
+	Name     string
+	NumBones int
+	Frames   []Frame
+	LODs     []LOD
+	Tags     []Tag
+	// Compressed is true if the file's frames were compressed. Compressed
+	// bones are decoded when read, losing some precision.
+	Compressed bool
+}
+
+type header struct {
+	Ident     [4]byte
+	Version   int32
+	Name      [maxQPath]byte
+	NumFrames int32
+	NumBones  int32
+	OfsFrames int32
+	NumLODs   int32
+	OfsLODs   int32
+	NumTags   int32
+	OfsTags   int32
+	OfsEnd    int32
+}
+
+type lodHeader struct {
+	NumSurfaces int32
+	OfsSurfaces int32
+	OfsEnd      int32
+}
+
+type surfaceHeader struct {
+	Ident             [4]byte
+	Name              [maxQPath]byte
+	Shader            [maxQPath]byte
+	ShaderIndex       int32
+	OfsHeader         int32
+	NumVerts          int32
+	OfsVerts          int32
+	NumTriangles      int32
+	OfsTriangles      int32
+	NumBoneReferences int32
+	OfsBoneReferences int32
+	OfsEnd            int32
+}
+
+type vertexHeader struct {
+	Normal     [3]float32
+	TexCoord   [2]float32
+	NumWeights int32
+}
+
+type weight struct {
+	BoneIndex  int32
+	BoneWeight float32
+	Offset     [3]float32
+}
+
+type frameHeader struct {
+	Min, Max, Origin [3]float32
+	Radius           float32
+}
+
+type tag struct {
+	BoneIndex int32
+	Name      [maxTagName]byte
+}
+
+// Decode reads an MDR model from r.
+func Decode(r io.Reader) (*Model, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// Read reads an MDR model from data. Every offset is checked against the
+// size of data and every index against the list it refers to, so a model
+// returned without error is safe to pose and skin.
+func Read(data []byte) (*Model, error) {
+	var h header
+	if err := binread.ReadAt(data, 0, mdrHeaderSize, &h); err != nil {
+		return nil, fmt.Errorf("mdr: header: %v", err)
+	}
+
+	switch {
+	case string(h.Ident[:]) != mdrIdent:
+		return nil, fmt.Errorf("mdr: invalid ident %q", h.Ident[:])
+	case h.Version != mdrVersion:
+		return nil, fmt.Errorf("mdr: unsupported version %d", h.Version)
+	case h.NumBones < 0 || h.NumBones > MaxBones:
+		return nil, fmt.Errorf("mdr: bone count %d is outside of [0, %d]", h.NumBones, MaxBones)
+	case h.NumFrames < 0 || h.NumLODs < 0 || h.NumTags < 0:
+		return nil, fmt.Errorf("mdr: negative frame, LOD or tag count (%d, %d, %d)", h.NumFrames, h.NumLODs, h.NumTags)
+	}
+
+	m := &Model{
+		Name:     binread.NulString(h.Name[:]),
+		NumBones: int(h.NumBones),
+		// A negative frame offset marks the frames as compressed.
+		Compressed: h.OfsFrames < 0,
+	}
+
+	if err := m.readFrames(data, &h); err != nil {
+		return nil, err
+	}
+
+	tags, err := binread.ReadSlice[tag](data, int64(h.OfsTags), int64(h.NumTags), mdrTagSize)
+	if err != nil {
+		return nil, fmt.Errorf("mdr: tags: %v", err)
+	}
+	for index, t := range tags {
+		if t.BoneIndex < 0 || t.BoneIndex >= h.NumBones {
+			return nil, fmt.Errorf("mdr: tag %d refers to bone %d of %d", index, t.BoneIndex, h.NumBones)
+		}
+		m.Tags = append(m.Tags, Tag{Name: binread.NulString(t.Name[:]), Bone: int(t.BoneIndex)})
+	}
+
+	ofs := int64(h.OfsLODs)
+	for index := range int(h.NumLODs) {
+		lod, end, err := m.readLOD(data, ofs)
+		if err != nil {
+			return nil, fmt.Errorf("mdr: LOD %d: %v", index, err)
+		}
+		m.LODs = append(m.LODs, lod)
+		ofs = end
+	}
+
+	return m, nil
+}
+
+func (m *Model) readFrames(data []byte, h *header) error {
+	ofs, boneSize, headerSize := int64(h.OfsFrames), int64(mdrBoneSize), int64(mdrFrameHeaderSize+mdrFrameNameSize)
+	if m.Compressed {
+		ofs, boneSize, headerSize = -ofs, mdrCompBoneSize, mdrFrameHeaderSize
+	}
+
+	frameSize := headerSize + boneSize*int64(h.NumBones)
+	if err := binread.CheckRange(data, ofs, int64(h.NumFrames), frameSize); err != nil {
+		return fmt.Errorf("mdr: frames: %v", err)
+	}
+
+	m.Frames = make([]Frame, h.NumFrames)
+	for index := range m.Frames {
+		frame := data[ofs+int64(index)*frameSize:]
+
+		var fh frameHeader
+		binary.Read(bytes.NewReader(frame), binary.LittleEndian, &fh)
+		f := Frame{
+			Min:    binread.Vec3(fh.Min),
+			Max:    binread.Vec3(fh.Max),
+			Origin: binread.Vec3(fh.Origin),
+			Radius: fh.Radius,
+			Bones:  make([]Bone, h.NumBones),
+		}
+
+		bones := frame[headerSize:]
+		if m.Compressed {
+			for bone := range f.Bones {
+				f.Bones[bone] = uncompressBone(bones[bone*mdrCompBoneSize:])
+			}
+		} else {
+			f.Name = binread.NulString(frame[mdrFrameHeaderSize:headerSize])
+			binary.Read(bytes.NewReader(bones), binary.LittleEndian, f.Bones)
+		}
+
+		m.Frames[index] = f
+	}
+
+	return nil
+}
+
+// uncompressBone decodes a compressed bone: a translation in units of 1/64
+// followed by the rotation's nine elements, each a 16-bit integer biased by
+// 2^15.
+func uncompressBone(comp []byte) Bone {
+	value := func(index int) float32 {
+		return float32(int(binary.LittleEndian.Uint16(comp[2*index:])) - 1<<15)
+	}
+
+	const (
+		translateScale = 1.0 / 64
+		rotateScale    = 1.0 / (1<<15 - 2)
+	)
+
+	var bone Bone
+	for row := range 3 {
+		bone[row*4+3] = value(row) * translateScale
+		for col := range 3 {
+			bone[row*4+col] = value(3+row*3+col) * rotateScale
+		}
+	}
+	return bone
+}
+
+// readLOD reads the LOD at offset ofs and returns it along with the offset of
+// the LOD following it.
+func (m *Model) readLOD(data []byte, ofs int64) (LOD, int64, error) {
+	var h lodHeader
+	if err := binread.ReadAt(data, ofs, mdrLODHeaderSize, &h); err != nil {
+		return LOD{}, 0, fmt.Errorf("header: %v", err)
+	}
+
+	if h.NumSurfaces < 0 {
+		return LOD{}, 0, fmt.Errorf("negative surface count %d", h.NumSurfaces)
+	} else if h.OfsEnd <= 0 {
+		return LOD{}, 0, fmt.Errorf("invalid end offset %d", h.OfsEnd)
+	}
+
+	var lod LOD
+	surfOfs := ofs + int64(h.OfsSurfaces)
+	for index := range int(h.NumSurfaces) {
+		surf, end, err := m.readSurface(data, surfOfs)
+		if err != nil {
+			return LOD{}, 0, fmt.Errorf("surface %d: %v", index, err)
+		}
+		lod.Surfaces = append(lod.Surfaces, surf)
+		surfOfs = end
+	}
+
+	return lod, ofs + int64(h.OfsEnd), nil
+}
+
+// readSurface reads the surface at offset ofs and returns it along with the
+// offset of the surface following it.
+func (m *Model) readSurface(data []byte, ofs int64) (Surface, int64, error) {
+	var h surfaceHeader
+	if err := binread.ReadAt(data, ofs, mdrSurfaceHeaderSize, &h); err != nil {
+		return Surface{}, 0, fmt.Errorf("header: %v", err)
+	}
+
+	switch {
+	case h.NumVerts < 0 || h.NumTriangles < 0 || h.NumBoneReferences < 0:
+		return Surface{}, 0, fmt.Errorf("negative vertex, triangle or bone reference count (%d, %d, %d)",
+			h.NumVerts, h.NumTriangles, h.NumBoneReferences)
+	case h.OfsEnd <= 0:
+		return Surface{}, 0, fmt.Errorf("invalid end offset %d", h.OfsEnd)
+	}
+
+	surf := Surface{
+		Name:   binread.NulString(h.Name[:]),
+		Shader: binread.NulString(h.Shader[:]),
+	}
+
+	// Vertices vary in size with their number of weights, so each is
+	// checked against the file as it's read.
+	if err := binread.CheckRange(data, ofs+int64(h.OfsVerts), int64(h.NumVerts), mdrVertexHeaderSize); err != nil {
+		return Surface{}, 0, fmt.Errorf("vertices: %v", err)
+	}
+	surf.Vertices = make([]Vertex, h.NumVerts)
+	vertOfs := ofs + int64(h.OfsVerts)
+	for index := range surf.Vertices {
+		var vh vertexHeader
+		if err := binread.ReadAt(data, vertOfs, mdrVertexHeaderSize, &vh); err != nil {
+			return Surface{}, 0, fmt.Errorf("vertex %d: %v", index, err)
+		}
+		vertOfs += mdrVertexHeaderSize
+
+		weights, err := binread.ReadSlice[weight](data, vertOfs, int64(vh.NumWeights), mdrWeightSize)
+		if err != nil {
+			return Surface{}, 0, fmt.Errorf("vertex %d: weights: %v", index, err)
+		}
+		vertOfs += int64(len(weights)) * mdrWeightSize
+
+		v := Vertex{
+			Normal:   binread.Vec3(vh.Normal),
+			TexCoord: md3.TexCoord{S: vh.TexCoord[0], T: vh.TexCoord[1]},
+			Weights:  make([]Weight, len(weights)),
+		}
+		for k, w := range weights {
+			if w.BoneIndex < 0 || int(w.BoneIndex) >= m.NumBones {
+				return Surface{}, 0, fmt.Errorf("vertex %d refers to bone %d of %d", index, w.BoneIndex, m.NumBones)
+			}
+			v.Weights[k] = Weight{Bone: int(w.BoneIndex), Weight: w.BoneWeight, Offset: binread.Vec3(w.Offset)}
+		}
+		surf.Vertices[index] = v
+	}
+
+	triangles, err := binread.ReadSlice[md3.Triangle](data, ofs+int64(h.OfsTriangles), int64(h.NumTriangles), mdrTriangleSize)
+	if err != nil {
+		return Surface{}, 0, fmt.Errorf("triangles: %v", err)
+	}
+	for index, tri := range triangles {
+		for _, v := range [...]int32{tri.A, tri.B, tri.C} {
+			if v < 0 || v >= h.NumVerts {
+				return Surface{}, 0, fmt.Errorf("triangle %d refers to vertex %d of %d", index, v, h.NumVerts)
+			}
+		}
+	}
+	surf.Triangles = triangles
+
+	refs, err := binread.ReadSlice[int32](data, ofs+int64(h.OfsBoneReferences), int64(h.NumBoneReferences), 4)
+	if err != nil {
+		return Surface{}, 0, fmt.Errorf("bone references: %v", err)
+	}
+	for _, ref := range refs {
+		surf.BoneRefs = append(surf.BoneRefs, int(ref))
+	}
+
+	return surf, ofs + int64(h.OfsEnd), nil
+}
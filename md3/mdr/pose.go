@@ -0,0 +1,63 @@
+package mdr
+
+import "github.com/nilium/go-md3/md3"
+
+// LerpBones interpolates the model's bones between frameA and frameB by t,
+// where t is 0 for frameA and 1 for frameB. As in ioquake3, each element of
+// the bones' matrices is interpolated linearly, which is exact at either
+// frame and close enough between frames that are near each other.
+//
+// The bones are written to dst, which is grown if it isn't large enough to
+// hold them, and the resulting slice is returned.
+func (m *Model) LerpBones(dst []Bone, frameA, frameB int, t float32) []Bone {
+	if cap(dst) < m.NumBones {
+		dst = make([]Bone, m.NumBones)
+	}
+	dst = dst[:m.NumBones]
+
+	a, b := m.Frames[frameA].Bones, m.Frames[frameB].Bones
+	for index := range dst {
+		for k := range dst[index] {
+			dst[index][k] = a[index][k] + (b[index][k]-a[index][k])*t
+		}
+	}
+
+	return dst
+}
+
+// Skin returns the surface's vertices posed by the given bones, as returned
+// by LerpBones or taken from a frame. Each vertex's position is the sum of
+// its weights' offsets transformed by their bones and scaled by their
+// weights, and its normal is transformed the same way, without translation,
+// then renormalized.
+//
+// The vertices are written to dst, which is grown if it isn't large enough
+// to hold them, and the resulting slice is returned.
+func (s *Surface) Skin(dst []md3.Vertex, bones []Bone) []md3.Vertex {
+	if cap(dst) < len(s.Vertices) {
+		dst = make([]md3.Vertex, len(s.Vertices))
+	}
+	dst = dst[:len(s.Vertices)]
+
+	for index, v := range s.Vertices {
+		var origin, normal md3.Vec3
+		for _, w := range v.Weights {
+			bone := md3.TagFrameFromMatrix3x4(bones[w.Bone])
+			origin = origin.Add(bone.Transform(w.Offset).Scale(w.Weight))
+			normal = normal.Add(bone.Rotate(v.Normal).Scale(w.Weight))
+		}
+
+		if normal.Dot(normal) == 0 {
+			normal = v.Normal
+		}
+		dst[index] = md3.Vertex{Origin: origin, Normal: normal.Normalize()}
+	}
+
+	return dst
+}
+
+// Frame returns the tag's transform in model space for the given bones, as
+// returned by LerpBones or taken from a frame.
+func (t Tag) Frame(bones []Bone) md3.TagFrame {
+	return md3.TagFrameFromMatrix3x4(bones[t.Bone])
+}
@@ -1,5 +1,10 @@
 package md3
 
+import (
+	"iter"
+	"slices"
+)
+
 type Frame struct {
 	name   string
 	min    Vec3
@@ -52,15 +57,17 @@ func (t *Tag) Frame(frame int) TagFrame {
 	return t.frames[frame]
 }
 
+// AllFrames returns an iterator over the tag's frames and their indices.
+func (t *Tag) AllFrames() iter.Seq2[int, TagFrame] {
+	return slices.All(t.frames)
+}
+
+// Frames returns a channel yielding each of the tag's frames.
+//
+// Deprecated: Use AllFrames. The goroutine feeding the returned channel
+// leaks if the caller stops receiving before the channel is closed.
 func (t *Tag) Frames() <-chan TagFrame {
-	output := make(chan TagFrame)
-	go func(t *Tag, output chan<- TagFrame) {
-		for _, frame := range t.frames {
-			output <- frame
-		}
-		close(output)
-	}(t, output)
-	return output
+	return chanOf(t.AllFrames())
 }
 
 type Triangle struct {
@@ -116,60 +123,73 @@ func (s *Surface) Triangle(index int) Triangle {
 	return s.triangles[index]
 }
 
+// AllTriangles returns an iterator over the surface's triangles and their
+// indices.
+func (s *Surface) AllTriangles() iter.Seq2[int, Triangle] {
+	return slices.All(s.triangles)
+}
+
+// Triangles returns a channel yielding each of the surface's triangles.
+//
+// Deprecated: Use AllTriangles. The goroutine feeding the returned channel
+// leaks if the caller stops receiving before the channel is closed.
 func (s *Surface) Triangles() <-chan Triangle {
-	output := make(chan Triangle)
-	go func(s *Surface, output chan<- Triangle) {
-		for _, tri := range s.triangles {
-			output <- tri
-		}
-		close(output)
-	}(s, output)
-	return output
+	return chanOf(s.AllTriangles())
 }
 
 func (s *Surface) Vertex(frame, index int) Vertex {
 	return s.vertices[frame][index]
 }
 
+// AllVertices returns an iterator over the surface's vertices for the given
+// frame and their indices.
+func (s *Surface) AllVertices(frame int) iter.Seq2[int, Vertex] {
+	return slices.All(s.vertices[frame])
+}
+
+// Vertices returns a channel yielding each of the surface's vertices for the
+// given frame.
+//
+// Deprecated: Use AllVertices. The goroutine feeding the returned channel
+// leaks if the caller stops receiving before the channel is closed.
 func (s *Surface) Vertices(frame int) <-chan Vertex {
-	output := make(chan Vertex)
-	go func(s *Surface, output chan<- Vertex) {
-		for _, vert := range s.vertices[frame] {
-			output <- vert
-		}
-		close(output)
-	}(s, output)
-	return output
+	return chanOf(s.AllVertices(frame))
 }
 
 func (s *Surface) TexCoord(index int) TexCoord {
 	return s.texcoords[index]
 }
 
+// AllTexCoords returns an iterator over the surface's texcoords and their
+// indices.
+func (s *Surface) AllTexCoords() iter.Seq2[int, TexCoord] {
+	return slices.All(s.texcoords)
+}
+
+// TexCoords returns a channel yielding each of the surface's texcoords.
+//
+// Deprecated: Use AllTexCoords. The goroutine feeding the returned channel
+// leaks if the caller stops receiving before the channel is closed.
 func (s *Surface) TexCoords() <-chan TexCoord {
-	output := make(chan TexCoord)
-	go func(s *Surface, output chan<- TexCoord) {
-		for _, texcoord := range s.texcoords {
-			output <- texcoord
-		}
-		close(output)
-	}(s, output)
-	return output
+	return chanOf(s.AllTexCoords())
 }
 
 func (s *Surface) Shader(index int) Shader {
 	return s.shaders[index]
 }
 
+// AllShaders returns an iterator over the surface's shaders and their
+// indices.
+func (s *Surface) AllShaders() iter.Seq2[int, Shader] {
+	return slices.All(s.shaders)
+}
+
+// Shaders returns a channel yielding each of the surface's shaders.
+//
+// Deprecated: Use AllShaders. The goroutine feeding the returned channel
+// leaks if the caller stops receiving before the channel is closed.
 func (s *Surface) Shaders() <-chan Shader {
-	output := make(chan Shader)
-	go func(s *Surface, output chan<- Shader) {
-		for _, shader := range s.shaders {
-			output <- shader
-		}
-		close(output)
-	}(s, output)
-	return output
+	return chanOf(s.AllShaders())
 }
 
 type Model struct {
@@ -207,35 +227,66 @@ func (m *Model) Tag(index int) *Tag {
 	return m.tags[index]
 }
 
-func (m *Model) Surfaces() <-chan *Surface {
-	output := make(chan *Surface)
-	go func(m *Model, output chan<- *Surface) {
-		for _, surface := range m.surfaces {
-			output <- surface
+// TagByName returns the model's tag with the given name, or nil if it has no
+// such tag.
+func (m *Model) TagByName(name string) *Tag {
+	for _, tag := range m.tags {
+		if tag.name == name {
+			return tag
 		}
-		close(output)
-	}(m, output)
-	return output
+	}
+	return nil
+}
+
+// AllSurfaces returns an iterator over the model's surfaces and their indices.
+func (m *Model) AllSurfaces() iter.Seq2[int, *Surface] {
+	return slices.All(m.surfaces)
 }
 
+// Surfaces returns a channel yielding each of the model's surfaces.
+//
+// Deprecated: Use AllSurfaces. The goroutine feeding the returned channel leaks
+// if the caller stops receiving before the channel is closed.
+func (m *Model) Surfaces() <-chan *Surface {
+	return chanOf(m.AllSurfaces())
+}
+
+// AllFrames returns an iterator over the model's frames and their indices.
+func (m *Model) AllFrames() iter.Seq2[int, *Frame] {
+	return slices.All(m.frames)
+}
+
+// Frames returns a channel yielding each of the model's frames.
+//
+// Deprecated: Use AllFrames. The goroutine feeding the returned channel leaks
+// if the caller stops receiving before the channel is closed.
 func (m *Model) Frames() <-chan *Frame {
-	output := make(chan *Frame)
-	go func(m *Model, output chan<- *Frame) {
-		for _, frame := range m.frames {
-			output <- frame
-		}
-		close(output)
-	}(m, output)
-	return output
+	return chanOf(m.AllFrames())
+}
+
+// AllTags returns an iterator over the model's tags and their indices.
+func (m *Model) AllTags() iter.Seq2[int, *Tag] {
+	return slices.All(m.tags)
 }
 
+// Tags returns a channel yielding each of the model's tags.
+//
+// Deprecated: Use AllTags. The goroutine feeding the returned channel leaks
+// if the caller stops receiving before the channel is closed.
 func (m *Model) Tags() <-chan *Tag {
-	output := make(chan *Tag)
-	go func(m *Model, output chan<- *Tag) {
-		for _, tag := range m.tags {
-			output <- tag
+	return chanOf(m.AllTags())
+}
+
+// chanOf returns a channel yielding each value of seq, fed by a new
+// goroutine. It exists only to support the deprecated channel-based
+// iteration methods.
+func chanOf[T any](seq iter.Seq2[int, T]) <-chan T {
+	output := make(chan T)
+	go func(output chan<- T) {
+		for _, item := range seq {
+			output <- item
 		}
 		close(output)
-	}(m, output)
+	}(output)
 	return output
 }
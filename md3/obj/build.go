@@ -0,0 +1,208 @@
+package obj
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// Options control how OBJ geometry is converted to MD3's axes and texture
+// space. They mirror the go-md3 tool's OBJ export options, so files it
+// exports are read back with the same settings.
+type Options struct {
+	// SwapYZ swaps the Y and Z axes of positions and normals. Since that
+	// mirrors every face, their winding is kept as-is; otherwise faces are
+	// reversed to MD3's clockwise winding.
+	SwapYZ bool
+	// FlipUVs flips texcoords vertically, as (1 - T).
+	FlipUVs bool
+}
+
+// Build returns a model with the given name whose frames are the given OBJ
+// files, in order.
+//
+// The first file defines the model's surfaces: each of its groups becomes a
+// surface, named after the group, whose only shader is the group's material.
+// Face corners with the same position, texcoord and normal share a vertex;
+// corners differing in any of them are split into separate vertices, and
+// vertices are ordered by the indices of their positions, texcoords and
+// normals. Faces with more than three corners are split into triangle fans.
+//
+// Every other file must have the same groups, faces and corners, in the same
+// order, as is the case for frames exported together. Only their positions
+// and normals are used, so vertices keep the order and texcoords of the
+// first file. Corners without normals are given the average of the normals
+// of the faces sharing their position.
+//
+// Each frame's bounds and radius are computed from its vertices, with its
+// origin at the model's origin, as the Quake 3 tools do.
+func Build(name string, frames []*File, opts Options) (*md3.Model, error) {
+	if len(frames) == 0 {
+		return nil, errors.New("obj: no frames to build")
+	}
+
+	b := md3.NewModelBuilder(name)
+	base := frames[0]
+
+	// corners holds, for each surface, the corner of the first file defining
+	// each of its vertices, as a face index and a corner index.
+	corners := make([][][2]int, len(base.Groups))
+	used := make(map[string]bool)
+
+	for groupIndex, group := range base.Groups {
+		surfName := group.Name
+		for n := 1; used[surfName]; n++ {
+			surfName = fmt.Sprintf("%s_%d", group.Name, n)
+		}
+		used[surfName] = true
+
+		sb := b.AddSurface(surfName)
+		if group.Material != "" {
+			sb.AddShader(group.Material)
+		}
+
+		// Vertices are numbered in the order of their positions, texcoords
+		// and normals in the file, so a file written from an MD3 model
+		// keeps its vertex order regardless of the winding of its faces.
+		first := make(map[Corner][2]int)
+		for faceIndex, face := range group.Faces {
+			for cornerIndex, corner := range face {
+				if _, ok := first[corner]; !ok {
+					first[corner] = [2]int{faceIndex, cornerIndex}
+				}
+			}
+		}
+
+		unique := slices.SortedFunc(maps.Keys(first), func(a, b Corner) int {
+			return cmp.Or(cmp.Compare(a.V, b.V), cmp.Compare(a.T, b.T), cmp.Compare(a.N, b.N))
+		})
+
+		vertices := make(map[Corner]int32, len(unique))
+		texcoords := make([]md3.TexCoord, len(unique))
+		for index, corner := range unique {
+			vertices[corner] = int32(index)
+			corners[groupIndex] = append(corners[groupIndex], first[corner])
+			texcoords[index] = base.texCoord(corner, opts)
+		}
+
+		for _, face := range group.Faces {
+			for k := 1; k+1 < len(face); k++ {
+				v0, v1, v2 := vertices[face[0]], vertices[face[k]], vertices[face[k+1]]
+				if opts.SwapYZ {
+					sb.AddTriangle(v0, v1, v2)
+				} else {
+					sb.AddTriangle(v2, v1, v0)
+				}
+			}
+		}
+		sb.SetTexCoords(texcoords)
+	}
+
+	for frameIndex, file := range frames {
+		if err := checkFrame(base, file); err != nil {
+			return nil, fmt.Errorf("obj: frame %d: %v", frameIndex, err)
+		}
+
+		b.AddFrame("", md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+
+		var smooth []md3.Vec3
+		for groupIndex, group := range file.Groups {
+			vertices := make([]md3.Vertex, len(corners[groupIndex]))
+			for index, def := range corners[groupIndex] {
+				corner := group.Faces[def[0]][def[1]]
+
+				var normal md3.Vec3
+				if corner.N >= 0 {
+					normal = file.Normals[corner.N]
+				} else {
+					if smooth == nil {
+						smooth = file.smoothNormals()
+					}
+					normal = smooth[corner.V]
+				}
+
+				vertices[index] = md3.Vertex{
+					Origin: convertVec3(file.Positions[corner.V], opts),
+					Normal: convertVec3(normal, opts).Normalize(),
+				}
+			}
+			b.Surface(groupIndex).AddVertexFrame(vertices)
+		}
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
+
+// checkFrame returns an error if the groups, faces and corners of file don't
+// match those of base.
+func checkFrame(base, file *File) error {
+	if len(file.Groups) != len(base.Groups) {
+		return fmt.Errorf("has %d groups, expected %d", len(file.Groups), len(base.Groups))
+	}
+
+	for groupIndex, group := range file.Groups {
+		baseGroup := base.Groups[groupIndex]
+		if len(group.Faces) != len(baseGroup.Faces) {
+			return fmt.Errorf("group %q has %d faces, expected %d", baseGroup.Name, len(group.Faces), len(baseGroup.Faces))
+		}
+
+		for faceIndex, face := range group.Faces {
+			if len(face) != len(baseGroup.Faces[faceIndex]) {
+				return fmt.Errorf("face %d of group %q has %d corners, expected %d",
+					faceIndex, baseGroup.Name, len(face), len(baseGroup.Faces[faceIndex]))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *File) texCoord(corner Corner, opts Options) md3.TexCoord {
+	var tc md3.TexCoord
+	if corner.T >= 0 {
+		tc = f.TexCoords[corner.T]
+	}
+	if opts.FlipUVs {
+		tc.T = 1 - tc.T
+	}
+	return tc
+}
+
+// smoothNormals returns a normal for each of the file's positions: the
+// average of the normals of the faces using it, weighted by their area. Faces
+// are assumed to be wound counter-clockwise, as OBJ files are.
+func (f *File) smoothNormals() []md3.Vec3 {
+	normals := make([]md3.Vec3, len(f.Positions))
+	for _, group := range f.Groups {
+		for _, face := range group.Faces {
+			origin := f.Positions[face[0].V]
+			for k := 1; k+1 < len(face); k++ {
+				a := f.Positions[face[k].V].Sub(origin)
+				b := f.Positions[face[k+1].V].Sub(origin)
+				n := a.Cross(b)
+				for _, corner := range [...]Corner{face[0], face[k], face[k+1]} {
+					normals[corner.V] = normals[corner.V].Add(n)
+				}
+			}
+		}
+	}
+
+	for index, n := range normals {
+		if n.Len() == 0 {
+			normals[index] = md3.Vec3{Z: 1}
+		}
+	}
+	return normals
+}
+
+func convertVec3(v md3.Vec3, opts Options) md3.Vec3 {
+	if opts.SwapYZ {
+		v.Y, v.Z = v.Z, v.Y
+	}
+	return v
+}
@@ -0,0 +1,217 @@
+// Package obj reads Wavefront OBJ files and builds MD3 models from them, one
+// OBJ file per frame.
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// Corner is a single corner of a face: the indices of its position, texcoord
+// and normal in the file, counting from zero. Texcoord and normal indices are
+// -1 if the corner doesn't have one.
+type Corner struct {
+	V, T, N int
+}
+
+// Face is a polygon with at least three corners.
+type Face []Corner
+
+// Group is a run of faces sharing a group name and material. A group that
+// switches materials partway through is split into one Group per material.
+type Group struct {
+	Name     string
+	Material string
+	Faces    []Face
+}
+
+// File is the geometry of an OBJ file.
+type File struct {
+	Positions []md3.Vec3
+	TexCoords []md3.TexCoord
+	Normals   []md3.Vec3
+	Groups    []*Group
+}
+
+// Parse reads an OBJ file from r. Only polygonal geometry is read: v, vt, vn
+// and f statements, along with the g and usemtl statements that split faces
+// into groups. Other statements, such as o, s and mtllib, are ignored.
+// Negative indices, relative to the end of the lists read so far, are
+// resolved as they're read.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	var (
+		group    *Group
+		name     = "default"
+		material string
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if index := strings.IndexByte(line, '#'); index != -1 {
+			line = line[:index]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch args := fields[1:]; fields[0] {
+		case "v":
+			var v md3.Vec3
+			if v, err = parseVec3(args); err == nil {
+				f.Positions = append(f.Positions, v)
+			}
+		case "vn":
+			var v md3.Vec3
+			if v, err = parseVec3(args); err == nil {
+				f.Normals = append(f.Normals, v)
+			}
+		case "vt":
+			var tc md3.TexCoord
+			if tc, err = parseTexCoord(args); err == nil {
+				f.TexCoords = append(f.TexCoords, tc)
+			}
+		case "g":
+			name = "default"
+			if len(args) > 0 {
+				name = strings.Join(args, " ")
+			}
+			group = nil
+		case "usemtl":
+			material = strings.Join(args, " ")
+			group = nil
+		case "f":
+			var face Face
+			if face, err = f.parseFace(args); err == nil {
+				if group == nil {
+					group = f.group(name, material)
+				}
+				group.Faces = append(group.Faces, face)
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("obj: line %d: %v", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// group returns the group with the given name and material, adding it if
+// it doesn't exist. Faces that return to a group after others are appended
+// to it, keeping each group's faces together.
+func (f *File) group(name, material string) *Group {
+	for _, g := range f.Groups {
+		if g.Name == name && g.Material == material {
+			return g
+		}
+	}
+	g := &Group{Name: name, Material: material}
+	f.Groups = append(f.Groups, g)
+	return g
+}
+
+func parseFloats(args []string, min, max int) ([]float32, error) {
+	if len(args) < min || len(args) > max {
+		return nil, fmt.Errorf("expected %d to %d numbers, got %d", min, max, len(args))
+	}
+
+	values := make([]float32, len(args))
+	for index, arg := range args {
+		value, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		values[index] = float32(value)
+	}
+	return values, nil
+}
+
+func parseVec3(args []string) (md3.Vec3, error) {
+	// Positions may carry a fourth w component or, in some exporters'
+	// output, a vertex color; either is ignored.
+	values, err := parseFloats(args, 3, 6)
+	if err != nil {
+		return md3.Vec3{}, err
+	}
+	return md3.Vec3{X: values[0], Y: values[1], Z: values[2]}, nil
+}
+
+func parseTexCoord(args []string) (md3.TexCoord, error) {
+	values, err := parseFloats(args, 1, 3)
+	if err != nil {
+		return md3.TexCoord{}, err
+	}
+	tc := md3.TexCoord{S: values[0]}
+	if len(values) > 1 {
+		tc.T = values[1]
+	}
+	return tc, nil
+}
+
+func (f *File) parseFace(args []string) (Face, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("face has %d corners, expected at least 3", len(args))
+	}
+
+	face := make(Face, len(args))
+	for index, arg := range args {
+		parts := strings.Split(arg, "/")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid face corner %q", arg)
+		}
+
+		corner := Corner{T: -1, N: -1}
+		var err error
+		if corner.V, err = resolveIndex(parts[0], len(f.Positions)); err != nil {
+			return nil, err
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			if corner.T, err = resolveIndex(parts[1], len(f.TexCoords)); err != nil {
+				return nil, err
+			}
+		}
+		if len(parts) > 2 && parts[2] != "" {
+			if corner.N, err = resolveIndex(parts[2], len(f.Normals)); err != nil {
+				return nil, err
+			}
+		}
+		face[index] = corner
+	}
+
+	return face, nil
+}
+
+// resolveIndex converts a one-based or negative OBJ index into a list of
+// length n to a zero-based index.
+func resolveIndex(s string, n int) (int, error) {
+	index, err := strconv.Atoi(s)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("invalid index %q", s)
+	case index < 0:
+		index += n
+	default:
+		index--
+	}
+
+	if index < 0 || index >= n {
+		return 0, fmt.Errorf("index %s is out of range: %d defined", s, n)
+	}
+	return index, nil
+}
@@ -0,0 +1,355 @@
+// Package pk3 provides a read-only fs.FS over Quake 3 game directories and
+// their pk3 (zip) archives, resolving files the way the engine's virtual
+// filesystem does.
+package pk3
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only filesystem overlaying any number of directories and pk3
+// archives. Paths are resolved without regard to case. Where more than one
+// source holds a file, the source added last takes precedence, and the
+// listing of a directory merges the contents of every source.
+//
+// FS implements fs.FS, fs.ReadDirFS and fs.StatFS, so it can be used with
+// fs.ReadFile, fs.Glob, fs.WalkDir and the like.
+type FS struct {
+	files   map[string]*entry
+	dirs    map[string]map[string]*entry
+	closers []io.Closer
+}
+
+// entry is a file or directory in the filesystem.
+type entry struct {
+	// name is the entry's path, using the case of the source it came from.
+	name string
+	info fs.FileInfo
+	open func() (fs.File, error)
+}
+
+// New returns an empty FS.
+func New() *FS {
+	f := &FS{
+		files: make(map[string]*entry),
+		dirs:  make(map[string]map[string]*entry),
+	}
+	f.dirs["."] = make(map[string]*entry)
+	return f
+}
+
+// OpenGameDir returns an FS over the game directory dir, such as baseq3. See
+// AddGameDir.
+func OpenGameDir(dir string) (*FS, error) {
+	f := New()
+	if err := f.AddGameDir(dir); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenArchive returns an FS over the single pk3 archive at the given path.
+func OpenArchive(name string) (*FS, error) {
+	f := New()
+	if err := f.AddArchive(name); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// AddGameDir adds a game directory to the filesystem as Quake 3 does: every
+// pk3 archive in the directory is added in alphabetical order, so that files
+// in later archives override those in earlier ones, and the files of the
+// directory itself are added last, overriding all of its archives. The
+// archives themselves aren't added as files. Calling
+// AddGameDir for a mod's directory after baseq3's lets the mod override the
+// base game.
+func (f *FS) AddGameDir(dir string) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var archives []string
+	for _, de := range dirEntries {
+		if !de.IsDir() && strings.EqualFold(filepath.Ext(de.Name()), ".pk3") {
+			archives = append(archives, de.Name())
+		}
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return strings.ToLower(archives[i]) < strings.ToLower(archives[j])
+	})
+
+	for _, name := range archives {
+		if err := f.AddArchive(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	return f.addDir(dir, true)
+}
+
+// AddArchive adds the contents of the pk3 archive at the given path to the
+// filesystem. The archive remains open until the FS is closed.
+func (f *FS) AddArchive(name string) error {
+	rc, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	f.closers = append(f.closers, rc)
+	f.addZip(&rc.Reader)
+	return nil
+}
+
+// AddArchiveReader adds the contents of a pk3 archive of the given size read
+// from r to the filesystem.
+func (f *FS) AddArchiveReader(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	f.addZip(zr)
+	return nil
+}
+
+func (f *FS) addZip(zr *zip.Reader) {
+	for _, zf := range zr.File {
+		name := cleanName(zf.Name)
+		if name == "" || strings.HasSuffix(zf.Name, "/") {
+			continue
+		}
+
+		zf := zf
+		f.addFile(&entry{
+			name: name,
+			info: zf.FileInfo(),
+			open: func() (fs.File, error) {
+				rc, err := zf.Open()
+				if err != nil {
+					return nil, err
+				}
+				return &file{rc, zf.FileInfo()}, nil
+			},
+		})
+	}
+}
+
+// AddDir adds the files under the directory dir to the filesystem.
+func (f *FS) AddDir(dir string) error {
+	return f.addDir(dir, false)
+}
+
+// addDir adds the files under the directory dir to the filesystem, skipping
+// the pk3 archives directly within it if skipArchives is true.
+func (f *FS) addDir(dir string, skipArchives bool) error {
+	return filepath.WalkDir(dir, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if skipArchives && rel == de.Name() && strings.EqualFold(filepath.Ext(rel), ".pk3") {
+			return nil
+		}
+
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+
+		f.addFile(&entry{
+			name: cleanName(filepath.ToSlash(rel)),
+			info: info,
+			open: func() (fs.File, error) {
+				return os.Open(p)
+			},
+		})
+		return nil
+	})
+}
+
+// cleanName normalizes a path from a directory or archive, returning the
+// empty string if it isn't a valid fs.FS path.
+func cleanName(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, `\`, "/"))[1:]
+	if !fs.ValidPath(name) || name == "." {
+		return ""
+	}
+	return name
+}
+
+func (f *FS) addFile(e *entry) {
+	key := strings.ToLower(e.name)
+	f.files[key] = e
+	f.addChild(key, e)
+}
+
+// addChild registers e, whose lowercased path is key, with its parent
+// directory, creating the parent and its own ancestors as needed.
+func (f *FS) addChild(key string, e *entry) {
+	parentKey := path.Dir(key)
+	children, ok := f.dirs[parentKey]
+	if !ok {
+		children = make(map[string]*entry)
+		f.dirs[parentKey] = children
+		f.addChild(parentKey, f.dirEntry(path.Dir(e.name)))
+	}
+	children[path.Base(key)] = e
+}
+
+// dirEntry returns an entry for the directory at the given path.
+func (f *FS) dirEntry(name string) *entry {
+	return &entry{
+		name: name,
+		info: dirInfo(path.Base(name)),
+		open: func() (fs.File, error) {
+			return f.openDir(name)
+		},
+	}
+}
+
+// Close closes every archive added to the filesystem.
+func (f *FS) Close() error {
+	var errs []error
+	for _, c := range f.closers {
+		errs = append(errs, c.Close())
+	}
+	f.closers = nil
+	return errors.Join(errs...)
+}
+
+func (f *FS) lookup(op, name string) (*entry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	key := strings.ToLower(name)
+	if e, ok := f.files[key]; ok {
+		return e, nil
+	}
+	if _, ok := f.dirs[key]; ok {
+		if key == "." {
+			return f.dirEntry("."), nil
+		}
+		return f.dirs[path.Dir(key)][path.Base(key)], nil
+	}
+	return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// Open opens the named file or directory.
+func (f *FS) Open(name string) (fs.File, error) {
+	e, err := f.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return e.open()
+}
+
+// Stat returns information about the named file or directory.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	e, err := f.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e.info, nil
+}
+
+// ReadDir returns the merged listing of the named directory, sorted by name.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := f.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.readDir(name), nil
+}
+
+func (f *FS) readDir(name string) []fs.DirEntry {
+	children := f.dirs[strings.ToLower(name)]
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, child := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(child.info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+func (f *FS) openDir(name string) (fs.File, error) {
+	return &dir{info: dirInfo(path.Base(name)), entries: f.readDir(name)}, nil
+}
+
+// file is a file opened from an archive.
+type file struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// dir is an open directory listing.
+type dir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	d.offset += n
+	return remaining[:n], nil
+}
+
+// dirInfo describes a directory synthesized from the paths of the files in
+// it.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,358 @@
+// Package player assembles Quake 3 player models from their legs, torso and
+// head models, which are linked to one another by tags.
+package player
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/anim"
+	"github.com/nilium/go-md3/md3/skin"
+)
+
+// Names of the tags linking the parts of a player together.
+const (
+	TagTorso  = "tag_torso"
+	TagHead   = "tag_head"
+	TagWeapon = "tag_weapon"
+)
+
+// File names of a player's parts within its directory.
+const (
+	LegsFile      = "lower.md3"
+	TorsoFile     = "upper.md3"
+	HeadFile      = "head.md3"
+	AnimationFile = "animation.cfg"
+)
+
+// Part identifies one of the models making up a player.
+type Part int
+
+const (
+	Legs Part = iota
+	Torso
+	Head
+	Weapon
+
+	NumParts
+)
+
+var partNames = [NumParts]string{"legs", "torso", "head", "weapon"}
+
+func (p Part) String() string {
+	if p < 0 || p >= NumParts {
+		return fmt.Sprintf("Part(%d)", int(p))
+	}
+	return partNames[p]
+}
+
+// Player is a character assembled from several models. The torso is attached
+// to the legs' tag_torso, and the head and weapon to the torso's tag_head and
+// tag_weapon respectively.
+type Player struct {
+	Legs  *md3.Model
+	Torso *md3.Model
+	Head  *md3.Model
+	// Weapon is optional and may be nil.
+	Weapon *md3.Model
+	// Anim holds the player's animations, if it has an animation.cfg file,
+	// and is otherwise nil.
+	Anim *anim.Config
+}
+
+// Load reads the player in the directory dir. See LoadFS.
+func Load(dir string) (*Player, error) {
+	return LoadFS(os.DirFS(dir), ".")
+}
+
+// LoadFS reads the legs, torso and head models of the player in the
+// directory dir of fsys, along with its animation.cfg file if there is one.
+// The player's weapon is left unset.
+func LoadFS(fsys fs.FS, dir string) (*Player, error) {
+	var (
+		p   = new(Player)
+		err error
+	)
+
+	parts := []struct {
+		model **md3.Model
+		name  string
+	}{
+		{&p.Legs, LegsFile},
+		{&p.Torso, TorsoFile},
+		{&p.Head, HeadFile},
+	}
+
+	for _, part := range parts {
+		*part.model, err = readModel(fsys, path.Join(dir, part.name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := fsys.Open(path.Join(dir, AnimationFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return p, nil
+	case err != nil:
+		return nil, err
+	}
+	defer file.Close()
+
+	if p.Anim, err = anim.Parse(file); err != nil {
+		return nil, fmt.Errorf("player: %s: %w", path.Join(dir, AnimationFile), err)
+	}
+
+	return p, nil
+}
+
+func readModel(fsys fs.FS, name string) (*md3.Model, error) {
+	model, err := md3.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("player: %s: %w", name, err)
+	}
+	return model, nil
+}
+
+// Model returns the model for the given part, which may be nil.
+func (p *Player) Model(part Part) *md3.Model {
+	switch part {
+	case Legs:
+		return p.Legs
+	case Torso:
+		return p.Torso
+	case Head:
+		return p.Head
+	case Weapon:
+		return p.Weapon
+	}
+	return nil
+}
+
+// Pose is a pair of interpolated frames of the player's legs and torso.
+type Pose struct {
+	LegsFrameA, LegsFrameB   int
+	LegsLerp                 float32
+	TorsoFrameA, TorsoFrameB int
+	TorsoLerp                float32
+}
+
+// FramePose returns the pose with the legs and torso at the given frames.
+func FramePose(legsFrame, torsoFrame int) Pose {
+	return Pose{
+		LegsFrameA:  legsFrame,
+		LegsFrameB:  legsFrame,
+		TorsoFrameA: torsoFrame,
+		TorsoFrameB: torsoFrame,
+	}
+}
+
+// AnimPose returns the pose of the player's legs and torso at time t into the
+// given animations. The player must have an animation.cfg.
+func (p *Player) AnimPose(legs, torso anim.Index, t time.Duration) Pose {
+	var pose Pose
+	pose.LegsFrameA, pose.LegsFrameB, pose.LegsLerp = p.Anim.FramesAt(legs, t)
+	pose.TorsoFrameA, pose.TorsoFrameB, pose.TorsoLerp = p.Anim.FramesAt(torso, t)
+	return pose
+}
+
+// Transforms returns the transform of each of the player's parts in the given
+// pose, indexed by Part. The legs are placed at the origin. If the player has
+// no weapon, its transform is the identity.
+func (p *Player) Transforms(pose Pose) ([NumParts]md3.TagFrame, error) {
+	var xf [NumParts]md3.TagFrame
+
+	tagTorso, err := lerpTag(p.Legs, TagTorso, pose.LegsFrameA, pose.LegsFrameB, pose.LegsLerp)
+	if err != nil {
+		return xf, err
+	}
+
+	tagHead, err := lerpTag(p.Torso, TagHead, pose.TorsoFrameA, pose.TorsoFrameB, pose.TorsoLerp)
+	if err != nil {
+		return xf, err
+	}
+
+	xf[Legs] = md3.IdentityTagFrame()
+	xf[Torso] = xf[Legs].Compose(tagTorso)
+	xf[Head] = xf[Torso].Compose(tagHead)
+	xf[Weapon] = md3.IdentityTagFrame()
+
+	if p.Weapon != nil {
+		tagWeapon, err := lerpTag(p.Torso, TagWeapon, pose.TorsoFrameA, pose.TorsoFrameB, pose.TorsoLerp)
+		if err != nil {
+			return xf, err
+		}
+		xf[Weapon] = xf[Torso].Compose(tagWeapon)
+	}
+
+	return xf, nil
+}
+
+func lerpTag(model *md3.Model, name string, frameA, frameB int, frac float32) (md3.TagFrame, error) {
+	tag := model.TagByName(name)
+	if tag == nil {
+		return md3.TagFrame{}, fmt.Errorf("player: model %q has no %s", model.Name(), name)
+	}
+	return tag.Lerp(frameA, frameB, frac), nil
+}
+
+// partFrames returns the pair of frames and interpolation fraction to use for
+// the given part in a pose. The head and weapon only use their first frame.
+func partFrames(part Part, pose Pose) (int, int, float32) {
+	switch part {
+	case Legs:
+		return pose.LegsFrameA, pose.LegsFrameB, pose.LegsLerp
+	case Torso:
+		return pose.TorsoFrameA, pose.TorsoFrameB, pose.TorsoLerp
+	}
+	return 0, 0, 0
+}
+
+// PosedSurface is a surface of one of a player's parts in a pose.
+type PosedSurface struct {
+	Part    Part
+	Surface *md3.Surface
+	// Vertices are the surface's vertices in the pose, in the legs' space.
+	Vertices []md3.Vertex
+}
+
+// Posed returns the surfaces of each of the player's parts, with their
+// vertices interpolated and transformed into the legs' space for the given
+// pose.
+func (p *Player) Posed(pose Pose) ([]PosedSurface, error) {
+	xf, err := p.Transforms(pose)
+	if err != nil {
+		return nil, err
+	}
+
+	var surfaces []PosedSurface
+	for part := Legs; part < NumParts; part++ {
+		model := p.Model(part)
+		if model == nil {
+			continue
+		}
+
+		frameA, frameB, frac := partFrames(part, pose)
+		for _, surf := range model.AllSurfaces() {
+			vertices := surf.LerpVertices(nil, frameA, frameB, frac)
+			for index, vert := range vertices {
+				vertices[index] = md3.Vertex{
+					Origin: xf[part].Transform(vert.Origin),
+					Normal: xf[part].Rotate(vert.Normal).Normalize(),
+				}
+			}
+			surfaces = append(surfaces, PosedSurface{part, surf, vertices})
+		}
+	}
+
+	return surfaces, nil
+}
+
+// Bake returns a single model holding every surface of the player, with one
+// frame for each of the given poses. The tags of each part are carried over,
+// transformed into the legs' space; where two parts have a tag of the same
+// name, only the first part's tag is kept, in the order of Part.
+func (p *Player) Bake(name string, poses ...Pose) (*md3.Model, error) {
+	b := md3.NewModelBuilder(name)
+	tags := make(map[string]bool)
+
+	var surfaces []*md3.SurfaceBuilder
+	for index, pose := range poses {
+		b.AddFrame(fmt.Sprintf("pose%d", index), md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+
+		posed, err := p.Posed(pose)
+		if err != nil {
+			return nil, err
+		}
+
+		if index == 0 {
+			for _, ps := range posed {
+				sb := b.AddSurface(ps.Surface.Name())
+				for _, shader := range ps.Surface.AllShaders() {
+					sb.AddShader(shader.Name)
+				}
+				texcoords := make([]md3.TexCoord, 0, ps.Surface.NumVertices())
+				for _, tc := range ps.Surface.AllTexCoords() {
+					texcoords = append(texcoords, tc)
+				}
+				sb.SetTexCoords(texcoords)
+				for _, tri := range ps.Surface.AllTriangles() {
+					sb.AddTriangle(tri.A, tri.B, tri.C)
+				}
+				surfaces = append(surfaces, sb)
+			}
+		}
+
+		for surfIndex, ps := range posed {
+			surfaces[surfIndex].AddVertexFrame(ps.Vertices)
+		}
+	}
+
+	for part := Legs; part < NumParts; part++ {
+		model := p.Model(part)
+		if model == nil {
+			continue
+		}
+
+		for _, tag := range model.AllTags() {
+			if tags[tag.Name()] {
+				continue
+			}
+			tags[tag.Name()] = true
+
+			frames := make([]md3.TagFrame, len(poses))
+			for index, pose := range poses {
+				xf, err := p.Transforms(pose)
+				if err != nil {
+					return nil, err
+				}
+				frameA, frameB, frac := partFrames(part, pose)
+				frames[index] = xf[part].Compose(tag.Lerp(frameA, frameB, frac))
+			}
+			b.AddTag(tag.Name(), frames...)
+		}
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
+
+// LoadSkin reads the player's skin with the given name, such as "default" or
+// "red", from the directory dir of fsys. The skins of each part, such as
+// lower_default.skin, upper_default.skin and head_default.skin, are merged
+// into one. Parts lacking a skin file are skipped.
+func LoadSkin(fsys fs.FS, dir, name string) (*skin.Skin, error) {
+	merged := skin.New()
+	found := false
+
+	for _, prefix := range [...]string{"lower", "upper", "head"} {
+		skinPath := path.Join(dir, prefix+"_"+name+".skin")
+		file, err := fsys.Open(skinPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		s, err := skin.Parse(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("player: %s: %w", skinPath, err)
+		}
+
+		merged.Merge(s)
+		found = true
+	}
+
+	if !found {
+		return nil, fmt.Errorf("player: no %q skin in %s: %w", name, dir, fs.ErrNotExist)
+	}
+
+	return merged, nil
+}
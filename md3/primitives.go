@@ -5,19 +5,14 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"log"
 	"math"
 )
 
 const md3XYZFixedScale float32 = 1.0 / 64.0
 
-type Vec3 struct {
-	X, Y, Z float32
-}
-
 func readU8(r io.Reader) (uint8, error) {
 	var b [1]byte
-	_, err := r.Read(b[:])
+	_, err := io.ReadFull(r, b[:])
 	return b[0], err
 }
 
@@ -27,7 +22,7 @@ func readS16(r io.Reader) (int16, error) {
 	var result int16
 	var b [2]byte
 
-	n, err = r.Read(b[:])
+	n, err = io.ReadFull(r, b[:])
 	if err != nil {
 		return result, err
 	} else if n != 2 {
@@ -35,9 +30,6 @@ func readS16(r io.Reader) (int16, error) {
 	}
 
 	err = binary.Read(bytes.NewReader(b[:]), binary.LittleEndian, &result)
-	if err != nil {
-		log.Println("binary.Read failed:", err)
-	}
 	return result, err
 }
 
@@ -47,7 +39,7 @@ func readS32(r io.Reader) (int32, error) {
 	var result int32
 	var b [4]byte
 
-	n, err = r.Read(b[:])
+	n, err = io.ReadFull(r, b[:])
 	if err != nil {
 		return result, err
 	} else if n != 4 {
@@ -55,9 +47,6 @@ func readS32(r io.Reader) (int32, error) {
 	}
 
 	err = binary.Read(bytes.NewReader(b[:]), binary.LittleEndian, &result)
-	if err != nil {
-		log.Println("binary.Read failed:", err)
-	}
 	return result, err
 }
 
@@ -67,7 +56,7 @@ func readF32(r io.Reader) (float32, error) {
 	var result float32
 	var b [4]byte
 
-	n, err = r.Read(b[:])
+	n, err = io.ReadFull(r, b[:])
 	if err != nil {
 		return result, err
 	} else if n != 4 {
@@ -75,9 +64,6 @@ func readF32(r io.Reader) (float32, error) {
 	}
 
 	err = binary.Read(bytes.NewReader(b[:]), binary.LittleEndian, &result)
-	if err != nil {
-		log.Println("binary.Read failed:", err)
-	}
 	return result, err
 }
 
@@ -119,35 +105,40 @@ func readF16Vec3(r io.Reader) (Vec3, error) {
 }
 
 func readSphereNormal(r io.Reader) (Vec3, error) {
-	var result Vec3
 	var zenith uint8
 	var azimuth uint8
 	var err error
 
 	zenith, err = readU8(r)
 	if err != nil {
-		return result, err
+		return Vec3{}, err
 	}
 
 	azimuth, err = readU8(r)
 	if err != nil {
-		return result, err
+		return Vec3{}, err
 	}
 
+	return SphereNormal(zenith, azimuth), nil
+}
+
+// SphereNormal returns the unit vector encoded by the zenith and azimuth
+// bytes of an MD3 vertex normal, as used by MD3 and related formats.
+func SphereNormal(zenith, azimuth uint8) Vec3 {
 	latitude := float64(zenith) * (math.Pi * 2.0) / 255.0
 	longitude := float64(azimuth) * (math.Pi * 2.0) / 255.0
 	latsin := math.Sin(latitude)
 
-	result.X = float32(math.Cos(longitude) * latsin)
-	result.Y = float32(math.Sin(longitude) * latsin)
-	result.Z = float32(math.Cos(latitude))
-
-	return result, nil
+	return Vec3{
+		X: float32(math.Cos(longitude) * latsin),
+		Y: float32(math.Sin(longitude) * latsin),
+		Z: float32(math.Cos(latitude)),
+	}
 }
 
 func readNulString(r io.Reader, maxLen int) (string, error) {
 	buf := make([]byte, maxLen)
-	n, err := r.Read(buf)
+	n, err := io.ReadFull(r, buf)
 	if err != nil {
 		return "", err
 	} else if n != maxLen {
@@ -163,7 +154,7 @@ func readNulString(r io.Reader, maxLen int) (string, error) {
 
 func readFixedString(r io.Reader, length int) (string, error) {
 	buf := make([]byte, length)
-	n, err := r.Read(buf)
+	n, err := io.ReadFull(r, buf)
 	if err != nil {
 		return "", err
 	} else if n != length {
@@ -172,3 +163,75 @@ func readFixedString(r io.Reader, length int) (string, error) {
 
 	return string(buf), nil
 }
+
+func writeS32(w io.Writer, v int32) error {
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+func writeF32(w io.Writer, v float32) error {
+	return binary.Write(w, binary.LittleEndian, v)
+}
+
+// writeF16 writes v as a fixed-point int16 with a scale of md3XYZFixedScale,
+// clamping it to the range of an int16.
+func writeF16(w io.Writer, v float32) error {
+	fixed := math.Floor(float64(v)/float64(md3XYZFixedScale) + 0.5)
+	fixed = math.Max(math.MinInt16, math.Min(math.MaxInt16, fixed))
+	return binary.Write(w, binary.LittleEndian, int16(fixed))
+}
+
+func writeF32Vec3(w io.Writer, v Vec3) error {
+	for _, f := range [...]float32{v.X, v.Y, v.Z} {
+		if err := writeF32(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeF16Vec3(w io.Writer, v Vec3) error {
+	for _, f := range [...]float32{v.X, v.Y, v.Z} {
+		if err := writeF16(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSphereNormal writes the unit vector n as the zenith and azimuth bytes
+// read by readSphereNormal.
+func writeSphereNormal(w io.Writer, n Vec3) error {
+	const anglesToBytes = 255.0 / (math.Pi * 2.0)
+
+	z := math.Max(-1, math.Min(1, float64(n.Z)))
+	zenith := math.Acos(z) * anglesToBytes
+	azimuth := math.Atan2(float64(n.Y), float64(n.X)) * anglesToBytes
+	if azimuth < 0 {
+		azimuth += 255
+	}
+
+	b := [2]byte{
+		uint8(int(math.Floor(zenith+0.5)) % 255),
+		uint8(int(math.Floor(azimuth+0.5)) % 255),
+	}
+	_, err := w.Write(b[:])
+	return err
+}
+
+// writeNulString writes s as a NUL-padded string of exactly maxLen bytes. s
+// must be shorter than maxLen so that it is always NUL-terminated.
+func writeNulString(w io.Writer, s string, maxLen int) error {
+	if len(s) >= maxLen {
+		return fmt.Errorf("String %q is too long: must be shorter than %d bytes", s, maxLen)
+	}
+
+	buf := make([]byte, maxLen)
+	copy(buf, s)
+	_, err := w.Write(buf)
+	return err
+}
+
+func writeFixedString(w io.Writer, s string) error {
+	_, err := io.WriteString(w, s)
+	return err
+}
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
 )
 
 const (
@@ -14,7 +14,15 @@ const (
 	md3HeaderIdent  = "IDP3"
 	md3SurfaceIdent = md3HeaderIdent
 	md3MaxVersion   = 15
-	md3VertexSize   = 8
+
+	md3HeaderSize        = 4 + 4 + maxQPath + 9*4
+	md3SurfaceHeaderSize = 4 + maxQPath + 10*4
+	md3FrameSize         = maxFrameLength + 10*4
+	md3TagSize           = maxQPath + 12*4
+	md3ShaderSize        = maxQPath + 4
+	md3TriangleSize      = 3 * 4
+	md3TexCoordSize      = 2 * 4
+	md3VertexSize        = 8
 )
 
 type surfaceHeader struct {
@@ -51,67 +59,123 @@ type fileHeader struct {
 	ofs_eof      int32
 }
 
+// Decoder reads MD3 models from an io.ReaderAt. Unlike Read, it does not
+// require the entire file to be held in memory: the frame, tag, and surface
+// lists are located by offset and read directly from the underlying reader.
+type Decoder struct {
+	r    io.ReaderAt
+	size int64
+}
+
+// NewDecoder returns a Decoder reading an MD3 file of size bytes from r.
+func NewDecoder(r io.ReaderAt, size int64) *Decoder {
+	return &Decoder{r: r, size: size}
+}
+
+// Decode reads an MD3 model of size bytes from r.
+func Decode(r io.ReaderAt, size int64) (*Model, error) {
+	return NewDecoder(r, size).Decode()
+}
+
+// Read reads an MD3 model from data. It is equivalent to calling Decode with
+// a reader over data.
 func Read(data []byte) (*Model, error) {
-	var (
-		header *fileHeader
-		err    error
-	)
+	return Decode(bytes.NewReader(data), int64(len(data)))
+}
 
-	r := bytes.NewReader(data)
-	header, err = readMD3Header(r)
+// ReadFile reads the named MD3 model from fsys. If the opened file supports
+// random access, as an *os.File does, the model is decoded in place rather
+// than read into memory first.
+func ReadFile(fsys fs.FS, name string) (*Model, error) {
+	file, err := fsys.Open(name)
 	if err != nil {
-		log.Println("Error reading header:", err)
 		return nil, err
 	}
+	defer file.Close()
 
-	numSurfaces := int(header.num_surfaces)
-	model := new(Model)
-	surfaces := make([]*Surface, 0, numSurfaces)
+	if ra, ok := file.(io.ReaderAt); ok {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return Decode(ra, info.Size())
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	return Read(data)
+}
+
+// section returns a reader over the decoder's data beginning at off.
+func (d *Decoder) section(off int64) *io.SectionReader {
+	return io.NewSectionReader(d.r, off, d.size-off)
+}
+
+// Decode reads the model from the decoder's reader. Any failure to read part
+// of the model is returned as a *FormatError; no partial model is returned.
+func (d *Decoder) Decode() (*Model, error) {
+	header, err := readMD3Header(d.section(0))
+	if err != nil {
+		return nil, &FormatError{Section: "header", Surface: -1, Err: err}
+	}
+
+	if err := d.checkHeader(header); err != nil {
+		return nil, &FormatError{Section: "header", Surface: -1, Err: err}
+	}
 
+	model := new(Model)
 	model.name = header.name
 
-	surfaceOutput := readSurfaceList(data[header.ofs_surfaces:], int(header.num_surfaces))
-	tagOutput := readTagList(data[header.ofs_tags:], int(header.num_tags), int(header.num_frames))
-	frameOutput := readFrameList(data[header.ofs_frames:], int(header.num_frames))
+	surfaceOutput := d.readSurfaceList(int64(header.ofs_surfaces), int(header.num_surfaces), header.num_frames)
+	tagOutput := d.readTagList(int64(header.ofs_tags), int(header.num_tags), int(header.num_frames))
+	frameOutput := d.readFrameList(int64(header.ofs_frames), int(header.num_frames))
 
-	for surfIndex := 0; surfIndex < numSurfaces; surfIndex++ {
-		if surface := <-surfaceOutput; surface != nil {
-			surfaces = append(surfaces, surface)
+	surfaces, tags, frames := <-surfaceOutput, <-tagOutput, <-frameOutput
+	for _, err := range []error{frames.err, tags.err, surfaces.err} {
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	model.tags = <-tagOutput
-	model.frames = <-frameOutput
-	model.surfaces = surfaces
+	model.tags = tags.value
+	model.frames = frames.value
+	model.surfaces = surfaces.value
 
 	return model, nil
 }
 
-func readTagList(data []byte, count int, numFrames int) <-chan []*Tag {
-	output := make(chan []*Tag)
+// result pairs a value read by one of the decoder's goroutines with the error
+// encountered while reading it, if any.
+type result[T any] struct {
+	value T
+	err   error
+}
 
-	go func(output chan<- []*Tag) {
-		// defer close(output)
+func (d *Decoder) readTagList(offset int64, count int, numFrames int) <-chan result[[]*Tag] {
+	output := make(chan result[[]*Tag], 1)
 
-		r := bytes.NewReader(data)
+	go func(output chan<- result[[]*Tag]) {
+		r := d.section(offset)
 		tagMap := make(map[string]*Tag)
 		tags := make([]*Tag, 0, count)
-		var ok bool
-		var tag *Tag
-		var frame TagFrame
-		var name string
-		var err error
 		var numTagsToRead = count * numFrames
 
 		for i := 0; i < numTagsToRead; i++ {
-			name, frame, err = readTag(r)
-
+			name, frame, err := readTag(r)
 			if err != nil {
-				log.Println("Error reading tag list:", err)
-				break
+				output <- result[[]*Tag]{nil, &FormatError{
+					Section: "tags",
+					Surface: -1,
+					Offset:  offset + int64(i*md3TagSize),
+					Err:     err,
+				}}
+				return
 			}
 
-			if tag, ok = tagMap[name]; !ok {
+			tag, ok := tagMap[name]
+			if !ok {
 				tag = new(Tag)
 				tag.name = name
 				tags = append(tags, tag)
@@ -121,7 +185,12 @@ func readTagList(data []byte, count int, numFrames int) <-chan []*Tag {
 			tag.frames = append(tag.frames, frame)
 		}
 
-		output <- tags
+		if err := checkTags(tags, numFrames); err != nil {
+			output <- result[[]*Tag]{nil, &FormatError{Section: "tags", Surface: -1, Offset: offset, Err: err}}
+			return
+		}
+
+		output <- result[[]*Tag]{tags, nil}
 	}(output)
 
 	return output
@@ -162,7 +231,6 @@ func readMD3Header(r io.Reader) (*fileHeader, error) {
 	ident, err = readFixedString(r, 4)
 	switch {
 	case err != nil:
-		log.Println("Error reading header identifier", err)
 		return nil, err
 	case ident != md3HeaderIdent:
 		return nil, fmt.Errorf("MD3 header identifier is %q, should be %q", ident, md3HeaderIdent)
@@ -171,7 +239,6 @@ func readMD3Header(r io.Reader) (*fileHeader, error) {
 	header.version, err = readS32(r)
 	switch {
 	case err != nil:
-		log.Println("Error reading header version", err)
 		return nil, err
 	case header.version > md3MaxVersion:
 		return nil, fmt.Errorf("MD3 header version (%d) exceeds max version (%d)", header.version, md3MaxVersion)
@@ -179,7 +246,6 @@ func readMD3Header(r io.Reader) (*fileHeader, error) {
 
 	header.name, err = readNulString(r, maxQPath)
 	if err != nil {
-		log.Println("Error reading header model name", err)
 		return nil, err
 	}
 
@@ -285,130 +351,170 @@ func readTriangle(r io.Reader) (Triangle, error) {
 	return tri, err
 }
 
-func readTriangleList(data []byte, count int) <-chan []Triangle {
-	output := make(chan []Triangle)
-	go func(output chan<- []Triangle) {
+func readTriangleList(r io.Reader, count int) <-chan result[[]Triangle] {
+	output := make(chan result[[]Triangle], 1)
+	go func(output chan<- result[[]Triangle]) {
 		var err error
 		tris := make([]Triangle, count)
-		r := bytes.NewReader(data)
 		for index := range tris {
 			tris[index], err = readTriangle(r)
-
 			if err != nil {
-				output <- nil
-				log.Println("Error reading triangles:", err)
+				output <- result[[]Triangle]{nil, err}
 				return
 			}
 		}
 
-		output <- tris
+		output <- result[[]Triangle]{tris, nil}
 	}(output)
 	return output
 }
 
-func readTexCoordList(data []byte, count int) <-chan []TexCoord {
-	output := make(chan []TexCoord)
-	go func(output chan<- []TexCoord) {
+func readTexCoordList(r io.Reader, count int) <-chan result[[]TexCoord] {
+	output := make(chan result[[]TexCoord], 1)
+	go func(output chan<- result[[]TexCoord]) {
 		var err error
 		tcs := make([]TexCoord, count)
-		r := bytes.NewReader(data)
 		for index := range tcs {
 			tc := TexCoord{}
 
 			tc.S, err = readF32(r)
-			if err != nil {
-				break
+			if err == nil {
+				tc.T, err = readF32(r)
 			}
 
-			tc.T, err = readF32(r)
 			if err != nil {
-				break
+				output <- result[[]TexCoord]{nil, err}
+				return
 			}
 
 			tcs[index] = tc
 		}
 
-		if err != nil {
-			log.Println("Error reading texcoords:", err)
-		}
-
-		output <- tcs
+		output <- result[[]TexCoord]{tcs, nil}
 	}(output)
 	return output
 }
 
-func readShaderList(data []byte, count int) <-chan []Shader {
-	output := make(chan []Shader)
-	go func(output chan<- []Shader) {
+func readShaderList(r io.Reader, count int) <-chan result[[]Shader] {
+	output := make(chan result[[]Shader], 1)
+	go func(output chan<- result[[]Shader]) {
 		var err error
 		shaders := make([]Shader, count)
-		r := bytes.NewReader(data)
 		for index := range shaders {
 			shader := Shader{}
 
 			shader.Name, err = readNulString(r, maxQPath)
-			if err != nil {
-				break
+			if err == nil {
+				shader.Index, err = readS32(r)
 			}
 
-			shader.Index, err = readS32(r)
 			if err != nil {
-				break
+				output <- result[[]Shader]{nil, err}
+				return
 			}
 
 			shaders[index] = shader
 		}
 
-		if err != nil {
-			log.Println("Error reading shaders:", err)
-		}
-
-		output <- shaders
+		output <- result[[]Shader]{shaders, nil}
 	}(output)
 	return output
 }
 
-func readSurfaceList(data []byte, count int) <-chan *Surface {
-	output := make(chan *Surface)
-	go func(data []byte, output chan<- *Surface) {
+type indexedSurface struct {
+	index   int
+	surface *Surface
+	err     error
+}
+
+// readSurfaceList reads count surfaces, the first of which begins at offset,
+// each of which must have numFrames frames.
+// Surface headers are read in sequence, since each surface's position depends
+// on the size of the one preceding it, while the surfaces' contents are read
+// concurrently.
+func (d *Decoder) readSurfaceList(offset int64, count int, numFrames int32) <-chan result[[]*Surface] {
+	output := make(chan result[[]*Surface], 1)
+	go func(offset int64, output chan<- result[[]*Surface]) {
+		surfaces := make([]*Surface, count)
+		received := make(chan indexedSurface, count)
+
 		for index := 0; index < count; index++ {
-			reader := bytes.NewReader(data[:])
-			header, err := readSurfaceHeader(reader)
+			header, err := readSurfaceHeader(d.section(offset))
+			if err == nil {
+				err = d.checkSurfaceHeader(header, offset, numFrames)
+			}
 			if err != nil {
-				log.Println("Error reading surface header:", err)
-				break
+				output <- result[[]*Surface]{nil, &FormatError{
+					Section: "surface header",
+					Surface: index,
+					Offset:  offset,
+					Err:     err,
+				}}
+				return
 			}
 
-			go func(data []byte) {
-				surf, err := readSurface(header, data)
-				if err != nil {
-					log.Printf("Error reading surface %q: %s\n", header.name, err)
-				}
+			go func(index int, offset int64) {
+				surf, err := d.readSurface(header, index, offset)
+				received <- indexedSurface{index, surf, err}
+			}(index, offset)
 
-				surf.name = header.name
-				surf.numFrames = int(header.num_frames)
-
-				output <- surf
-			}(data)
+			offset += int64(header.ofs_end)
+		}
 
-			data = data[header.ofs_end:]
+		for _ = range surfaces {
+			pack := <-received
+			if pack.err != nil {
+				output <- result[[]*Surface]{nil, pack.err}
+				return
+			}
+			surfaces[pack.index] = pack.surface
 		}
-	}(data, output)
+
+		output <- result[[]*Surface]{surfaces, nil}
+	}(offset, output)
 	return output
 }
 
-func readSurface(h *surfaceHeader, data []byte) (*Surface, error) {
+// readSurface reads the surface described by h, whose header begins at
+// offset. All of the surface header's offsets are relative to it.
+func (d *Decoder) readSurface(h *surfaceHeader, index int, offset int64) (*Surface, error) {
 	surface := new(Surface)
+	surface.name = h.name
+	surface.numFrames = int(h.num_frames)
+
+	var (
+		trianglesOffset = offset + int64(h.ofs_triangles)
+		shadersOffset   = offset + int64(h.ofs_shaders)
+		texcoordsOffset = offset + int64(h.ofs_st)
+		verticesOffset  = offset + int64(h.ofs_xyznormal)
+	)
+
+	triangleOutput := readTriangleList(d.section(trianglesOffset), int(h.num_triangles))
+	shaderOutput := readShaderList(d.section(shadersOffset), int(h.num_shaders))
+	texcoordOutput := readTexCoordList(d.section(texcoordsOffset), int(h.num_verts))
+	verticesOutput := d.readVertexFrames(verticesOffset, int(h.num_verts), int(h.num_frames))
+
+	vertices, triangles, texcoords, shaders := <-verticesOutput, <-triangleOutput, <-texcoordOutput, <-shaderOutput
+
+	switch {
+	case vertices.err != nil:
+		return nil, &FormatError{Section: "vertices", Surface: index, Offset: verticesOffset, Err: vertices.err}
+	case triangles.err != nil:
+		return nil, &FormatError{Section: "triangles", Surface: index, Offset: trianglesOffset, Err: triangles.err}
+	case texcoords.err != nil:
+		return nil, &FormatError{Section: "texcoords", Surface: index, Offset: texcoordsOffset, Err: texcoords.err}
+	case shaders.err != nil:
+		return nil, &FormatError{Section: "shaders", Surface: index, Offset: shadersOffset, Err: shaders.err}
+	}
 
-	triangleOutput := readTriangleList(data[h.ofs_triangles:], int(h.num_triangles))
-	shaderOutput := readShaderList(data[h.ofs_shaders:], int(h.num_shaders))
-	texcoordOutput := readTexCoordList(data[h.ofs_st:], int(h.num_verts))
-	verticesOutput := readVertexFrames(data[h.ofs_xyznormal:], int(h.num_verts), int(h.num_frames))
+	if err := checkTriangles(triangles.value, int(h.num_verts)); err != nil {
+		return nil, &FormatError{Section: "triangles", Surface: index, Offset: trianglesOffset, Err: err}
+	}
 
-	surface.vertices = <-verticesOutput
-	surface.triangles = <-triangleOutput
-	surface.texcoords = <-texcoordOutput
-	surface.shaders = <-shaderOutput
+	surface.vertices = vertices.value
+	surface.triangles = triangles.value
+	surface.texcoords = texcoords.value
+	surface.shaders = shaders.value
 
 	return surface, nil
 }
@@ -416,37 +522,38 @@ func readSurface(h *surfaceHeader, data []byte) (*Surface, error) {
 type frameAndVertices struct {
 	index    int
 	vertices []Vertex
+	err      error
 }
 
-func readVertexFrames(data []byte, numVertices, numFrames int) <-chan [][]Vertex {
-	output := make(chan [][]Vertex)
+func (d *Decoder) readVertexFrames(offset int64, numVertices, numFrames int) <-chan result[[][]Vertex] {
+	output := make(chan result[[][]Vertex], 1)
 
-	go func(data []byte, output chan<- [][]Vertex) {
+	go func(offset int64, output chan<- result[[][]Vertex]) {
 		var (
 			frameVertices = make([][]Vertex, numFrames)
-			frameReceiver = make(chan frameAndVertices)
-			frameSize     = numVertices * md3VertexSize
+			frameReceiver = make(chan frameAndVertices, numFrames)
+			frameSize     = int64(numVertices * md3VertexSize)
 		)
 
 		for frame := range frameVertices {
-			go func(frame int, data []byte) {
-				reader := bytes.NewReader(data)
-				vertices, err := readXYZNormals(reader, numVertices)
-				if err != nil {
-					log.Println("Error reading vertices:", err)
-				}
-				frameReceiver <- frameAndVertices{frame, vertices}
-			}(frame, data[:frameSize])
-			data = data[frameSize:]
+			go func(frame int, r io.Reader) {
+				vertices, err := readXYZNormals(r, numVertices)
+				frameReceiver <- frameAndVertices{frame, vertices, err}
+			}(frame, io.NewSectionReader(d.r, offset, frameSize))
+			offset += frameSize
 		}
 
 		for _ = range frameVertices {
 			pack := <-frameReceiver
+			if pack.err != nil {
+				output <- result[[][]Vertex]{nil, fmt.Errorf("frame %d: %w", pack.index, pack.err)}
+				return
+			}
 			frameVertices[pack.index] = pack.vertices
 		}
 
-		output <- frameVertices
-	}(data, output)
+		output <- result[[][]Vertex]{frameVertices, nil}
+	}(offset, output)
 
 	return output
 }
@@ -475,27 +582,28 @@ func readFrame(r io.Reader) (*Frame, error) {
 	return frame, nil
 }
 
-func readFrameList(data []byte, count int) <-chan []*Frame {
-	output := make(chan []*Frame)
+func (d *Decoder) readFrameList(offset int64, count int) <-chan result[[]*Frame] {
+	output := make(chan result[[]*Frame], 1)
 
-	go func(output chan<- []*Frame) {
-		// defer close(output)
-
-		var err error
-		reader := bytes.NewReader(data)
+	go func(output chan<- result[[]*Frame]) {
+		reader := d.section(offset)
 		frames := make([]*Frame, count)
 
 		for index := range frames {
+			var err error
 			frames[index], err = readFrame(reader)
-
 			if err != nil {
-				log.Println("Error reading frame list:", err)
-				frames = nil
-				break
+				output <- result[[]*Frame]{nil, &FormatError{
+					Section: "frames",
+					Surface: -1,
+					Offset:  offset + int64(index*md3FrameSize),
+					Err:     err,
+				}}
+				return
 			}
 		}
 
-		output <- frames
+		output <- result[[]*Frame]{frames, nil}
 	}(output)
 
 	return output
@@ -0,0 +1,243 @@
+package md3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Byte offsets of fields in the file and surface headers.
+const (
+	headerNumFrames   = 76
+	headerNumTags     = 80
+	headerNumSurfaces = 84
+	headerOfsFrames   = 92
+	headerOfsTags     = 96
+	headerOfsSurfaces = 100
+
+	surfaceNumFrames    = 72
+	surfaceNumShaders   = 76
+	surfaceNumVerts     = 80
+	surfaceNumTriangles = 84
+	surfaceOfsTriangles = 88
+	surfaceOfsXYZNormal = 100
+	surfaceOfsEnd       = 104
+)
+
+// testModel returns a model with two frames, two tags and two surfaces, the
+// second of which has two shaders.
+func testModel(t testing.TB) *Model {
+	t.Helper()
+
+	b := NewModelBuilder("models/test/test.md3")
+	b.AddFrame("idle", Vec3{}, Vec3{}, Vec3{}, 0)
+	b.AddFrame("walk", Vec3{}, Vec3{}, Vec3{X: 1}, 0)
+
+	b.AddTag("tag_head",
+		TagFrame{Origin: Vec3{Z: 16}, XOrientation: Vec3{X: 1}, YOrientation: Vec3{Y: 1}, ZOrientation: Vec3{Z: 1}},
+		TagFrame{Origin: Vec3{Z: 18}, XOrientation: Vec3{Y: 1}, YOrientation: Vec3{X: -1}, ZOrientation: Vec3{Z: 1}})
+	b.AddTag("tag_weapon",
+		TagFrame{Origin: Vec3{X: 8}, XOrientation: Vec3{X: 1}, YOrientation: Vec3{Y: 1}, ZOrientation: Vec3{Z: 1}},
+		TagFrame{Origin: Vec3{X: 9}, XOrientation: Vec3{X: 1}, YOrientation: Vec3{Y: 1}, ZOrientation: Vec3{Z: 1}})
+
+	quad := b.AddSurface("quad")
+	quad.AddShader("textures/test/quad.tga")
+	quad.SetTexCoords([]TexCoord{{0, 0}, {1, 0}, {1, 1}, {0, 1}})
+	quad.AddTriangle(0, 1, 2)
+	quad.AddTriangle(0, 2, 3)
+	quad.AddVertexFrame([]Vertex{
+		{Vec3{-4, -4, 0}, Vec3{Z: 1}},
+		{Vec3{4, -4, 0}, Vec3{Z: 1}},
+		{Vec3{4, 4, 0}, Vec3{Z: 1}},
+		{Vec3{-4, 4, 0}, Vec3{Z: 1}},
+	})
+	quad.AddVertexFrame([]Vertex{
+		{Vec3{-4, -4, 1.5}, Vec3{X: 1}},
+		{Vec3{4, -4, 1.5}, Vec3{X: 1}},
+		{Vec3{4, 4, 1.5}, Vec3{Y: -1}},
+		{Vec3{-4, 4, 1.5}, Vec3{0, 0.6, 0.8}},
+	})
+
+	tri := b.AddSurface("tri")
+	tri.AddShader("textures/test/tri")
+	tri.AddShader("textures/test/tri_red")
+	tri.SetTexCoords([]TexCoord{{0.25, 0.5}, {0.75, 0.5}, {0.5, 1}})
+	tri.AddTriangle(0, 2, 1)
+	tri.AddVertexFrame([]Vertex{
+		{Vec3{0, 0, 8}, Vec3{Y: 1}},
+		{Vec3{2, 0, 8}, Vec3{Y: 1}},
+		{Vec3{1, 0, 10}, Vec3{Y: 1}},
+	})
+	tri.AddVertexFrame([]Vertex{
+		{Vec3{0, 0.5, 8}, Vec3{Y: -1}},
+		{Vec3{2, 0.5, 8}, Vec3{Y: -1}},
+		{Vec3{1.01, 0.5, 10.3}, Vec3{-0.36, -0.48, 0.8}},
+	})
+
+	b.ComputeFrameBounds()
+	m, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return m
+}
+
+// testModelData returns testModel written as an MD3 file.
+func testModelData(t testing.TB) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, testModel(t)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+func getS32(data []byte, offset int) int32 {
+	return int32(binary.LittleEndian.Uint32(data[offset:]))
+}
+
+func putS32(data []byte, offset int, v int32) {
+	binary.LittleEndian.PutUint32(data[offset:], uint32(v))
+}
+
+// patched returns a copy of data with the 32-bit integer at offset set to v.
+// If surface is true, offset is relative to the first surface.
+func patched(data []byte, surface bool, offset int, v int32) []byte {
+	data = bytes.Clone(data)
+	if surface {
+		offset += int(getS32(data, headerOfsSurfaces))
+	}
+	putS32(data, offset, v)
+	return data
+}
+
+func TestReadRejectsMalformed(t *testing.T) {
+	data := testModelData(t)
+	surf := int(getS32(data, headerOfsSurfaces))
+	triangles := surf + int(getS32(data, surf+surfaceOfsTriangles))
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"negative frames", patched(data, false, headerNumFrames, -1), ErrLimitExceeded},
+		{"too many frames", patched(data, false, headerNumFrames, maxFrames+1), ErrLimitExceeded},
+		{"negative tags", patched(data, false, headerNumTags, -2), ErrLimitExceeded},
+		{"negative surfaces", patched(data, false, headerNumSurfaces, -1), ErrLimitExceeded},
+		{"negative surface frames", patched(data, true, surfaceNumFrames, -1), ErrLimitExceeded},
+		{"negative shaders", patched(data, true, surfaceNumShaders, -1), ErrLimitExceeded},
+		{"negative vertices", patched(data, true, surfaceNumVerts, -1), ErrLimitExceeded},
+		{"negative triangles", patched(data, true, surfaceNumTriangles, -1), ErrLimitExceeded},
+		{"frames past end", patched(data, false, headerOfsFrames, int32(len(data))), ErrOutOfBounds},
+		{"negative frames offset", patched(data, false, headerOfsFrames, -4), ErrOutOfBounds},
+		{"tags past end", patched(data, false, headerOfsTags, int32(len(data)-8)), ErrOutOfBounds},
+		{"surfaces past end", patched(data, false, headerOfsSurfaces, int32(len(data)+1)), ErrOutOfBounds},
+		{"triangles past end", patched(data, true, surfaceOfsTriangles, 1<<20), ErrOutOfBounds},
+		{"vertices past end", patched(data, true, surfaceOfsXYZNormal, -64), ErrOutOfBounds},
+		{"short surface", patched(data, true, surfaceOfsEnd, 4), ErrOutOfBounds},
+		{"surface missing frames", patched(data, true, surfaceNumFrames, 1), ErrFrameMismatch},
+		{"surface extra frames", patched(data, true, surfaceNumFrames, 3), ErrOutOfBounds},
+		{"triangle past vertices", patched(data, false, triangles, 4), ErrOutOfBounds},
+		{"negative triangle index", patched(data, false, triangles+4, -1), ErrOutOfBounds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Read(tt.data)
+			if m != nil {
+				t.Errorf("Read() returned a model")
+			}
+
+			var fe *FormatError
+			if !errors.As(err, &fe) {
+				t.Fatalf("Read() error = %v, want *FormatError", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Read() error = %v, want it to wrap %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRejectsTruncated(t *testing.T) {
+	data := testModelData(t)
+	for _, size := range []int{0, 4, md3HeaderSize - 1, md3HeaderSize, len(data) / 2, len(data) - 1} {
+		_, err := Read(data[:size])
+		var fe *FormatError
+		if !errors.As(err, &fe) {
+			t.Errorf("Read() of %d of %d bytes: error = %v, want *FormatError", size, len(data), err)
+		}
+	}
+}
+
+func TestReadRejectsRenamedTag(t *testing.T) {
+	data := bytes.Clone(testModelData(t))
+
+	// Rename the first tag of the second frame, which splits both it and
+	// the tag it should have been into tags with a single frame.
+	offset := int(getS32(data, headerOfsTags)) + 2*md3TagSize
+	copy(data[offset:], "tag_other\x00")
+
+	_, err := Read(data)
+	var fe *FormatError
+	if !errors.As(err, &fe) || fe.Section != "tags" {
+		t.Fatalf("Read() error = %v, want tags *FormatError", err)
+	}
+	if !errors.Is(err, ErrFrameMismatch) {
+		t.Errorf("Read() error = %v, want it to wrap %v", err, ErrFrameMismatch)
+	}
+}
+
+// poseAll exercises every accessor that indexes a model's frames, vertices
+// or tags by values taken from the file.
+func poseAll(m *Model) {
+	n := m.NumFrames()
+	var dst [][]Vertex
+	for frame := range n {
+		next := (frame + 1) % n
+		dst = m.Pose(dst, frame, next, 0.5)
+		m.LerpFrame(frame, next, 0.5)
+		for _, tag := range m.AllTags() {
+			tag.Lerp(frame, next, 0.5)
+		}
+		for _, surf := range m.AllSurfaces() {
+			for _, tri := range surf.AllTriangles() {
+				surf.Vertex(frame, int(tri.A))
+				surf.Vertex(frame, int(tri.B))
+				surf.Vertex(frame, int(tri.C))
+			}
+		}
+	}
+}
+
+func FuzzRead(f *testing.F) {
+	data := testModelData(f)
+	surf := int(getS32(data, headerOfsSurfaces))
+
+	f.Add(data)
+	f.Add(data[:md3HeaderSize])
+	f.Add(data[:len(data)/2])
+	f.Add(data[:len(data)-1])
+	f.Add(patched(data, false, headerNumFrames, 3))
+	f.Add(patched(data, false, headerNumTags, 3))
+	f.Add(patched(data, false, headerNumSurfaces, 3))
+	f.Add(patched(data, true, surfaceNumFrames, 1))
+	f.Add(patched(data, true, surfaceNumVerts, 5))
+	f.Add(patched(data, true, surfaceNumTriangles, 3))
+	f.Add(patched(data, false, surf+int(getS32(data, surf+surfaceOfsTriangles)), 7))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := Read(data)
+		if err != nil {
+			var fe *FormatError
+			if !errors.As(err, &fe) {
+				t.Fatalf("Read() error = %v, want *FormatError", err)
+			}
+			return
+		}
+		poseAll(m)
+	})
+}
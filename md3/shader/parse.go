@@ -0,0 +1,363 @@
+package shader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/nilium/go-md3/md3/internal/token"
+)
+
+// ParseError is returned when a shader script is malformed.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("shader: line %d: %s", e.Line, e.Msg)
+}
+
+type parser struct {
+	s *token.Scanner
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseError{p.s.Line(), fmt.Sprintf(format, args...)}
+}
+
+// Parse reads a shader script from r.
+//
+// Keywords are matched without regard to case. Keywords the parser doesn't
+// give a field of their own are kept, with their arguments, in the
+// Directives of their shader or stage.
+//
+// As in Quake 3, a malformed shader is skipped and parsing carries on with
+// the next one, while a shader missing its opening brace ends the script.
+// The returned script holds every shader that was read, even if the error,
+// which joins a *ParseError for each skipped shader, is non-nil.
+func Parse(r io.Reader) (*Script, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{token.NewScanner(data)}
+	script := new(Script)
+	var errs []error
+
+	for {
+		name, ok := p.s.Next()
+		if !ok {
+			return script, errors.Join(errs...)
+		}
+
+		line := p.s.Line()
+		start := p.s.Mark()
+		if tok, _ := p.s.Next(); tok != "{" {
+			errs = append(errs, p.errorf("expected { after shader %q, found %q", name, tok))
+			return script, errors.Join(errs...)
+		}
+
+		sh, err := p.parseShader(name, line)
+		if err != nil {
+			errs = append(errs, err)
+			p.s.Reset(start)
+			p.s.SkipBracedSection()
+			continue
+		}
+		script.Shaders = append(script.Shaders, sh)
+	}
+}
+
+// restOfLine returns the remaining tokens on the current line.
+func (p *parser) restOfLine() []string {
+	var args []string
+	for {
+		tok, ok := p.s.NextOnLine()
+		if !ok {
+			return args
+		}
+		args = append(args, tok)
+	}
+}
+
+func (p *parser) parseShader(name string, line int) (*Shader, error) {
+	sh := &Shader{Name: name, Line: line}
+
+	for {
+		tok, ok := p.s.Next()
+		switch {
+		case !ok:
+			return nil, p.errorf("unexpected end of file in shader %q", name)
+		case tok == "}":
+			return sh, nil
+		case tok == "{":
+			stage, err := p.parseStage()
+			if err != nil {
+				return nil, err
+			}
+			sh.Stages = append(sh.Stages, stage)
+			continue
+		}
+
+		args := p.restOfLine()
+		var err error
+
+		switch strings.ToLower(tok) {
+		case "cull":
+			sh.Cull = parseCull(args)
+		case "surfaceparm":
+			if len(args) > 0 {
+				sh.SurfaceParms = append(sh.SurfaceParms, strings.ToLower(args[0]))
+			}
+		case "deformvertexes":
+			var deform Deform
+			deform, err = p.parseDeform(args)
+			sh.Deforms = append(sh.Deforms, deform)
+		case "sort":
+			if len(args) > 0 {
+				sh.Sort = strings.ToLower(args[0])
+			}
+		case "nomipmaps":
+			sh.NoMipMaps = true
+		case "nopicmip":
+			sh.NoPicMip = true
+		case "polygonoffset":
+			sh.PolygonOffset = true
+		default:
+			sh.Directives = append(sh.Directives, Directive{tok, args})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseCull returns the cull mode given by args. A missing or unknown mode
+// leaves the default, as the engine only warns about it.
+func parseCull(args []string) Cull {
+	if len(args) == 0 {
+		return CullFront
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "back", "backside", "backsided":
+		return CullBack
+	case "none", "twosided", "disable":
+		return CullNone
+	}
+	return CullFront
+}
+
+func (p *parser) parseFloats(args []string) ([]float32, error) {
+	values := make([]float32, len(args))
+	for index, arg := range args {
+		f, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", arg)
+		}
+		values[index] = float32(f)
+	}
+	return values, nil
+}
+
+// parseWave parses a wave function from args, which must begin with the
+// function's name.
+func (p *parser) parseWave(args []string) (*Wave, error) {
+	if len(args) < 5 {
+		return nil, p.errorf("wave function needs a name and 4 arguments, got %q", args)
+	}
+
+	values, err := p.parseFloats(args[1:5])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Wave{
+		Func:      strings.ToLower(args[0]),
+		Base:      values[0],
+		Amplitude: values[1],
+		Phase:     values[2],
+		Frequency: values[3],
+	}, nil
+}
+
+func (p *parser) parseDeform(args []string) (Deform, error) {
+	if len(args) == 0 {
+		return Deform{}, p.errorf("missing deformVertexes type")
+	}
+
+	deform := Deform{Kind: strings.ToLower(args[0])}
+	args = args[1:]
+
+	switch deform.Kind {
+	case "wave", "move":
+		// The spread of a wave or the vector of a move precedes the wave.
+		n := 1
+		if deform.Kind == "move" {
+			n = 3
+		}
+		if len(args) < n {
+			return deform, p.errorf("deformVertexes %s needs %d arguments before its wave", deform.Kind, n)
+		}
+
+		var err error
+		if deform.Args, err = p.parseFloats(args[:n]); err != nil {
+			return deform, err
+		}
+		deform.Wave, err = p.parseWave(args[n:])
+		return deform, err
+	case "normal", "bulge":
+		var err error
+		deform.Args, err = p.parseFloats(args)
+		return deform, err
+	}
+
+	// autosprite, autosprite2, projectionShadow, text0-7 and others carry no
+	// numeric arguments the parser needs to interpret.
+	return deform, nil
+}
+
+func (p *parser) parseStage() (*Stage, error) {
+	stage := new(Stage)
+
+	for {
+		tok, ok := p.s.Next()
+		switch {
+		case !ok:
+			return nil, p.errorf("unexpected end of file in stage")
+		case tok == "}":
+			return stage, nil
+		}
+
+		args := p.restOfLine()
+		var err error
+
+		switch strings.ToLower(tok) {
+		case "map", "clampmap":
+			if len(args) == 0 {
+				return nil, p.errorf("missing image for %s", tok)
+			}
+			stage.Map = args[0]
+			stage.Clamp = strings.EqualFold(tok, "clampmap")
+		case "animmap":
+			if len(args) < 2 {
+				return nil, p.errorf("animMap needs a frequency and at least one image")
+			}
+			freq, err := p.parseFloats(args[:1])
+			if err != nil {
+				return nil, err
+			}
+			stage.AnimMap = &AnimMap{freq[0], args[1:]}
+		case "videomap":
+			if len(args) > 0 {
+				stage.VideoMap = args[0]
+			}
+		case "blendfunc":
+			stage.BlendFunc, err = p.parseBlendFunc(args)
+		case "rgbgen":
+			stage.RGBGen, err = p.parseGen(args)
+		case "alphagen":
+			stage.AlphaGen, err = p.parseGen(args)
+		case "tcgen", "texgen":
+			if len(args) > 0 {
+				stage.TCGen = strings.ToLower(args[0])
+			}
+		case "tcmod":
+			var mod TCMod
+			mod, err = p.parseTCMod(args)
+			stage.TCMods = append(stage.TCMods, mod)
+		case "alphafunc":
+			if len(args) > 0 {
+				stage.AlphaFunc = strings.ToUpper(args[0])
+			}
+		case "depthfunc":
+			if len(args) > 0 {
+				stage.DepthFunc = strings.ToLower(args[0])
+			}
+		case "depthwrite":
+			stage.DepthWrite = true
+		case "detail":
+			stage.Detail = true
+		default:
+			stage.Directives = append(stage.Directives, Directive{tok, args})
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseBlendFunc(args []string) (BlendFunc, error) {
+	switch {
+	case len(args) == 1:
+		switch strings.ToLower(args[0]) {
+		case "add":
+			return BlendFunc{"GL_ONE", "GL_ONE"}, nil
+		case "filter":
+			return BlendFunc{"GL_DST_COLOR", "GL_ZERO"}, nil
+		case "blend":
+			return BlendFunc{"GL_SRC_ALPHA", "GL_ONE_MINUS_SRC_ALPHA"}, nil
+		}
+	case len(args) >= 2:
+		return BlendFunc{strings.ToUpper(args[0]), strings.ToUpper(args[1])}, nil
+	}
+	return BlendFunc{}, p.errorf("invalid blendFunc %q", args)
+}
+
+func (p *parser) parseGen(args []string) (Gen, error) {
+	if len(args) == 0 {
+		return Gen{}, p.errorf("missing generator")
+	}
+
+	gen := Gen{Kind: strings.ToLower(args[0])}
+	args = args[1:]
+
+	var err error
+	switch gen.Kind {
+	case "wave":
+		gen.Wave, err = p.parseWave(args)
+	case "const":
+		// const takes a parenthesized vector for rgbGen or a single value
+		// for alphaGen.
+		var values []string
+		for _, arg := range args {
+			if arg != "(" && arg != ")" {
+				values = append(values, arg)
+			}
+		}
+		gen.Args, err = p.parseFloats(values)
+	case "portal":
+		gen.Args, err = p.parseFloats(args)
+	}
+
+	return gen, err
+}
+
+func (p *parser) parseTCMod(args []string) (TCMod, error) {
+	if len(args) == 0 {
+		return TCMod{}, p.errorf("missing tcMod type")
+	}
+
+	mod := TCMod{Kind: strings.ToLower(args[0])}
+	args = args[1:]
+
+	var err error
+	switch mod.Kind {
+	case "stretch":
+		mod.Wave, err = p.parseWave(args)
+	case "turb":
+		// turb omits the wave function's name.
+		mod.Wave, err = p.parseWave(append([]string{"sin"}, args...))
+	default:
+		mod.Args, err = p.parseFloats(args)
+	}
+
+	return mod, err
+}
@@ -0,0 +1,151 @@
+package shader
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ScriptDir is the directory Quake 3 loads shader scripts from.
+const ScriptDir = "scripts"
+
+// ImageExtensions are the extensions tried, in order, when looking for the
+// image of an implicit shader.
+var ImageExtensions = []string{".tga", ".jpg", ".png"}
+
+// Resolver maps shader names to their definitions, as the Quake 3 renderer
+// does when a model is loaded.
+type Resolver struct {
+	fsys    fs.FS
+	shaders map[string]*Shader
+	errs    []error
+}
+
+// NewResolver returns a Resolver with no scripts. If fsys is non-nil, it is
+// searched for the images of implicit shaders.
+func NewResolver(fsys fs.FS) *Resolver {
+	return &Resolver{fsys: fsys, shaders: make(map[string]*Shader)}
+}
+
+// key returns the name used to look up a shader: shader names are compared
+// without regard to case or extension, and with forward slashes.
+func key(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, `\`, "/"))
+	if ext := path.Ext(name); ext != "" {
+		name = name[:len(name)-len(ext)]
+	}
+	return name
+}
+
+// AddScript adds the shaders of a script to the resolver. If a shader is
+// defined more than once in the same script, its first definition is used.
+// Definitions from later scripts replace those from earlier scripts, so
+// scripts should be added in the order the engine loads them.
+func (r *Resolver) AddScript(script *Script) {
+	seen := make(map[string]bool, len(script.Shaders))
+	for _, sh := range script.Shaders {
+		k := key(sh.Name)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		r.shaders[k] = sh
+	}
+}
+
+// LoadScripts parses every .shader file in the scripts directory of fsys,
+// in lexical order, and adds its shaders to the resolver. Malformed shaders
+// are skipped, as the engine skips them, and recorded in Errors; an error is
+// only returned if a script can't be read.
+func (r *Resolver) LoadScripts(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ScriptDir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(path.Ext(entry.Name()), ".shader") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file, err := fsys.Open(path.Join(ScriptDir, name))
+		if err != nil {
+			return err
+		}
+
+		script, err := Parse(file)
+		file.Close()
+		if script == nil {
+			return &fs.PathError{Op: "read", Path: path.Join(ScriptDir, name), Err: err}
+		} else if err != nil {
+			r.errs = append(r.errs, &fs.PathError{Op: "parse", Path: path.Join(ScriptDir, name), Err: err})
+		}
+
+		r.AddScript(script)
+	}
+
+	return nil
+}
+
+// Errors returns an error for each script LoadScripts skipped malformed
+// shaders of, describing the shaders skipped.
+func (r *Resolver) Errors() []error {
+	return r.errs
+}
+
+// Lookup returns the script definition of the named shader, if there is one.
+func (r *Resolver) Lookup(name string) (*Shader, bool) {
+	sh, ok := r.shaders[key(name)]
+	return sh, ok
+}
+
+// Resolve returns the definition of the named shader. If no script defines
+// it, Resolve looks for an image of the same name, with any extension
+// replaced by each of ImageExtensions in turn, and returns an implicit shader
+// drawing that image with diffuse lighting, as the engine does for models.
+// It returns false if neither a definition nor an image exists.
+func (r *Resolver) Resolve(name string) (*Shader, bool) {
+	if sh, ok := r.Lookup(name); ok {
+		return sh, true
+	}
+
+	if image, ok := r.findImage(name); ok {
+		return &Shader{
+			Name:     name,
+			Implicit: true,
+			Stages: []*Stage{{
+				Map:    image,
+				RGBGen: Gen{Kind: "lightingDiffuse"},
+			}},
+		}, true
+	}
+
+	return nil, false
+}
+
+func (r *Resolver) findImage(name string) (string, bool) {
+	if r.fsys == nil {
+		return "", false
+	}
+
+	base := strings.ReplaceAll(name, `\`, "/")
+	if ext := path.Ext(base); ext != "" {
+		base = base[:len(base)-len(ext)]
+	}
+
+	for _, ext := range ImageExtensions {
+		if _, err := fs.Stat(r.fsys, base+ext); err == nil {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,221 @@
+// Package shader reads Quake 3 shader scripts and resolves the shader names
+// used by MD3 surfaces and skins to their definitions.
+package shader
+
+import "strings"
+
+// Script is the contents of a .shader file.
+type Script struct {
+	Shaders []*Shader
+}
+
+// Cull is the face culling mode of a shader.
+type Cull int
+
+const (
+	// CullFront is the default: back faces, as seen by the engine, are
+	// culled.
+	CullFront Cull = iota
+	CullBack
+	// CullNone draws both sides of every triangle.
+	CullNone
+)
+
+// Directive is a shader or stage keyword and its arguments, held for any
+// keyword not given a field of its own.
+type Directive struct {
+	Name string
+	Args []string
+}
+
+// Wave is a periodic function, as used by deformVertexes, rgbGen, alphaGen
+// and tcMod.
+type Wave struct {
+	// Func is one of "sin", "triangle", "square", "sawtooth",
+	// "inversesawtooth", or "noise".
+	Func      string
+	Base      float32
+	Amplitude float32
+	Phase     float32
+	Frequency float32
+}
+
+// Deform is a deformVertexes directive.
+type Deform struct {
+	// Kind is the type of deformation, such as "wave", "normal", "bulge",
+	// "move", "autosprite", or "autosprite2".
+	Kind string
+	// Args holds the deformation's numeric arguments that precede its wave,
+	// such as the spread of a "wave" deform or the vector of a "move".
+	Args []float32
+	// Wave is the deformation's wave function, if it has one.
+	Wave *Wave
+}
+
+// Shader is a single shader definition.
+type Shader struct {
+	Name string
+	// Line is the line of the script the shader is defined on, or zero if it
+	// is implicit.
+	Line int
+	// Implicit is true if the shader has no definition in a script and was
+	// created from an image of the same name.
+	Implicit bool
+
+	Cull          Cull
+	SurfaceParms  []string
+	Deforms       []Deform
+	Sort          string
+	NoMipMaps     bool
+	NoPicMip      bool
+	PolygonOffset bool
+	// Directives holds any other shader-level keywords, such as skyParms,
+	// fogParms or q3map_ directives.
+	Directives []Directive
+
+	Stages []*Stage
+}
+
+// BlendFunc is the source and destination blend factors of a stage, using
+// their OpenGL names such as "GL_ONE" or "GL_SRC_ALPHA". The zero value means
+// the stage is not blended.
+type BlendFunc struct {
+	Src, Dst string
+}
+
+// Gen is an rgbGen or alphaGen directive.
+type Gen struct {
+	// Kind is the type of generator, such as "identity", "vertex",
+	// "lightingdiffuse", "wave", "const", or "portal".
+	Kind string
+	Wave *Wave
+	Args []float32
+}
+
+// AnimMap is an animMap directive: a sequence of images cycled through at a
+// given frequency.
+type AnimMap struct {
+	Frequency float32
+	Frames    []string
+}
+
+// TCMod is a tcMod directive.
+type TCMod struct {
+	// Kind is the type of modification, such as "scroll", "scale",
+	// "rotate", "turb", "stretch", or "transform".
+	Kind string
+	Args []float32
+	Wave *Wave
+}
+
+// Stage is a single rendering pass of a shader.
+type Stage struct {
+	// Map is the stage's image, or one of the special names "$lightmap" and
+	// "$whiteimage". It is empty for animMap and videoMap stages.
+	Map string
+	// Clamp is true if the image is given by clampMap rather than map.
+	Clamp    bool
+	AnimMap  *AnimMap
+	VideoMap string
+
+	BlendFunc  BlendFunc
+	RGBGen     Gen
+	AlphaGen   Gen
+	TCGen      string
+	TCMods     []TCMod
+	AlphaFunc  string
+	DepthFunc  string
+	DepthWrite bool
+	Detail     bool
+	// Directives holds any other stage-level keywords.
+	Directives []Directive
+}
+
+// Image returns the stage's image: its map, or the first frame of its
+// animMap. It returns the empty string for stages using special images such
+// as $lightmap or without an image at all.
+func (s *Stage) Image() string {
+	switch {
+	case s.AnimMap != nil && len(s.AnimMap.Frames) > 0:
+		return s.AnimMap.Frames[0]
+	case strings.HasPrefix(s.Map, "$"):
+		return ""
+	}
+	return s.Map
+}
+
+// BaseStage returns the first stage of the shader with an image, or nil if it
+// has none.
+func (sh *Shader) BaseStage() *Stage {
+	for _, stage := range sh.Stages {
+		if stage.Image() != "" {
+			return stage
+		}
+	}
+	return nil
+}
+
+// BaseTexture returns the image of the shader's base stage, or the empty
+// string if it has none.
+func (sh *Shader) BaseTexture() string {
+	if stage := sh.BaseStage(); stage != nil {
+		return stage.Image()
+	}
+	return ""
+}
+
+// BlendMode describes how a shader's base stage is blended with what's
+// behind it, simplified for formats that don't support arbitrary blending.
+type BlendMode int
+
+const (
+	Opaque BlendMode = iota
+	// AlphaTest stages are opaque but discard pixels failing their
+	// alphaFunc.
+	AlphaTest
+	// AlphaBlend stages are blended by their alpha.
+	AlphaBlend
+	// Additive stages are added to the colour behind them.
+	Additive
+	// Multiply stages multiply the colour behind them, as with "filter".
+	Multiply
+)
+
+func (m BlendMode) String() string {
+	switch m {
+	case Opaque:
+		return "opaque"
+	case AlphaTest:
+		return "alphatest"
+	case AlphaBlend:
+		return "blend"
+	case Additive:
+		return "add"
+	case Multiply:
+		return "multiply"
+	}
+	return "unknown"
+}
+
+// BlendMode returns the blend mode of the shader's base stage.
+func (sh *Shader) BlendMode() BlendMode {
+	stage := sh.BaseStage()
+	if stage == nil {
+		return Opaque
+	}
+
+	switch bf := stage.BlendFunc; {
+	case bf == (BlendFunc{}) || bf == (BlendFunc{"GL_ONE", "GL_ZERO"}):
+		if stage.AlphaFunc != "" {
+			return AlphaTest
+		}
+		return Opaque
+	case bf.Src == "GL_ONE" && bf.Dst == "GL_ONE":
+		return Additive
+	case bf.Dst == "GL_SRC_COLOR" || bf.Src == "GL_DST_COLOR" || bf.Src == "GL_ZERO":
+		return Multiply
+	case bf.Src == "GL_SRC_ALPHA" && bf.Dst == "GL_ONE":
+		return Additive
+	}
+	return AlphaBlend
+}
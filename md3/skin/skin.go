@@ -0,0 +1,125 @@
+// Package skin reads Quake 3 .skin files, which assign shaders to the
+// surfaces of a model in place of the shaders named by the model itself.
+package skin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// Entry assigns a shader to a surface.
+type Entry struct {
+	// Surface is the lowercased name of the surface.
+	Surface string
+	// Shader is the name of the shader or texture to use for the surface.
+	Shader string
+}
+
+// Skin maps surface names to shaders. Surface names are compared without
+// regard to case, as in Quake 3.
+type Skin struct {
+	entries []Entry
+	index   map[string]int
+}
+
+// New returns an empty skin.
+func New() *Skin {
+	return &Skin{index: make(map[string]int)}
+}
+
+// Parse reads a .skin file from r.
+//
+// Each line of a .skin file holds a surface name and a shader name separated
+// by a comma, such as "h_head,models/players/sarge/band.tga". Lines naming
+// tags, such as "tag_head,", are ignored, as are blank lines and comments.
+func Parse(r io.Reader) (*Skin, error) {
+	s := New()
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if index := strings.Index(line, "//"); index != -1 {
+			line = line[:index]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		surface, shader, ok := strings.Cut(line, ",")
+		surface = strings.Trim(strings.TrimSpace(surface), `"`)
+		shader = strings.Trim(strings.TrimSpace(shader), `"`)
+
+		// As in the engine, any surface name containing "tag_" is a tag.
+		if strings.Contains(strings.ToLower(surface), "tag_") {
+			continue
+		}
+
+		if !ok || surface == "" {
+			return nil, fmt.Errorf("skin: line %d: expected surface,shader: %q", lineNum, line)
+		}
+
+		s.Set(surface, shader)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Set assigns the shader to the named surface, replacing any shader the
+// surface already had.
+func (s *Skin) Set(surface, shader string) {
+	surface = strings.ToLower(surface)
+	if index, ok := s.index[surface]; ok {
+		s.entries[index].Shader = shader
+		return
+	}
+	s.index[surface] = len(s.entries)
+	s.entries = append(s.entries, Entry{surface, shader})
+}
+
+// Merge adds every entry of other to the skin, replacing the shaders of any
+// surfaces the skin already has.
+func (s *Skin) Merge(other *Skin) {
+	for _, entry := range other.entries {
+		s.Set(entry.Surface, entry.Shader)
+	}
+}
+
+// Entries returns the skin's entries in the order they were added.
+func (s *Skin) Entries() []Entry {
+	return append([]Entry(nil), s.entries...)
+}
+
+// Shader returns the shader the skin assigns to the named surface.
+func (s *Skin) Shader(surface string) (string, bool) {
+	index, ok := s.index[strings.ToLower(surface)]
+	if !ok {
+		return "", false
+	}
+	return s.entries[index].Shader, true
+}
+
+// Material returns the effective shader for surf: the shader the skin assigns
+// to it, if any, or else the first shader of the surface itself. If neither
+// exists, it returns the empty string. s may be nil, in which case only the
+// surface's own shader is considered.
+func (s *Skin) Material(surf *md3.Surface) string {
+	if s != nil {
+		if shader, ok := s.Shader(surf.Name()); ok {
+			return shader
+		}
+	}
+
+	if surf.NumShaders() > 0 {
+		return surf.Shader(0).Name
+	}
+	return ""
+}
@@ -0,0 +1,272 @@
+package smd
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// TagPrefix is the prefix of the names of bones that become MD3 tags without
+// being named by Options.Tags.
+const TagPrefix = "tag_"
+
+// Options control how SMD geometry is converted to MD3's axes and texture
+// space, and which bones become tags. The axes and texture space mirror the
+// go-md3 tool's SMD export options, so files it exports are read back with
+// the same settings.
+type Options struct {
+	// SwapYZ swaps the Y and Z axes of positions, normals and tags. Since
+	// that mirrors every triangle, their winding is kept as-is; otherwise
+	// triangles are reversed to MD3's clockwise winding.
+	SwapYZ bool
+	// FlipUVs flips texcoords vertically, as (1 - T).
+	FlipUVs bool
+	// Tags maps the names of bones to the names of the tags they become.
+	Tags map[string]string
+}
+
+// Pose returns the transform of each of the file's nodes into the model's
+// space, given the pose of each node relative to its parent.
+func (f *File) Pose(bones []Bone) []md3.TagFrame {
+	world := make([]md3.TagFrame, len(f.Nodes))
+	for index, node := range f.Nodes {
+		world[index] = bones[index].Frame()
+		if node.Parent >= 0 {
+			world[index] = world[node.Parent].Compose(world[index])
+		}
+	}
+	return world
+}
+
+// weights returns the links of v with their weights summing to one. Weight
+// left over by the links goes to the vertex's parent bone, as studiomdl
+// does, and links whose weights are too large are scaled down together.
+func (v *Vertex) weights() []Link {
+	var links []Link
+	var total float32
+	for _, link := range v.Links {
+		if link.Weight > 0 {
+			links = append(links, link)
+			total += link.Weight
+		}
+	}
+
+	if total < 1 {
+		links = append(links, Link{Bone: v.Parent, Weight: 1 - total})
+	} else {
+		for index := range links {
+			links[index].Weight /= total
+		}
+	}
+	return links
+}
+
+// vertex is a vertex of a surface, in the model's space in the bind pose.
+type vertex struct {
+	position, normal md3.Vec3
+	links            []Link
+}
+
+// Build bakes the reference file ref into an MD3 model with the given name,
+// skinning its triangles for each frame of anim, or for each frame of ref if
+// anim is nil or has no frames. The first frame of ref is the bind pose the
+// triangles are given in. Bones of anim are matched to those of ref by name;
+// bones anim doesn't have keep their bind pose.
+//
+// Triangles are grouped into a surface for each material, named after the
+// material's file name without its extension, whose only shader is the
+// material. Triangle corners with the same position, normal, texcoord and
+// weights share a vertex.
+//
+// Bones become tags if opts.Tags maps their names to tag names, or if their
+// names start with TagPrefix, keeping their names. Each frame's bounds are
+// computed from its vertices.
+func Build(name string, ref, anim *File, opts Options) (*md3.Model, error) {
+	if len(ref.Frames) == 0 {
+		return nil, errors.New("smd: reference has no skeleton")
+	}
+
+	frames := ref.Frames
+	animBones := make([]int, len(ref.Nodes))
+	for index := range animBones {
+		animBones[index] = index
+	}
+	if anim != nil && len(anim.Frames) > 0 {
+		frames = anim.Frames
+		byName := make(map[string]int, len(anim.Nodes))
+		for index, node := range anim.Nodes {
+			byName[node.Name] = index
+		}
+		for index, node := range ref.Nodes {
+			if animIndex, ok := byName[node.Name]; ok {
+				animBones[index] = animIndex
+			} else {
+				animBones[index] = -1
+			}
+		}
+	}
+
+	b := md3.NewModelBuilder(name)
+	surfaces := make(map[string]int)
+	used := make(map[string]bool)
+	var (
+		vertices  [][]vertex
+		texcoords [][]md3.TexCoord
+		keys      []map[string]int32
+	)
+
+	for _, tri := range ref.Triangles {
+		material := tri.Material
+		surfIndex, ok := surfaces[material]
+		if !ok {
+			surfIndex = len(vertices)
+			surfaces[material] = surfIndex
+			vertices = append(vertices, nil)
+			texcoords = append(texcoords, nil)
+			keys = append(keys, make(map[string]int32))
+
+			sb := b.AddSurface(surfaceName(material, used))
+			sb.AddShader(material)
+		}
+		sb := b.Surface(surfIndex)
+
+		var corners [3]int32
+		for k, v := range tri.Vertices {
+			links := v.weights()
+			tc := v.TexCoord
+			if opts.FlipUVs {
+				tc.T = 1 - tc.T
+			}
+
+			key := fmt.Sprint(v.Position, v.Normal, tc, links)
+			index, ok := keys[surfIndex][key]
+			if !ok {
+				index = int32(len(vertices[surfIndex]))
+				keys[surfIndex][key] = index
+				vertices[surfIndex] = append(vertices[surfIndex], vertex{v.Position, v.Normal, links})
+				texcoords[surfIndex] = append(texcoords[surfIndex], tc)
+			}
+			corners[k] = index
+		}
+
+		if opts.SwapYZ {
+			sb.AddTriangle(corners[0], corners[1], corners[2])
+		} else {
+			sb.AddTriangle(corners[2], corners[1], corners[0])
+		}
+	}
+
+	for surfIndex, tcs := range texcoords {
+		b.Surface(surfIndex).SetTexCoords(tcs)
+	}
+
+	type tag struct {
+		name   string
+		bone   int
+		frames []md3.TagFrame
+	}
+	var tagBones []*tag
+	for index, node := range ref.Nodes {
+		tagName, ok := opts.Tags[node.Name]
+		if !ok && strings.HasPrefix(strings.ToLower(node.Name), TagPrefix) {
+			tagName, ok = node.Name, true
+		}
+		if ok {
+			tagBones = append(tagBones, &tag{name: tagName, bone: index})
+		}
+	}
+
+	bind := ref.Pose(ref.Frames[0])
+	inverseBind := make([]md3.TagFrame, len(bind))
+	for index, f := range bind {
+		inverseBind[index] = f.Inverse()
+	}
+
+	local := make([]Bone, len(ref.Nodes))
+	skin := make([]md3.TagFrame, len(ref.Nodes))
+	for _, bones := range frames {
+		for index, animIndex := range animBones {
+			if animIndex >= 0 {
+				local[index] = bones[animIndex]
+			} else {
+				local[index] = ref.Frames[0][index]
+			}
+		}
+		world := ref.Pose(local)
+		for index := range skin {
+			skin[index] = world[index].Compose(inverseBind[index])
+		}
+
+		b.AddFrame("", md3.Vec3{}, md3.Vec3{}, md3.Vec3{}, 0)
+		for surfIndex, surfVertices := range vertices {
+			out := make([]md3.Vertex, len(surfVertices))
+			for index, v := range surfVertices {
+				var origin, normal md3.Vec3
+				for _, link := range v.links {
+					origin = origin.Add(skin[link.Bone].Transform(v.position).Scale(link.Weight))
+					normal = normal.Add(skin[link.Bone].Rotate(v.normal).Scale(link.Weight))
+				}
+				if normal.Len() == 0 {
+					normal = md3.Vec3{Z: 1}
+				}
+				out[index] = md3.Vertex{
+					Origin: convertVec3(origin, opts),
+					Normal: convertVec3(normal, opts).Normalize(),
+				}
+			}
+			b.Surface(surfIndex).AddVertexFrame(out)
+		}
+
+		for _, t := range tagBones {
+			t.frames = append(t.frames, convertTagFrame(world[t.bone].Orthonormalize(), opts))
+		}
+	}
+
+	for _, t := range tagBones {
+		b.AddTag(t.name, t.frames...)
+	}
+
+	b.ComputeFrameBounds()
+	return b.Build()
+}
+
+// surfaceName returns the name of the surface for the given material: the
+// material's file name without its extension, numbered if it's already used.
+func surfaceName(material string, used map[string]bool) string {
+	base := path.Base(strings.ReplaceAll(material, `\`, "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if base == "" || base == "." || base == "/" {
+		base = "default"
+	}
+
+	name := base
+	for n := 1; used[name]; n++ {
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+	used[name] = true
+	return name
+}
+
+func convertVec3(v md3.Vec3, opts Options) md3.Vec3 {
+	if opts.SwapYZ {
+		v.Y, v.Z = v.Z, v.Y
+	}
+	return v
+}
+
+// convertTagFrame returns f in MD3's axes. Swapping Y and Z swaps the frame's
+// Y and Z axes as well as their components, so the frame remains a rotation.
+func convertTagFrame(f md3.TagFrame, opts Options) md3.TagFrame {
+	if opts.SwapYZ {
+		f.YOrientation, f.ZOrientation = f.ZOrientation, f.YOrientation
+	}
+	return md3.TagFrame{
+		Origin:       convertVec3(f.Origin, opts),
+		XOrientation: convertVec3(f.XOrientation, opts),
+		YOrientation: convertVec3(f.YOrientation, opts),
+		ZOrientation: convertVec3(f.ZOrientation, opts),
+	}
+}
@@ -0,0 +1,367 @@
+// Package smd reads Valve's Studiomdl Data (SMD) files, the source format of
+// GoldSrc and Source engine models, and bakes them into MD3 models.
+//
+// An SMD file holds a skeleton and, for reference files, the triangles
+// skinned to it; animation files hold the same skeleton posed over a number
+// of frames and no triangles.
+package smd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// smdVersion is the only version of SMD files supported.
+const smdVersion = 1
+
+const (
+	// maxNodes is studiomdl's limit on the bones of a source file.
+	maxNodes = 512
+	// maxFrames is the most frames an MD3 model can hold, which bounds the
+	// frames an animation's times may add.
+	maxFrames = 1024
+)
+
+// Node is a bone of the skeleton. Parent is the index of the bone's parent,
+// which always precedes it, or -1 if it has none.
+type Node struct {
+	Name   string
+	Parent int
+}
+
+// Bone is the pose of a bone relative to its parent, or to the model if it
+// has none: its position and its rotation as angles in radians about the X,
+// Y and Z axes, applied in that order.
+type Bone struct {
+	Position md3.Vec3
+	Rotation md3.Vec3
+}
+
+// Frame returns the bone's pose as a tag frame.
+func (b Bone) Frame() md3.TagFrame {
+	sx, cx := math.Sincos(float64(b.Rotation.X))
+	sy, cy := math.Sincos(float64(b.Rotation.Y))
+	sz, cz := math.Sincos(float64(b.Rotation.Z))
+
+	return md3.TagFrame{
+		Origin:       b.Position,
+		XOrientation: md3.Vec3{X: float32(cz * cy), Y: float32(sz * cy), Z: float32(-sy)},
+		YOrientation: md3.Vec3{X: float32(cz*sy*sx - sz*cx), Y: float32(sz*sy*sx + cz*cx), Z: float32(cy * sx)},
+		ZOrientation: md3.Vec3{X: float32(cz*sy*cx + sz*sx), Y: float32(sz*sy*cx - cz*sx), Z: float32(cy * cx)},
+	}
+}
+
+// Link weights a vertex to a bone.
+type Link struct {
+	Bone   int
+	Weight float32
+}
+
+// Vertex is a corner of a triangle, given in the model's space with the
+// skeleton in its first frame. Links weight the vertex to bones; any weight
+// they leave, or all of it if there are none, goes to its parent bone.
+type Vertex struct {
+	Parent   int
+	Position md3.Vec3
+	Normal   md3.Vec3
+	TexCoord md3.TexCoord
+	Links    []Link
+}
+
+// Triangle is a triangle using the given material, with its vertices wound
+// counter-clockwise.
+type Triangle struct {
+	Material string
+	Vertices [3]Vertex
+}
+
+// File is the contents of an SMD file.
+type File struct {
+	Nodes []Node
+	// Frames holds the pose of every node in each frame. Nodes a frame
+	// doesn't give keep their pose from the frame before it, or are left at
+	// the origin in the first frame.
+	Frames    [][]Bone
+	Triangles []Triangle
+}
+
+// parser reads the lines of an SMD file, skipping blank lines and comments.
+type parser struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("smd: line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+// scan returns the next line with any leading and trailing space removed. It
+// returns false once there are no lines left.
+func (p *parser) scan() (string, bool) {
+	for p.s.Scan() {
+		p.line++
+		line := strings.TrimSpace(p.s.Text())
+		if line != "" && !strings.HasPrefix(line, "//") {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// next returns the next line, which must exist.
+func (p *parser) next() (string, error) {
+	if line, ok := p.scan(); ok {
+		return line, nil
+	}
+	if err := p.s.Err(); err != nil {
+		return "", err
+	}
+	return "", p.errorf("unexpected end of file")
+}
+
+// Parse reads an SMD file from r. Every bone referred to by the skeleton
+// and triangles is checked against the file's nodes, so a file returned
+// without error is safe to pose. Sections other than nodes, skeleton and
+// triangles, such as the vertexanimation section of VTA files, are skipped.
+func Parse(r io.Reader) (*File, error) {
+	p := &parser{s: bufio.NewScanner(r)}
+	p.s.Buffer(nil, 1<<20)
+
+	line, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if fields := strings.Fields(line); len(fields) != 2 || fields[0] != "version" {
+		return nil, p.errorf("expected version, found %q", line)
+	} else if fields[1] != strconv.Itoa(smdVersion) {
+		return nil, p.errorf("unsupported version %s", fields[1])
+	}
+
+	f := &File{}
+	for {
+		line, ok := p.scan()
+		if !ok {
+			break
+		}
+
+		var err error
+		switch line {
+		case "nodes":
+			err = p.nodes(f)
+		case "skeleton":
+			err = p.skeleton(f)
+		case "triangles":
+			err = p.triangles(f)
+		default:
+			err = p.skip()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.s.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (p *parser) nodes(f *File) error {
+	if f.Nodes != nil {
+		return p.errorf("duplicate nodes section")
+	}
+	f.Nodes = []Node{}
+
+	for {
+		line, err := p.next()
+		if err != nil || line == "end" {
+			return err
+		}
+
+		// Names are quoted and may hold spaces.
+		first, last := strings.IndexByte(line, '"'), strings.LastIndexByte(line, '"')
+		if first == -1 || first == last {
+			return p.errorf("expected a quoted node name, found %q", line)
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(line[:first]))
+		if err != nil || id != len(f.Nodes) {
+			return p.errorf("expected node %d, found %q", len(f.Nodes), line[:first])
+		}
+		parent, err := strconv.Atoi(strings.TrimSpace(line[last+1:]))
+		if err != nil || parent < -1 || parent >= id {
+			return p.errorf("invalid parent %q of node %d: parents must precede their children", line[last+1:], id)
+		}
+		if id >= maxNodes {
+			return p.errorf("more than %d nodes", maxNodes)
+		}
+
+		f.Nodes = append(f.Nodes, Node{Name: line[first+1 : last], Parent: parent})
+	}
+}
+
+func (p *parser) skeleton(f *File) error {
+	if f.Nodes == nil {
+		return p.errorf("skeleton section before nodes")
+	} else if f.Frames != nil {
+		return p.errorf("duplicate skeleton section")
+	}
+
+	var bones []Bone
+	for {
+		line, err := p.next()
+		if err != nil || line == "end" {
+			return err
+		}
+
+		fields := strings.Fields(line)
+		if fields[0] == "time" {
+			if len(fields) != 2 {
+				return p.errorf("expected a time, found %q", line)
+			}
+			time, err := strconv.Atoi(fields[1])
+			if err != nil || time < len(f.Frames) || time >= maxFrames {
+				return p.errorf("invalid time %q: times must increase and be less than %d", fields[1], maxFrames)
+			}
+
+			// Skipped times repeat the pose before them.
+			for len(f.Frames) <= time {
+				if bones == nil {
+					bones = make([]Bone, len(f.Nodes))
+				} else {
+					bones = append([]Bone(nil), bones...)
+				}
+				f.Frames = append(f.Frames, bones)
+			}
+			continue
+		}
+
+		if bones == nil {
+			return p.errorf("bone before the first time")
+		}
+		if len(fields) != 7 {
+			return p.errorf("expected a bone and 6 numbers, found %d fields", len(fields))
+		}
+		bone, err := p.index(fields[0], len(f.Nodes))
+		if err != nil {
+			return err
+		}
+		values, err := p.floats(fields[1:])
+		if err != nil {
+			return err
+		}
+		bones[bone] = Bone{
+			Position: md3.Vec3{X: values[0], Y: values[1], Z: values[2]},
+			Rotation: md3.Vec3{X: values[3], Y: values[4], Z: values[5]},
+		}
+	}
+}
+
+func (p *parser) triangles(f *File) error {
+	if f.Nodes == nil {
+		return p.errorf("triangles section before nodes")
+	}
+
+	for {
+		material, err := p.next()
+		if err != nil || material == "end" {
+			return err
+		}
+
+		tri := Triangle{Material: material}
+		for k := range tri.Vertices {
+			line, err := p.next()
+			if err != nil {
+				return err
+			}
+			if tri.Vertices[k], err = p.vertex(strings.Fields(line), len(f.Nodes)); err != nil {
+				return err
+			}
+		}
+		f.Triangles = append(f.Triangles, tri)
+	}
+}
+
+// vertex reads a vertex: its parent bone, position, normal and texcoord,
+// followed in Source's files by its number of links and each link's bone and
+// weight.
+func (p *parser) vertex(fields []string, numNodes int) (Vertex, error) {
+	var v Vertex
+	if len(fields) < 9 {
+		return v, p.errorf("expected a bone and 8 numbers, found %d fields", len(fields))
+	}
+
+	parent, err := p.index(fields[0], numNodes)
+	if err != nil {
+		return v, err
+	}
+	values, err := p.floats(fields[1:9])
+	if err != nil {
+		return v, err
+	}
+	v = Vertex{
+		Parent:   parent,
+		Position: md3.Vec3{X: values[0], Y: values[1], Z: values[2]},
+		Normal:   md3.Vec3{X: values[3], Y: values[4], Z: values[5]},
+		TexCoord: md3.TexCoord{S: values[6], T: values[7]},
+	}
+
+	links := fields[9:]
+	if len(links) == 0 {
+		return v, nil
+	}
+	numLinks, err := strconv.Atoi(links[0])
+	if err != nil || numLinks < 0 || len(links) < 1+2*numLinks {
+		return v, p.errorf("invalid link count %q for %d fields", links[0], len(links)-1)
+	}
+
+	v.Links = make([]Link, numLinks)
+	for index := range v.Links {
+		bone, err := p.index(links[1+2*index], numNodes)
+		if err != nil {
+			return v, err
+		}
+		weight, err := p.floats(links[2+2*index : 3+2*index])
+		if err != nil {
+			return v, err
+		}
+		v.Links[index] = Link{Bone: bone, Weight: weight[0]}
+	}
+	return v, nil
+}
+
+// skip skips an unsupported section.
+func (p *parser) skip() error {
+	for {
+		line, err := p.next()
+		if err != nil || line == "end" {
+			return err
+		}
+	}
+}
+
+// index reads the index of a bone of the n defined.
+func (p *parser) index(field string, n int) (int, error) {
+	index, err := strconv.Atoi(field)
+	if err != nil || index < 0 || index >= n {
+		return 0, p.errorf("invalid bone %q: %d defined", field, n)
+	}
+	return index, nil
+}
+
+func (p *parser) floats(fields []string) ([]float32, error) {
+	values := make([]float32, len(fields))
+	for index, field := range fields {
+		value, err := strconv.ParseFloat(field, 32)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", field)
+		}
+		values[index] = float32(value)
+	}
+	return values, nil
+}
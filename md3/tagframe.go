@@ -0,0 +1,146 @@
+package md3
+
+// IdentityTagFrame returns a tag frame at the origin with no rotation.
+func IdentityTagFrame() TagFrame {
+	return TagFrame{
+		XOrientation: Vec3{1, 0, 0},
+		YOrientation: Vec3{0, 1, 0},
+		ZOrientation: Vec3{0, 0, 1},
+	}
+}
+
+// LerpTagFrame interpolates between the tag frames a and b by t, where t is 0
+// for a and 1 for b, the same way the Quake 3 renderer does: the origin and
+// each axis are interpolated linearly and the axes are then normalized.
+func LerpTagFrame(a, b TagFrame, t float32) TagFrame {
+	return TagFrame{
+		Origin:       a.Origin.Lerp(b.Origin, t),
+		XOrientation: a.XOrientation.Lerp(b.XOrientation, t).Normalize(),
+		YOrientation: a.YOrientation.Lerp(b.YOrientation, t).Normalize(),
+		ZOrientation: a.ZOrientation.Lerp(b.ZOrientation, t).Normalize(),
+	}
+}
+
+// SlerpTagFrame interpolates between the tag frames a and b by t, where t is
+// 0 for a and 1 for b. Unlike LerpTagFrame, the rotation is interpolated
+// along the shortest arc between the two orientations, so the result stays
+// orthonormal and rotates at a constant rate.
+func SlerpTagFrame(a, b TagFrame, t float32) TagFrame {
+	q := a.Quat().Slerp(b.Quat(), t)
+	return TagFrameFromQuat(q, a.Origin.Lerp(b.Origin, t))
+}
+
+// TagFrameFromQuat returns a tag frame with the rotation q at origin.
+func TagFrameFromQuat(q Quat, origin Vec3) TagFrame {
+	x, y, z := q.Axes()
+	return TagFrame{origin, x, y, z}
+}
+
+// TagFrameFromMatrix returns the tag frame for the affine transform m.
+func TagFrameFromMatrix(m Mat4) TagFrame {
+	return TagFrame{
+		Origin:       Vec3{m[12], m[13], m[14]},
+		XOrientation: Vec3{m[0], m[1], m[2]},
+		YOrientation: Vec3{m[4], m[5], m[6]},
+		ZOrientation: Vec3{m[8], m[9], m[10]},
+	}
+}
+
+// TagFrameFromMatrix3x4 returns the tag frame for the affine transform m.
+func TagFrameFromMatrix3x4(m Mat3x4) TagFrame {
+	return TagFrameFromMatrix(m.Mat4())
+}
+
+// Quat returns the rotation of the tag frame. The frame's axes are assumed to
+// be orthonormal.
+func (f TagFrame) Quat() Quat {
+	return QuatFromAxes(f.XOrientation, f.YOrientation, f.ZOrientation)
+}
+
+// Matrix returns the tag frame as a 4x4 affine transform whose columns are
+// the frame's axes and origin.
+func (f TagFrame) Matrix() Mat4 {
+	x, y, z, o := f.XOrientation, f.YOrientation, f.ZOrientation, f.Origin
+	return Mat4{
+		x.X, x.Y, x.Z, 0,
+		y.X, y.Y, y.Z, 0,
+		z.X, z.Y, z.Z, 0,
+		o.X, o.Y, o.Z, 1,
+	}
+}
+
+// Matrix3x4 returns the tag frame as a 3x4 affine transform.
+func (f TagFrame) Matrix3x4() Mat3x4 {
+	return f.Matrix().Mat3x4()
+}
+
+// Orthonormalize returns the tag frame with its axes made orthonormal. The X
+// axis keeps its direction, the Y axis is made perpendicular to it, and the Z
+// axis is recomputed from the two, keeping the side of the original Z axis.
+func (f TagFrame) Orthonormalize() TagFrame {
+	x := f.XOrientation.Normalize()
+	y := f.YOrientation.Sub(x.Scale(x.Dot(f.YOrientation))).Normalize()
+	z := x.Cross(y)
+	if z.Dot(f.ZOrientation) < 0 {
+		z = z.Scale(-1)
+	}
+	return TagFrame{f.Origin, x, y, z}
+}
+
+// Rotate returns the direction v, given in the tag's space, rotated into the
+// space the tag is defined in. The tag's origin is ignored.
+func (f TagFrame) Rotate(v Vec3) Vec3 {
+	return f.XOrientation.Scale(v.X).
+		Add(f.YOrientation.Scale(v.Y)).
+		Add(f.ZOrientation.Scale(v.Z))
+}
+
+// Transform returns the point v, given in the tag's space, transformed into
+// the space the tag is defined in.
+func (f TagFrame) Transform(v Vec3) Vec3 {
+	return f.Origin.Add(f.Rotate(v))
+}
+
+// Compose returns the transform of child, a tag frame given in f's space,
+// into the space f is defined in. This is how Quake 3 positions a model on a
+// tag of its parent: if f is the parent's transform and child is the tag, the
+// result is the attached model's transform.
+func (f TagFrame) Compose(child TagFrame) TagFrame {
+	return TagFrame{
+		Origin:       f.Transform(child.Origin),
+		XOrientation: f.Rotate(child.XOrientation),
+		YOrientation: f.Rotate(child.YOrientation),
+		ZOrientation: f.Rotate(child.ZOrientation),
+	}
+}
+
+// Inverse returns the inverse of the tag frame's transform, such that
+// f.Compose(f.Inverse()) is the identity. If the frame's axes are degenerate,
+// the identity is returned.
+func (f TagFrame) Inverse() TagFrame {
+	x, y, z := f.XOrientation, f.YOrientation, f.ZOrientation
+
+	// The rows of the inverse rotation are the cross products of the axes
+	// divided by the determinant.
+	r0, r1, r2 := y.Cross(z), z.Cross(x), x.Cross(y)
+	det := x.Dot(r0)
+	if det == 0 {
+		return IdentityTagFrame()
+	}
+	inv := 1 / det
+	r0, r1, r2 = r0.Scale(inv), r1.Scale(inv), r2.Scale(inv)
+
+	result := TagFrame{
+		XOrientation: Vec3{r0.X, r1.X, r2.X},
+		YOrientation: Vec3{r0.Y, r1.Y, r2.Y},
+		ZOrientation: Vec3{r0.Z, r1.Z, r2.Z},
+	}
+	result.Origin = result.Rotate(f.Origin).Scale(-1)
+	return result
+}
+
+// Lerp interpolates the tag between frameA and frameB by frac, as
+// LerpTagFrame does.
+func (t *Tag) Lerp(frameA, frameB int, frac float32) TagFrame {
+	return LerpTagFrame(t.frames[frameA], t.frames[frameB], frac)
+}
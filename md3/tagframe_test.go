@@ -0,0 +1,141 @@
+package md3
+
+import (
+	"math"
+	"testing"
+)
+
+func tagFrameNear(a, b TagFrame) bool {
+	return vecNear(a.Origin, b.Origin) &&
+		vecNear(a.XOrientation, b.XOrientation) &&
+		vecNear(a.YOrientation, b.YOrientation) &&
+		vecNear(a.ZOrientation, b.ZOrientation)
+}
+
+// testTagFrames are rigid transforms, plus one with scaled and sheared axes,
+// which Inverse and Compose must also handle.
+var testTagFrames = []struct {
+	name string
+	f    TagFrame
+}{
+	{"identity", IdentityTagFrame()},
+	{"translation", TagFrame{Vec3{1, -2, 3}, Vec3{X: 1}, Vec3{Y: 1}, Vec3{Z: 1}}},
+	{"rotation", TagFrameFromQuat(axisAngle(Vec3{Z: 1}, math.Pi/2), Vec3{})},
+	{"rigid", TagFrameFromQuat(axisAngle(Vec3{1, 2, 3}.Normalize(), 2), Vec3{4, 5, -6})},
+	{"half turn", TagFrameFromQuat(axisAngle(Vec3{Y: 1}, math.Pi), Vec3{0, 0, 8})},
+	{"sheared", TagFrame{Vec3{1, 1, 1}, Vec3{2, 0, 0}, Vec3{0.5, 1, 0}, Vec3{0, 0, 0.5}}},
+}
+
+func TestInverse(t *testing.T) {
+	identity := IdentityTagFrame()
+	for _, tt := range testTagFrames {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := tt.f.Inverse()
+			if got := tt.f.Compose(inv); !tagFrameNear(got, identity) {
+				t.Errorf("f.Compose(f.Inverse()) = %v, want identity", got)
+			}
+			if got := inv.Compose(tt.f); !tagFrameNear(got, identity) {
+				t.Errorf("f.Inverse().Compose(f) = %v, want identity", got)
+			}
+
+			p := Vec3{3, -1, 2}
+			if got := inv.Transform(tt.f.Transform(p)); !vecNear(got, p) {
+				t.Errorf("Inverse().Transform(Transform(%v)) = %v", p, got)
+			}
+		})
+	}
+}
+
+func TestInverseDegenerate(t *testing.T) {
+	f := TagFrame{Vec3{1, 2, 3}, Vec3{X: 1}, Vec3{X: 2}, Vec3{Z: 1}}
+	if got, want := f.Inverse(), IdentityTagFrame(); got != want {
+		t.Errorf("Inverse() = %v, want %v", got, want)
+	}
+}
+
+func TestComposeMatchesMatrix(t *testing.T) {
+	for _, a := range testTagFrames {
+		for _, b := range testTagFrames {
+			got := a.f.Matrix().Mul(b.f.Matrix())
+			want := a.f.Compose(b.f).Matrix()
+			if !mat4Near(got, want) {
+				t.Errorf("%s.Matrix() * %s.Matrix() = %v, want %v", a.name, b.name, got, want)
+			}
+		}
+	}
+}
+
+func TestTransformMatchesMatrix(t *testing.T) {
+	p := Vec3{-1, 0.5, 2}
+	for _, tt := range testTagFrames {
+		if got, want := tt.f.Matrix().Transform(p), tt.f.Transform(p); !vecNear(got, want) {
+			t.Errorf("%s: Matrix().Transform(p) = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestTagFrameMatrixRoundTrip(t *testing.T) {
+	for _, tt := range testTagFrames {
+		if got := TagFrameFromMatrix(tt.f.Matrix()); got != tt.f {
+			t.Errorf("%s: TagFrameFromMatrix(Matrix()) = %v, want %v", tt.name, got, tt.f)
+		}
+		if got := TagFrameFromMatrix3x4(tt.f.Matrix3x4()); got != tt.f {
+			t.Errorf("%s: TagFrameFromMatrix3x4(Matrix3x4()) = %v, want %v", tt.name, got, tt.f)
+		}
+	}
+}
+
+func TestTagFrameQuatRoundTrip(t *testing.T) {
+	for _, tt := range testTagFrames {
+		if tt.name == "sheared" {
+			continue
+		}
+		if got := TagFrameFromQuat(tt.f.Quat(), tt.f.Origin); !tagFrameNear(got, tt.f) {
+			t.Errorf("%s: TagFrameFromQuat(Quat()) = %v, want %v", tt.name, got, tt.f)
+		}
+	}
+}
+
+func TestSlerpTagFrame(t *testing.T) {
+	a := TagFrameFromQuat(Quat{W: 1}, Vec3{})
+	b := TagFrameFromQuat(axisAngle(Vec3{Z: 1}, math.Pi/2), Vec3{2, 4, 0})
+
+	if got := SlerpTagFrame(a, b, 0); !tagFrameNear(got, a) {
+		t.Errorf("SlerpTagFrame(a, b, 0) = %v, want %v", got, a)
+	}
+	if got := SlerpTagFrame(a, b, 1); !tagFrameNear(got, b) {
+		t.Errorf("SlerpTagFrame(a, b, 1) = %v, want %v", got, b)
+	}
+
+	want := TagFrameFromQuat(axisAngle(Vec3{Z: 1}, math.Pi/4), Vec3{1, 2, 0})
+	if got := SlerpTagFrame(a, b, 0.5); !tagFrameNear(got, want) {
+		t.Errorf("SlerpTagFrame(a, b, 0.5) = %v, want %v", got, want)
+	}
+}
+
+func TestLerpTagFrame(t *testing.T) {
+	a := IdentityTagFrame()
+	b := TagFrameFromQuat(axisAngle(Vec3{Z: 1}, math.Pi/2), Vec3{2, 4, 0})
+
+	if got := LerpTagFrame(a, b, 0); !tagFrameNear(got, a) {
+		t.Errorf("LerpTagFrame(a, b, 0) = %v, want %v", got, a)
+	}
+	if got := LerpTagFrame(a, b, 1); !tagFrameNear(got, b) {
+		t.Errorf("LerpTagFrame(a, b, 1) = %v, want %v", got, b)
+	}
+
+	// Halfway between a quarter turn, each axis is normalized, which for a
+	// rotation about one axis matches the slerp.
+	want := SlerpTagFrame(a, b, 0.5)
+	if got := LerpTagFrame(a, b, 0.5); !tagFrameNear(got, want) {
+		t.Errorf("LerpTagFrame(a, b, 0.5) = %v, want %v", got, want)
+	}
+}
+
+func TestOrthonormalize(t *testing.T) {
+	f := TagFrame{Vec3{1, 2, 3}, Vec3{2, 0, 0}, Vec3{1, 3, 0}, Vec3{0, 0, -0.5}}
+	want := TagFrame{Vec3{1, 2, 3}, Vec3{X: 1}, Vec3{Y: 1}, Vec3{Z: -1}}
+	if got := f.Orthonormalize(); !tagFrameNear(got, want) {
+		t.Errorf("Orthonormalize() = %v, want %v", got, want)
+	}
+}
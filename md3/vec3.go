@@ -0,0 +1,55 @@
+package md3
+
+import "math"
+
+type Vec3 struct {
+	X, Y, Z float32
+}
+
+func (v Vec3) Add(u Vec3) Vec3 {
+	return Vec3{v.X + u.X, v.Y + u.Y, v.Z + u.Z}
+}
+
+func (v Vec3) Sub(u Vec3) Vec3 {
+	return Vec3{v.X - u.X, v.Y - u.Y, v.Z - u.Z}
+}
+
+func (v Vec3) Scale(s float32) Vec3 {
+	return Vec3{v.X * s, v.Y * s, v.Z * s}
+}
+
+func (v Vec3) Dot(u Vec3) float32 {
+	return v.X*u.X + v.Y*u.Y + v.Z*u.Z
+}
+
+func (v Vec3) Cross(u Vec3) Vec3 {
+	return Vec3{
+		v.Y*u.Z - v.Z*u.Y,
+		v.Z*u.X - v.X*u.Z,
+		v.X*u.Y - v.Y*u.X,
+	}
+}
+
+func (v Vec3) Len() float32 {
+	return float32(math.Sqrt(float64(v.Dot(v))))
+}
+
+// Normalize returns v scaled to unit length. If v has zero length, it is
+// returned unchanged.
+func (v Vec3) Normalize() Vec3 {
+	l := v.Len()
+	if l == 0 {
+		return v
+	}
+	return v.Scale(1 / l)
+}
+
+// Lerp returns the linear interpolation of v and u by t, where t is 0 for v
+// and 1 for u.
+func (v Vec3) Lerp(u Vec3, t float32) Vec3 {
+	return Vec3{
+		v.X + (u.X-v.X)*t,
+		v.Y + (u.Y-v.Y)*t,
+		v.Z + (u.Z-v.Z)*t,
+	}
+}
@@ -0,0 +1,346 @@
+package md3
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Encoder writes MD3 models to an io.Writer.
+type Encoder struct {
+	w io.Writer
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Write writes the model m to w as an MD3 file.
+func Write(w io.Writer, m *Model) error {
+	return NewEncoder(w).Encode(m)
+}
+
+// Encode writes the model m as an MD3 file. The model is checked before
+// anything is written, so an error caused by an invalid model leaves the
+// underlying writer untouched.
+//
+// Vertex origins are quantized to the format's 1/64 unit fixed-point values
+// and normals to its latitude/longitude byte pairs, so a model decoded from
+// the written file may differ slightly from m.
+func (e *Encoder) Encode(m *Model) error {
+	if err := checkModel(m); err != nil {
+		return err
+	}
+
+	var (
+		numFrames = len(m.frames)
+		numTags   = len(m.tags)
+
+		ofsFrames   = int32(md3HeaderSize)
+		ofsTags     = ofsFrames + int32(numFrames*md3FrameSize)
+		ofsSurfaces = ofsTags + int32(numFrames*numTags*md3TagSize)
+		ofsEOF      = ofsSurfaces
+	)
+
+	for _, surf := range m.surfaces {
+		ofsEOF += surfaceSize(surf)
+	}
+
+	buf := new(bytes.Buffer)
+	buf.Grow(int(ofsEOF))
+
+	header := fileHeader{
+		name:         m.name,
+		version:      md3MaxVersion,
+		num_frames:   int32(numFrames),
+		num_tags:     int32(numTags),
+		num_surfaces: int32(len(m.surfaces)),
+		ofs_frames:   ofsFrames,
+		ofs_tags:     ofsTags,
+		ofs_surfaces: ofsSurfaces,
+		ofs_eof:      ofsEOF,
+	}
+
+	if err := writeMD3Header(buf, &header); err != nil {
+		return err
+	}
+
+	for _, frame := range m.frames {
+		if err := writeFrame(buf, frame); err != nil {
+			return err
+		}
+	}
+
+	// Tags are stored frame-major: every tag for frame 0, then every tag for
+	// frame 1, and so on.
+	for frame := 0; frame < numFrames; frame++ {
+		for _, tag := range m.tags {
+			if err := writeTag(buf, tag.name, tag.frames[frame]); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, surf := range m.surfaces {
+		if err := writeSurface(buf, surf); err != nil {
+			return err
+		}
+	}
+
+	_, err := buf.WriteTo(e.w)
+	return err
+}
+
+// checkModel returns an error if m cannot be represented as an MD3 file.
+func checkModel(m *Model) error {
+	numFrames := len(m.frames)
+
+	errs := []error{
+		checkName("model", m.name, maxQPath),
+		checkCount("frame", int32(numFrames), maxFrames),
+		checkCount("tag", int32(len(m.tags)), maxTags),
+		checkCount("surface", int32(len(m.surfaces)), maxSurfaces),
+	}
+
+	for _, frame := range m.frames {
+		errs = append(errs, checkName("frame", frame.name, maxFrameLength))
+	}
+
+	for _, tag := range m.tags {
+		errs = append(errs, checkName("tag", tag.name, maxQPath))
+		if len(tag.frames) != numFrames {
+			errs = append(errs, fmt.Errorf("Tag %q has %d frames, model has %d", tag.name, len(tag.frames), numFrames))
+		}
+	}
+
+	for _, surf := range m.surfaces {
+		errs = append(errs, checkSurface(surf, numFrames))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkSurface(s *Surface, numFrames int) error {
+	numVertices := len(s.texcoords)
+
+	errs := []error{
+		checkName("surface", s.name, maxQPath),
+		checkCount("shader", int32(len(s.shaders)), maxShaders),
+		checkCount("vertex", int32(numVertices), maxVertices),
+		checkCount("triangle", int32(len(s.triangles)), maxTriangles),
+		checkTriangles(s.triangles, numVertices),
+	}
+
+	for _, shader := range s.shaders {
+		errs = append(errs, checkName("shader", shader.Name, maxQPath))
+	}
+
+	if len(s.vertices) != numFrames {
+		errs = append(errs, fmt.Errorf("Surface %q has %d frames, model has %d", s.name, len(s.vertices), numFrames))
+	}
+
+	for frame, vertices := range s.vertices {
+		if len(vertices) != numVertices {
+			errs = append(errs, fmt.Errorf("Surface %q has %d vertices in frame %d, expected %d", s.name, len(vertices), frame, numVertices))
+		}
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkName(kind, name string, maxLen int) error {
+	if len(name) >= maxLen {
+		return fmt.Errorf("Name of %s %q is too long: must be shorter than %d bytes", kind, name, maxLen)
+	}
+	return nil
+}
+
+// surfaceSize returns the size in bytes of the encoded surface s.
+func surfaceSize(s *Surface) int32 {
+	return int32(md3SurfaceHeaderSize +
+		len(s.shaders)*md3ShaderSize +
+		len(s.triangles)*md3TriangleSize +
+		len(s.texcoords)*md3TexCoordSize +
+		len(s.vertices)*len(s.texcoords)*md3VertexSize)
+}
+
+func writeMD3Header(w io.Writer, header *fileHeader) error {
+	if err := writeFixedString(w, md3HeaderIdent); err != nil {
+		return err
+	}
+
+	if err := writeS32(w, header.version); err != nil {
+		return err
+	}
+
+	if err := writeNulString(w, header.name, maxQPath); err != nil {
+		return err
+	}
+
+	s32Fields := [...]int32{
+		header.flags,
+		header.num_frames,
+		header.num_tags,
+		header.num_surfaces,
+		header.num_skins,
+		header.ofs_frames,
+		header.ofs_tags,
+		header.ofs_surfaces,
+		header.ofs_eof,
+	}
+
+	for _, x := range s32Fields {
+		if err := writeS32(w, x); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFrame(w io.Writer, frame *Frame) error {
+	if err := writeNulString(w, frame.name, maxFrameLength); err != nil {
+		return err
+	}
+
+	for _, v := range [...]Vec3{frame.min, frame.max, frame.origin} {
+		if err := writeF32Vec3(w, v); err != nil {
+			return err
+		}
+	}
+
+	return writeF32(w, frame.radius)
+}
+
+func writeTag(w io.Writer, name string, frame TagFrame) error {
+	if err := writeNulString(w, name, maxQPath); err != nil {
+		return err
+	}
+
+	vecs := [...]Vec3{
+		frame.Origin,
+		frame.XOrientation,
+		frame.YOrientation,
+		frame.ZOrientation,
+	}
+
+	for _, v := range vecs {
+		if err := writeF32Vec3(w, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeSurface writes the surface s. Its sections are laid out in the same
+// order as the Quake 3 tools write them: shaders, triangles, texcoords, then
+// vertices.
+func writeSurface(w io.Writer, s *Surface) error {
+	var (
+		numVertices = len(s.texcoords)
+
+		ofsShaders   = int32(md3SurfaceHeaderSize)
+		ofsTriangles = ofsShaders + int32(len(s.shaders)*md3ShaderSize)
+		ofsST        = ofsTriangles + int32(len(s.triangles)*md3TriangleSize)
+		ofsXYZNormal = ofsST + int32(numVertices*md3TexCoordSize)
+	)
+
+	header := surfaceHeader{
+		name:          s.name,
+		num_frames:    int32(len(s.vertices)),
+		num_shaders:   int32(len(s.shaders)),
+		num_verts:     int32(numVertices),
+		num_triangles: int32(len(s.triangles)),
+		ofs_triangles: ofsTriangles,
+		ofs_shaders:   ofsShaders,
+		ofs_st:        ofsST,
+		ofs_xyznormal: ofsXYZNormal,
+		ofs_end:       surfaceSize(s),
+	}
+
+	if err := writeSurfaceHeader(w, &header); err != nil {
+		return err
+	}
+
+	for _, shader := range s.shaders {
+		if err := writeNulString(w, shader.Name, maxQPath); err != nil {
+			return err
+		}
+		if err := writeS32(w, shader.Index); err != nil {
+			return err
+		}
+	}
+
+	for _, tri := range s.triangles {
+		for _, index := range [...]int32{tri.A, tri.B, tri.C} {
+			if err := writeS32(w, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, tc := range s.texcoords {
+		if err := writeF32(w, tc.S); err != nil {
+			return err
+		}
+		if err := writeF32(w, tc.T); err != nil {
+			return err
+		}
+	}
+
+	for _, vertices := range s.vertices {
+		for _, vert := range vertices {
+			if err := writeF16Vec3(w, vert.Origin); err != nil {
+				return err
+			}
+			if err := writeSphereNormal(w, vert.Normal); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeSurfaceHeader(w io.Writer, header *surfaceHeader) error {
+	if err := writeFixedString(w, md3SurfaceIdent); err != nil {
+		return err
+	}
+
+	if err := writeNulString(w, header.name, maxQPath); err != nil {
+		return err
+	}
+
+	s32Fields := [...]int32{
+		header.flags,
+		header.num_frames,
+		header.num_shaders,
+		header.num_verts,
+		header.num_triangles,
+		header.ofs_triangles,
+		header.ofs_shaders,
+		header.ofs_st,
+		header.ofs_xyznormal,
+		header.ofs_end,
+	}
+
+	for _, x := range s32Fields {
+		if err := writeS32(w, x); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package md3
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// quantize returns v rounded to the 1/64 unit fixed-point values MD3 files
+// store vertex origins as.
+func quantize(v Vec3) Vec3 {
+	q := func(f float32) float32 {
+		return float32(math.Floor(float64(f/md3XYZFixedScale)+0.5)) * md3XYZFixedScale
+	}
+	return Vec3{q(v.X), q(v.Y), q(v.Z)}
+}
+
+// normalTolerance is the largest angle, in radians, between a unit normal and
+// the normal read back from its latitude/longitude bytes: half a byte's step
+// in each angle.
+var normalTolerance = math.Sqrt2 * math.Pi / 255
+
+func angleBetween(a, b Vec3) float64 {
+	dot := float64(a.Normalize().Dot(b.Normalize()))
+	return math.Acos(math.Max(-1, math.Min(1, dot)))
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	want := testModel(t)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, want); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data := buf.Bytes()
+
+	got, err := Read(data)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if got.Name() != want.Name() {
+		t.Errorf("Name() = %q, want %q", got.Name(), want.Name())
+	}
+
+	if got.NumFrames() != want.NumFrames() {
+		t.Fatalf("NumFrames() = %d, want %d", got.NumFrames(), want.NumFrames())
+	}
+	for index, frame := range want.AllFrames() {
+		if g := got.Frame(index); *g != *frame {
+			t.Errorf("Frame(%d) = %+v, want %+v", index, *g, *frame)
+		}
+	}
+
+	if got.NumTags() != want.NumTags() {
+		t.Fatalf("NumTags() = %d, want %d", got.NumTags(), want.NumTags())
+	}
+	for index, tag := range want.AllTags() {
+		g := got.Tag(index)
+		if g.Name() != tag.Name() {
+			t.Errorf("Tag(%d).Name() = %q, want %q", index, g.Name(), tag.Name())
+		}
+		for frame, tf := range tag.AllFrames() {
+			if g.Frame(frame) != tf {
+				t.Errorf("tag %q frame %d = %+v, want %+v", tag.Name(), frame, g.Frame(frame), tf)
+			}
+		}
+	}
+
+	// Tags are stored frame-major: every tag of frame 0, then every tag of
+	// frame 1.
+	ofsTags := int(getS32(data, headerOfsTags))
+	for frame := range want.NumFrames() {
+		for index, tag := range want.AllTags() {
+			offset := ofsTags + (frame*want.NumTags()+index)*md3TagSize
+			name, err := readNulString(bytes.NewReader(data[offset:]), maxQPath)
+			if err != nil || name != tag.Name() {
+				t.Errorf("tag at frame %d, index %d = %q, %v; want %q", frame, index, name, err, tag.Name())
+			}
+		}
+	}
+
+	if got.NumSurfaces() != want.NumSurfaces() {
+		t.Fatalf("NumSurfaces() = %d, want %d", got.NumSurfaces(), want.NumSurfaces())
+	}
+	for index, surf := range want.AllSurfaces() {
+		g := got.Surface(index)
+		if g.Name() != surf.Name() {
+			t.Errorf("Surface(%d).Name() = %q, want %q", index, g.Name(), surf.Name())
+		}
+		if g.NumFrames() != surf.NumFrames() || g.NumVertices() != surf.NumVertices() ||
+			g.NumTriangles() != surf.NumTriangles() || g.NumShaders() != surf.NumShaders() {
+			t.Fatalf("surface %q has %d frames, %d vertices, %d triangles and %d shaders; want %d, %d, %d and %d",
+				surf.Name(), g.NumFrames(), g.NumVertices(), g.NumTriangles(), g.NumShaders(),
+				surf.NumFrames(), surf.NumVertices(), surf.NumTriangles(), surf.NumShaders())
+		}
+
+		for i, shader := range surf.AllShaders() {
+			if g.Shader(i) != shader {
+				t.Errorf("surface %q shader %d = %+v, want %+v", surf.Name(), i, g.Shader(i), shader)
+			}
+		}
+		for i, tri := range surf.AllTriangles() {
+			if g.Triangle(i) != tri {
+				t.Errorf("surface %q triangle %d = %v, want %v", surf.Name(), i, g.Triangle(i), tri)
+			}
+		}
+		for i, tc := range surf.AllTexCoords() {
+			if g.TexCoord(i) != tc {
+				t.Errorf("surface %q texcoord %d = %v, want %v", surf.Name(), i, g.TexCoord(i), tc)
+			}
+		}
+
+		for frame := range surf.NumFrames() {
+			for i, vert := range surf.AllVertices(frame) {
+				gv := g.Vertex(frame, i)
+				if o := quantize(vert.Origin); gv.Origin != o {
+					t.Errorf("surface %q frame %d vertex %d origin = %v, want %v", surf.Name(), frame, i, gv.Origin, o)
+				}
+				if angle := angleBetween(gv.Normal, vert.Normal); angle > normalTolerance {
+					t.Errorf("surface %q frame %d vertex %d normal = %v, want %v within %f radians; off by %f",
+						surf.Name(), frame, i, gv.Normal, vert.Normal, normalTolerance, angle)
+				}
+			}
+		}
+	}
+
+	// Once quantized, a model is written the same way again.
+	buf.Reset()
+	if err := Write(&buf, got); err != nil {
+		t.Fatalf("Write() of read model error = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("Write() of read model differs from the file it was read from")
+	}
+}
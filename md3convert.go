@@ -5,20 +5,44 @@ import (
 	"flag"
 	"fmt"
 	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/shader"
 	"io"
 	"log"
 	"os"
 	"path"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 const maxWriters = 8
 
 var (
-	outputPath = flag.String("o", ".", "Specify the output directory for converted OBJ file(s).")
-	flipUVs    = flag.Bool("flipUVs", true, "Enables flipping UV coordinates vertically on output.")
-	swapYZ     = flag.Bool("swapYZ", true, "Enables swapping Y and Z axes on output.")
+	outputPath    = flag.String("o", ".", "Specify the output directory for converted file(s).")
+	convertFormat = flag.String("format", "obj", "The format to convert models to: obj, smd, ply, stl, gltf, glb, dae, iqm, vat, or md3.")
+	flipUVs       = flag.Bool("flipUVs", true, "Enables flipping UV coordinates vertically on output.")
+	swapYZ        = flag.Bool("swapYZ", true, "Enables swapping Y and Z axes on output.")
+	frameList     = flag.String("frames", "", "The frames to convert, such as 0,4-7. Defaults to every frame.")
+	singleFile    = flag.Bool("singleFile", false, "Writes every converted frame to a single OBJ file instead of one file per frame.")
 )
 
+// convertFunc converts a single model, queueing any file writes on
+// writeQueue and signalling once it's done.
+type convertFunc func(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func())
+
+var convertFuncs = map[string]convertFunc{
+	"obj":  performConvertModel,
+	"smd":  performConvertSMD,
+	"ply":  frameConverter(".ply", writePLY),
+	"stl":  frameConverter(".stl", writeSTL),
+	"gltf": performConvertGLTF,
+	"glb":  performConvertGLTF,
+	"dae":  performConvertDAE,
+	"iqm":  performConvertIQM,
+	"vat":  performConvertVAT,
+	"md3":  performConvertMD3,
+}
+
 type surfaceStringPair struct {
 	surface *md3.Surface
 	value   string
@@ -31,14 +55,9 @@ func surfaceTriangleList(surf *md3.Surface, baseVertex int, output chan<- surfac
 	buffer := new(bytes.Buffer)
 	triCount := surf.NumTriangles()
 	for triIndex := 0; triIndex < triCount; triIndex++ {
-		tri := surf.Triangle(triIndex)
-		if *swapYZ {
-			_, err = fmt.Fprintf(buffer, "f %[1]d/%[1]d/%[1]d %[2]d/%[2]d/%[2]d %[3]d/%[3]d/%[3]d\n",
-				baseVertex+int(tri.A), baseVertex+int(tri.B), baseVertex+int(tri.C))
-		} else {
-			_, err = fmt.Fprintf(buffer, "f %[3]d/%[3]d/%[3]d %[2]d/%[2]d/%[2]d %[1]d/%[1]d/%[1]d\n",
-				baseVertex+int(tri.A), baseVertex+int(tri.B), baseVertex+int(tri.C))
-		}
+		tri := outputTriangle(surf.Triangle(triIndex))
+		_, err = fmt.Fprintf(buffer, "f %[1]d/%[1]d/%[1]d %[2]d/%[2]d/%[2]d %[3]d/%[3]d/%[3]d\n",
+			baseVertex+int(tri[0]), baseVertex+int(tri[1]), baseVertex+int(tri[2]))
 		if err != nil {
 			panic(err)
 		}
@@ -52,16 +71,7 @@ func surfacePosNormList(surf *md3.Surface, frame int, output chan<- surfaceStrin
 	vertCount := surf.NumVertices()
 
 	for vertIndex := 0; vertIndex < vertCount; vertIndex++ {
-		posNorm := surf.Vertex(frame, vertIndex)
-		if *swapYZ {
-			var t float32
-			t = posNorm.Origin.Y
-			posNorm.Origin.Y = posNorm.Origin.Z
-			posNorm.Origin.Z = t
-			t = posNorm.Normal.Y
-			posNorm.Normal.Y = posNorm.Normal.Z
-			posNorm.Normal.Z = t
-		}
+		posNorm := outputVertex(surf.Vertex(frame, vertIndex))
 		_, err := fmt.Fprintf(buffer,
 			"v %f %f %f\nvn %f %f %f\n",
 			posNorm.Origin.X, posNorm.Origin.Y, posNorm.Origin.Z,
@@ -128,15 +138,15 @@ func forAllSurfaces(model *md3.Model, fn surfaceMappingFunc) map[*md3.Surface]st
 // objTriangleLists produces a map of strings that can be used to write the
 // triangle lists for all frames of an MD3's surface. Special variation on the
 // forAllSurfaces function that handles base vertices (i.e., sequence is
-// much more important).
-func objTriangleLists(model *md3.Model) map[*md3.Surface]string {
+// much more important). The first surface's vertices are numbered from
+// baseVertex.
+func objTriangleLists(model *md3.Model, baseVertex int) map[*md3.Surface]string {
 	numSurfs := model.NumSurfaces()
 
 	triStrings := make(map[*md3.Surface]string, numSurfs)
 	builtPairs := make(chan surfaceStringPair)
 	waitSignal := make(chan bool)
 
-	baseVertex := 1
 	for surfaceIndex := 0; surfaceIndex < numSurfs; surfaceIndex++ {
 		surf := model.Surface(surfaceIndex)
 		go surfaceTriangleList(surf, baseVertex, builtPairs)
@@ -166,88 +176,311 @@ func objPosNormLists(model *md3.Model, frame int) map[*md3.Surface]string {
 	})
 }
 
-func writeOBJSurface(w io.Writer, surf *md3.Surface, posNorms, texCoords, triangles map[*md3.Surface]string) error {
+func writeOBJSurface(w io.Writer, surf *md3.Surface, material string, posNorms, texCoords, triangles map[*md3.Surface]string) error {
 	fmt.Fprintf(w, "g %s\n", surf.Name())
+	if material != "" {
+		fmt.Fprintf(w, "usemtl %s\n", material)
+	}
 	n, err := io.WriteString(w, posNorms[surf])
 	if err != nil {
 		return err
 	} else if n < len(posNorms[surf]) {
-		return fmt.Errorf("Error writing positions and normals: only %d of %d bytes written")
+		return fmt.Errorf("Error writing positions and normals: only %d of %d bytes written", n, len(posNorms[surf]))
 	}
 	n, err = io.WriteString(w, texCoords[surf])
 	if err != nil {
 		return err
 	} else if n < len(texCoords[surf]) {
-		return fmt.Errorf("Error writing texcoords: only %d of %d bytes written")
+		return fmt.Errorf("Error writing texcoords: only %d of %d bytes written", n, len(texCoords[surf]))
 	}
 	n, err = io.WriteString(w, triangles[surf])
 	if n < len(triangles[surf]) {
-		return fmt.Errorf("Error writing triangles: only %d of %d bytes written")
+		return fmt.Errorf("Error writing triangles: only %d of %d bytes written", n, len(triangles[surf]))
 	}
 	return err
 }
 
-func performConvertModel(modelPath string, model *md3.Model, signal chan<- bool, writeQueue chan<- func()) {
+// outputVec3 returns v with its Y and Z axes swapped if -swapYZ is set.
+func outputVec3(v md3.Vec3) md3.Vec3 {
+	if *swapYZ {
+		v.Y, v.Z = v.Z, v.Y
+	}
+	return v
+}
+
+// outputVertex returns vert with its origin and normal passed through
+// outputVec3.
+func outputVertex(vert md3.Vertex) md3.Vertex {
+	vert.Origin = outputVec3(vert.Origin)
+	vert.Normal = outputVec3(vert.Normal)
+	return vert
+}
 
-	waitSignal := make(chan bool)
-	triLists := objTriangleLists(model)
-	tcLists := objTexCoordLists(model)
+// outputTagFrame returns the tag frame f as the same transform in the output
+// axes. Swapping Y and Z swaps the frame's Y and Z axes as well as their
+// components, so the frame remains a rotation.
+func outputTagFrame(f md3.TagFrame) md3.TagFrame {
+	if *swapYZ {
+		f.YOrientation, f.ZOrientation = f.ZOrientation, f.YOrientation
+	}
+	return md3.TagFrame{
+		Origin:       outputVec3(f.Origin),
+		XOrientation: outputVec3(f.XOrientation),
+		YOrientation: outputVec3(f.YOrientation),
+		ZOrientation: outputVec3(f.ZOrientation),
+	}
+}
 
-	var _ = triLists
-	var _ = tcLists
+// outputTriangle returns the vertex indices of tri in counter-clockwise order
+// in the output axes. MD3 triangles are wound clockwise, so they're reversed
+// unless swapping Y and Z has already mirrored them.
+func outputTriangle(tri md3.Triangle) [3]int32 {
+	if *swapYZ {
+		return [3]int32{tri.A, tri.B, tri.C}
+	}
+	return [3]int32{tri.C, tri.B, tri.A}
+}
 
-	name := path.Base(modelPath)
+// outputName returns the name of the files converted from the model at the
+// given path, without an extension, and creates the output directory they'll
+// be written to. The first file of a sequence of OBJ frames, name+0.obj,
+// names the whole sequence, so its files are named after name.
+func outputName(modelPath string) (dir, name string) {
+	name = pathBase(modelPath)
+	if match := objSequencePattern.FindStringSubmatch(name); match != nil {
+		name = match[1] + match[2]
+	}
 	name = name[:len(name)-len(path.Ext(name))]
-	dir := path.Clean(*outputPath)
+	dir = path.Clean(*outputPath)
 	os.MkdirAll(dir, 0755)
+	return dir, name
+}
 
-	numFrames := model.NumFrames()
+// parseFrameList parses a list of frames, such as "0,4-7,9", into the frame
+// indices it selects, in the order given. An empty list selects every frame.
+func parseFrameList(list string, numFrames int) ([]int, error) {
+	var frames []int
+	if list == "" {
+		for frame := 0; frame < numFrames; frame++ {
+			frames = append(frames, frame)
+		}
+		return frames, nil
+	}
 
-	for frame := 0; frame < numFrames; frame++ {
-		go func(frame int) {
-			writeQueue <- func() {
-				defer func(waitSignal chan<- bool) {
-					go func() { waitSignal <- true }()
-				}(waitSignal)
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		if !isRange {
+			last = first
+		}
 
-				var err error
-				var file *os.File
-				outName := fmt.Sprintf("%s+%d.obj", name, frame)
-				outPath := path.Join(dir, outName)
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid frame %q in frame list %q", item, list)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid frame %q in frame list %q", item, list)
+		}
 
-				file, err = os.Create(outPath)
-				if err != nil {
-					log.Println("Error creating", outPath, "from", modelPath, "->", err)
+		if from > to || from < 0 || to >= numFrames {
+			return nil, fmt.Errorf("Frames %q are out of range: model has %d frames", item, numFrames)
+		}
+
+		for frame := from; frame <= to; frame++ {
+			frames = append(frames, frame)
+		}
+	}
+
+	return frames, nil
+}
+
+// objMaterials returns the material of each of the model's surfaces, resolved
+// with its skin, and the distinct materials in the order surfaces first use
+// them.
+func objMaterials(pair *modelPathPair) (materials map[*md3.Surface]string, distinct []string) {
+	materials = make(map[*md3.Surface]string, pair.model.NumSurfaces())
+	for _, surf := range pair.model.AllSurfaces() {
+		material := pair.skin.Material(surf)
+		materials[surf] = material
+		if material != "" && !slices.Contains(distinct, material) {
+			distinct = append(distinct, material)
+		}
+	}
+	return materials, distinct
+}
+
+// writeMTL writes a material library holding a material for each of the
+// given shader names, each using its shader's image, as resolved by
+// resolveMaterial, as its diffuse texture.
+func writeMTL(w io.Writer, shaders *shader.Resolver, materials []string) error {
+	for _, material := range materials {
+		if _, err := fmt.Fprintf(w, "newmtl %s\nKd 1.000000 1.000000 1.000000\n", material); err != nil {
+			return err
+		}
+		if texture, _ := resolveMaterial(shaders, material); texture != "" {
+			if _, err := fmt.Fprintf(w, "map_Kd %s\n", texture); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOBJFrame writes a single frame of the model as an object, with the
+// model's surfaces as groups. The triangles refer to the frame's vertices
+// starting at baseVertex.
+func writeOBJFrame(w io.Writer, model *md3.Model, objName string, frame, baseVertex int, materials, tcLists map[*md3.Surface]string) error {
+	if _, err := fmt.Fprintf(w, "o %s\n", objName); err != nil {
+		return err
+	}
+
+	triLists := objTriangleLists(model, baseVertex)
+	posNorms := objPosNormLists(model, frame)
+	for _, surf := range model.AllSurfaces() {
+		if err := writeOBJSurface(w, surf, materials[surf], posNorms, tcLists, triLists); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// performConvertModel converts the model in pair to OBJ files: one per frame
+// selected by -frames, or a single file holding each selected frame as a
+// separate object if -singleFile is set. The materials of the model's
+// surfaces are written to a companion MTL file.
+func performConvertModel(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	modelPath, model := pair.path, pair.model
+
+	frames, err := parseFrameList(*frameList, model.NumFrames())
+	if err != nil {
+		log.Println("Error selecting frames of", modelPath, "->", err)
+		signal <- true
+		return
+	}
+
+	waitSignal := make(chan bool)
+	tcLists := objTexCoordLists(model)
+	materials, distinctMaterials := objMaterials(pair)
+
+	dir, name := outputName(modelPath)
+
+	mtlName := ""
+	if len(distinctMaterials) > 0 {
+		mtlName = name + ".mtl"
+	}
+
+	// writeOBJ queues a write of the given frames to a single OBJ file.
+	writeOBJ := func(outName string, frames []int) {
+		writeQueue <- func() {
+			defer func(waitSignal chan<- bool) {
+				go func() { waitSignal <- true }()
+			}(waitSignal)
+
+			outPath := path.Join(dir, outName)
+			file, err := os.Create(outPath)
+			if err != nil {
+				log.Println("Error creating", outPath, "from", modelPath, "->", err)
+				return
+			}
+			defer file.Close()
+
+			if mtlName != "" {
+				if _, err = fmt.Fprintf(file, "mtllib %s\n", mtlName); err != nil {
+					log.Println("Error writing header for", outPath, "from", modelPath, "->", err)
 					return
 				}
-				defer file.Close()
+			}
+
+			baseVertex := 1
+			for _, frame := range frames {
+				objName := model.Name()
+				if *singleFile {
+					objName = fmt.Sprintf("%s+%d", model.Name(), frame)
+				}
 
-				_, err = fmt.Fprintf(file, "o %s\n", model.Name())
+				err = writeOBJFrame(file, model, objName, frame, baseVertex, materials, tcLists)
 				if err != nil {
-					log.Println("Error writing header for", outPath, "from", modelPath, "->", err)
+					log.Println("Error writing frame", frame, "for", outPath, "from", modelPath, "->", err)
+					return
 				}
 
-				numSurfaces := model.NumSurfaces()
-				posNorms := objPosNormLists(model, frame)
-				for surfIndex := 0; surfIndex < numSurfaces; surfIndex++ {
-					surf := model.Surface(surfIndex)
-					err = writeOBJSurface(file, surf, posNorms, tcLists, triLists)
-					if err != nil {
-						log.Println("Error writing surface for", outPath, "from", modelPath, "->", err)
-						return
-					}
+				for _, surf := range model.AllSurfaces() {
+					baseVertex += surf.NumVertices()
 				}
 			}
-		}(frame)
+		}
 	}
 
-	for frame := 0; frame < numFrames; frame++ {
+	numWrites := 0
+	if mtlName != "" {
+		numWrites++
+		writeQueue <- func() {
+			defer func(waitSignal chan<- bool) {
+				go func() { waitSignal <- true }()
+			}(waitSignal)
+
+			mtlPath := path.Join(dir, mtlName)
+			file, err := os.Create(mtlPath)
+			if err != nil {
+				log.Println("Error creating", mtlPath, "from", modelPath, "->", err)
+				return
+			}
+			defer file.Close()
+
+			if err := writeMTL(file, pair.shaders, distinctMaterials); err != nil {
+				log.Println("Error writing", mtlPath, "from", modelPath, "->", err)
+			}
+		}
+	}
+
+	if *singleFile {
+		numWrites++
+		go writeOBJ(name+".obj", frames)
+	} else {
+		for _, frame := range frames {
+			numWrites++
+			go writeOBJ(fmt.Sprintf("%s+%d.obj", name, frame), []int{frame})
+		}
+	}
+
+	for ; numWrites > 0; numWrites-- {
 		<-waitSignal
 	}
 
 	signal <- true
 }
 
+// performConvertMD3 writes the model in pair as an MD3 file. This is chiefly
+// useful for models imported from other formats.
+func performConvertMD3(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	modelPath := pair.path
+	dir, name := outputName(modelPath)
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		outPath := path.Join(dir, name+".md3")
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if err := md3.Write(file, pair.model); err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+		}
+	}
+	<-done
+
+	signal <- true
+}
+
 // writeFunnelProcess simply loops over the input channel and calls each
 // function it receives. It's used only as a means of funneling file creation
 // and writing through a limited number of ports to prevent exceeding the number
@@ -258,7 +491,7 @@ func writeFunnelProcess(input <-chan func()) {
 	}
 }
 
-func convertModelsToOBJProcess(input <-chan *modelPathPair, done chan<- bool) {
+func convertModelsProcess(input <-chan *modelPathPair, convert convertFunc, done chan<- bool) {
 	count := 0
 	doneSignal := make(chan bool)
 	writeQueue := make(chan func())
@@ -268,7 +501,7 @@ func convertModelsToOBJProcess(input <-chan *modelPathPair, done chan<- bool) {
 	}
 
 	for pair := range input {
-		go performConvertModel(pair.path, pair.model, doneSignal, writeQueue)
+		go convert(pair, doneSignal, writeQueue)
 		count++
 	}
 
@@ -279,11 +512,16 @@ func convertModelsToOBJProcess(input <-chan *modelPathPair, done chan<- bool) {
 	done <- true
 }
 
-func convertModelsToOBJ() (chan<- *modelPathPair, <-chan bool) {
+func convertModels() (chan<- *modelPathPair, <-chan bool) {
+	convert, ok := convertFuncs[*convertFormat]
+	if !ok {
+		panic(fmt.Errorf("Invalid format: %q", *convertFormat))
+	}
+
 	input := make(chan *modelPathPair)
 	done := make(chan bool)
 
-	go convertModelsToOBJProcess(input, done)
+	go convertModelsProcess(input, convert, done)
 
 	return input, done
 }
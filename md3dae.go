@@ -0,0 +1,670 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/shader"
+)
+
+const (
+	daeNamespace = "http://www.collada.org/2005/11/COLLADASchema"
+	daeVersion   = "1.4.1"
+
+	// daeTexCoordSet is the name materials bind their texture coordinates
+	// to.
+	daeTexCoordSet = "UVSET0"
+)
+
+type daeDocument struct {
+	XMLName     xml.Name        `xml:"COLLADA"`
+	Xmlns       string          `xml:"xmlns,attr"`
+	Version     string          `xml:"version,attr"`
+	Asset       daeAsset        `xml:"asset"`
+	Images      []daeImage      `xml:"library_images>image"`
+	Effects     []daeEffect     `xml:"library_effects>effect"`
+	Materials   []daeMaterial   `xml:"library_materials>material"`
+	Geometries  []daeGeometry   `xml:"library_geometries>geometry"`
+	Controllers []daeController `xml:"library_controllers>controller"`
+	Animations  []daeAnimation  `xml:"library_animations>animation"`
+	Clips       []daeClip       `xml:"library_animation_clips>animation_clip"`
+	Scenes      []daeNodeList   `xml:"library_visual_scenes>visual_scene"`
+	Scene       daeURL          `xml:"scene>instance_visual_scene"`
+}
+
+type daeAsset struct {
+	Tool     string `xml:"contributor>authoring_tool"`
+	Created  string `xml:"created"`
+	Modified string `xml:"modified"`
+	UpAxis   string `xml:"up_axis"`
+}
+
+type daeURL struct {
+	URL string `xml:"url,attr"`
+}
+
+type daeImage struct {
+	ID       string `xml:"id,attr"`
+	Name     string `xml:"name,attr,omitempty"`
+	InitFrom string `xml:"init_from"`
+}
+
+type daeEffect struct {
+	ID      string     `xml:"id,attr"`
+	Profile daeProfile `xml:"profile_COMMON"`
+}
+
+type daeProfile struct {
+	Params    []daeNewParam `xml:"newparam"`
+	Technique daeTechnique  `xml:"technique"`
+}
+
+type daeNewParam struct {
+	Sid     string      `xml:"sid,attr"`
+	Surface *daeSurface `xml:"surface"`
+	Sampler *string     `xml:"sampler2D>source"`
+}
+
+type daeSurface struct {
+	Type     string `xml:"type,attr"`
+	InitFrom string `xml:"init_from"`
+}
+
+type daeTechnique struct {
+	Sid     string     `xml:"sid,attr"`
+	Diffuse daeDiffuse `xml:"lambert>diffuse"`
+}
+
+type daeDiffuse struct {
+	Color   string      `xml:"color,omitempty"`
+	Texture *daeTexture `xml:"texture"`
+}
+
+type daeTexture struct {
+	Texture  string `xml:"texture,attr"`
+	TexCoord string `xml:"texcoord,attr"`
+}
+
+type daeMaterial struct {
+	ID     string `xml:"id,attr"`
+	Name   string `xml:"name,attr,omitempty"`
+	Effect daeURL `xml:"instance_effect"`
+}
+
+type daeGeometry struct {
+	ID   string  `xml:"id,attr"`
+	Name string  `xml:"name,attr,omitempty"`
+	Mesh daeMesh `xml:"mesh"`
+}
+
+type daeMesh struct {
+	Sources   []daeSource  `xml:"source"`
+	Vertices  daeVertices  `xml:"vertices"`
+	Triangles daeTriangles `xml:"triangles"`
+}
+
+type daeSource struct {
+	ID       string      `xml:"id,attr"`
+	Floats   *daeArray   `xml:"float_array"`
+	IDRefs   *daeArray   `xml:"IDREF_array"`
+	Names    *daeArray   `xml:"Name_array"`
+	Accessor daeAccessor `xml:"technique_common>accessor"`
+}
+
+type daeArray struct {
+	ID     string `xml:"id,attr"`
+	Count  int    `xml:"count,attr"`
+	Values string `xml:",chardata"`
+}
+
+type daeAccessor struct {
+	Source string     `xml:"source,attr"`
+	Count  int        `xml:"count,attr"`
+	Stride int        `xml:"stride,attr"`
+	Params []daeParam `xml:"param"`
+}
+
+type daeParam struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type daeVertices struct {
+	ID     string     `xml:"id,attr"`
+	Inputs []daeInput `xml:"input"`
+}
+
+type daeInput struct {
+	Semantic string `xml:"semantic,attr"`
+	Source   string `xml:"source,attr"`
+	Offset   string `xml:"offset,attr,omitempty"`
+	Set      string `xml:"set,attr,omitempty"`
+}
+
+type daeTriangles struct {
+	Count    int        `xml:"count,attr"`
+	Material string     `xml:"material,attr,omitempty"`
+	Inputs   []daeInput `xml:"input"`
+	Indices  string     `xml:"p"`
+}
+
+type daeController struct {
+	ID    string   `xml:"id,attr"`
+	Name  string   `xml:"name,attr,omitempty"`
+	Morph daeMorph `xml:"morph"`
+}
+
+type daeMorph struct {
+	Source  string      `xml:"source,attr"`
+	Method  string      `xml:"method,attr"`
+	Sources []daeSource `xml:"source"`
+	Targets []daeInput  `xml:"targets>input"`
+}
+
+type daeAnimation struct {
+	ID       string         `xml:"id,attr"`
+	Name     string         `xml:"name,attr,omitempty"`
+	Sources  []daeSource    `xml:"source"`
+	Samplers []daeSampler   `xml:"sampler"`
+	Channels []daeChannel   `xml:"channel"`
+	Children []daeAnimation `xml:"animation"`
+}
+
+type daeSampler struct {
+	ID     string     `xml:"id,attr"`
+	Inputs []daeInput `xml:"input"`
+}
+
+type daeChannel struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type daeClip struct {
+	ID        string   `xml:"id,attr"`
+	Name      string   `xml:"name,attr,omitempty"`
+	Start     float32  `xml:"start,attr"`
+	End       float32  `xml:"end,attr"`
+	Instances []daeURL `xml:"instance_animation"`
+}
+
+type daeNodeList struct {
+	ID    string    `xml:"id,attr"`
+	Name  string    `xml:"name,attr,omitempty"`
+	Nodes []daeNode `xml:"node"`
+}
+
+type daeNode struct {
+	ID          string        `xml:"id,attr"`
+	Name        string        `xml:"name,attr,omitempty"`
+	Sid         string        `xml:"sid,attr,omitempty"`
+	Matrix      *daeMatrix    `xml:"matrix"`
+	Controllers []daeInstance `xml:"instance_controller"`
+	Geometries  []daeInstance `xml:"instance_geometry"`
+	Children    []daeNode     `xml:"node"`
+}
+
+type daeMatrix struct {
+	Sid    string `xml:"sid,attr"`
+	Values string `xml:",chardata"`
+}
+
+type daeInstance struct {
+	URL       string                `xml:"url,attr"`
+	Materials []daeInstanceMaterial `xml:"bind_material>technique_common>instance_material"`
+}
+
+type daeInstanceMaterial struct {
+	Symbol string               `xml:"symbol,attr"`
+	Target string               `xml:"target,attr"`
+	Bind   []daeBindVertexInput `xml:"bind_vertex_input"`
+}
+
+type daeBindVertexInput struct {
+	Semantic      string `xml:"semantic,attr"`
+	InputSemantic string `xml:"input_semantic,attr"`
+	InputSet      int    `xml:"input_set,attr"`
+}
+
+// daeFloats formats values as the contents of a float_array.
+func daeFloats(values []float32) string {
+	var sb strings.Builder
+	for index, value := range values {
+		if index > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(strconv.FormatFloat(float64(value), 'g', -1, 32))
+	}
+	return sb.String()
+}
+
+// daeFloatSource returns a source of float values, read in groups of the
+// given parameters.
+func daeFloatSource(id string, values []float32, params ...daeParam) daeSource {
+	return daeSource{
+		ID:     id,
+		Floats: &daeArray{ID: id + "-array", Count: len(values), Values: daeFloats(values)},
+		Accessor: daeAccessor{
+			Source: "#" + id + "-array",
+			Count:  len(values) / len(params),
+			Stride: len(params),
+			Params: params,
+		},
+	}
+}
+
+// daeFloatParams returns float parameters with the given names.
+func daeFloatParams(names ...string) []daeParam {
+	params := make([]daeParam, len(names))
+	for index, name := range names {
+		params[index] = daeParam{Name: name, Type: "float"}
+	}
+	return params
+}
+
+// daeMatrixValues returns the tag frame tf as the 16 values of a COLLADA
+// matrix, which are written row by row.
+func daeMatrixValues(tf md3.TagFrame) []float32 {
+	x, y, z, o := tf.XOrientation, tf.YOrientation, tf.ZOrientation, tf.Origin
+	return []float32{
+		x.X, y.X, z.X, o.X,
+		x.Y, y.Y, z.Y, o.Y,
+		x.Z, y.Z, z.Z, o.Z,
+		0, 0, 0, 1,
+	}
+}
+
+// daeBuilder accumulates a COLLADA document.
+type daeBuilder struct {
+	doc     daeDocument
+	shaders *shader.Resolver
+}
+
+// addMaterial returns the ID of the material for the given shader name,
+// adding it if it doesn't exist yet, with the shader's image as its diffuse
+// texture.
+func (b *daeBuilder) addMaterial(name string) string {
+	for _, material := range b.doc.Materials {
+		if material.Name == name {
+			return material.ID
+		}
+	}
+
+	index := len(b.doc.Materials)
+	effect := daeEffect{
+		ID: fmt.Sprintf("material%d-effect", index),
+		Profile: daeProfile{Technique: daeTechnique{
+			Sid:     "common",
+			Diffuse: daeDiffuse{Color: "1 1 1 1"},
+		}},
+	}
+
+	if texture, _ := resolveMaterial(b.shaders, name); texture != "" {
+		image := daeImage{
+			ID:       fmt.Sprintf("material%d-image", index),
+			Name:     texture,
+			InitFrom: (&url.URL{Path: texture}).EscapedPath(),
+		}
+		b.doc.Images = append(b.doc.Images, image)
+
+		sampler := "surface"
+		effect.Profile.Params = []daeNewParam{
+			{Sid: "surface", Surface: &daeSurface{Type: "2D", InitFrom: image.ID}},
+			{Sid: "sampler", Sampler: &sampler},
+		}
+		effect.Profile.Technique.Diffuse = daeDiffuse{
+			Texture: &daeTexture{Texture: "sampler", TexCoord: daeTexCoordSet},
+		}
+	}
+
+	b.doc.Effects = append(b.doc.Effects, effect)
+	material := daeMaterial{
+		ID:     fmt.Sprintf("material%d", index),
+		Name:   name,
+		Effect: daeURL{URL: "#" + effect.ID},
+	}
+	b.doc.Materials = append(b.doc.Materials, material)
+	return material.ID
+}
+
+// addGeometry adds a geometry holding the surface in the given frame and
+// returns its ID. Positions and normals are inputs of its vertices, so
+// morph targets replace both.
+func (b *daeBuilder) addGeometry(surf *md3.Surface, id, name string, frame int) string {
+	numVertices := surf.NumVertices()
+	positions := make([]float32, 0, 3*numVertices)
+	normals := make([]float32, 0, 3*numVertices)
+	texcoords := make([]float32, 0, 2*numVertices)
+	for index, vert := range surf.AllVertices(frame) {
+		vert = outputVertex(vert)
+		positions = appendVec3(positions, vert.Origin)
+		normals = appendVec3(normals, vert.Normal)
+		tc := surf.TexCoord(index)
+		if *flipUVs {
+			tc.T = 1.0 - tc.T
+		}
+		texcoords = append(texcoords, tc.S, tc.T)
+	}
+
+	indices := make([]string, 0, 3*surf.NumTriangles())
+	for _, tri := range surf.AllTriangles() {
+		for _, index := range outputTriangle(tri) {
+			indices = append(indices, strconv.Itoa(int(index)))
+		}
+	}
+
+	b.doc.Geometries = append(b.doc.Geometries, daeGeometry{
+		ID:   id,
+		Name: name,
+		Mesh: daeMesh{
+			Sources: []daeSource{
+				daeFloatSource(id+"-positions", positions, daeFloatParams("X", "Y", "Z")...),
+				daeFloatSource(id+"-normals", normals, daeFloatParams("X", "Y", "Z")...),
+				daeFloatSource(id+"-texcoords", texcoords, daeFloatParams("S", "T")...),
+			},
+			Vertices: daeVertices{
+				ID: id + "-vertices",
+				Inputs: []daeInput{
+					{Semantic: "POSITION", Source: "#" + id + "-positions"},
+					{Semantic: "NORMAL", Source: "#" + id + "-normals"},
+				},
+			},
+			Triangles: daeTriangles{
+				Count:    surf.NumTriangles(),
+				Material: "material",
+				Inputs: []daeInput{
+					{Semantic: "VERTEX", Source: "#" + id + "-vertices", Offset: "0"},
+					{Semantic: "TEXCOORD", Source: "#" + id + "-texcoords", Offset: "0", Set: "0"},
+				},
+				Indices: strings.Join(indices, " "),
+			},
+		},
+	})
+	return id
+}
+
+// addSurface adds the surface surf as a geometry in its first frame. If the
+// model has more frames, a morph controller is added as well, with a target
+// geometry for each following frame; its weights select one frame at a
+// time. It returns the instance placing the surface in the scene.
+func (b *daeBuilder) addSurface(model *md3.Model, surfIndex int, surf *md3.Surface, material string) daeInstance {
+	id := fmt.Sprintf("surface%d", surfIndex)
+	instance := daeInstance{URL: "#" + b.addGeometry(surf, id, surf.Name(), 0)}
+
+	if material != "" {
+		instance.Materials = []daeInstanceMaterial{{
+			Symbol: "material",
+			Target: "#" + b.addMaterial(material),
+			Bind: []daeBindVertexInput{{
+				Semantic:      daeTexCoordSet,
+				InputSemantic: "TEXCOORD",
+			}},
+		}}
+	}
+
+	numTargets := model.NumFrames() - 1
+	if numTargets <= 0 {
+		return instance
+	}
+
+	targets := make([]string, numTargets)
+	for frame := 1; frame <= numTargets; frame++ {
+		targets[frame-1] = b.addGeometry(surf, fmt.Sprintf("%s-frame%d", id, frame), frameName(model, frame), frame)
+	}
+
+	morph := id + "-morph"
+	b.doc.Controllers = append(b.doc.Controllers, daeController{
+		ID:   morph,
+		Name: surf.Name(),
+		Morph: daeMorph{
+			Source: instance.URL,
+			Method: "NORMALIZED",
+			Sources: []daeSource{
+				{
+					ID:     morph + "-targets",
+					IDRefs: &daeArray{ID: morph + "-targets-array", Count: numTargets, Values: strings.Join(targets, " ")},
+					Accessor: daeAccessor{
+						Source: "#" + morph + "-targets-array",
+						Count:  numTargets,
+						Stride: 1,
+						Params: []daeParam{{Name: "IDREF", Type: "IDREF"}},
+					},
+				},
+				daeFloatSource(morph+"-weights", make([]float32, numTargets), daeFloatParams("MORPH_WEIGHT")...),
+			},
+			Targets: []daeInput{
+				{Semantic: "MORPH_TARGET", Source: "#" + morph + "-targets"},
+				{Semantic: "MORPH_WEIGHT", Source: "#" + morph + "-weights"},
+			},
+		},
+	})
+
+	instance.URL = "#" + morph
+	return instance
+}
+
+// daeChannelAnimation returns an animation of a single channel, linearly
+// interpolating the given keys of the target. Each key is stride values.
+func daeChannelAnimation(id, target string, times, keys []float32, param daeParam, stride int) daeAnimation {
+	interpolations := make([]string, len(times))
+	for index := range interpolations {
+		interpolations[index] = "LINEAR"
+	}
+
+	output := daeFloatSource(id+"-output", keys, param)
+	output.Accessor.Count, output.Accessor.Stride = len(times), stride
+
+	return daeAnimation{
+		ID: id,
+		Sources: []daeSource{
+			daeFloatSource(id+"-input", times, daeFloatParams("TIME")...),
+			output,
+			{
+				ID:    id + "-interpolation",
+				Names: &daeArray{ID: id + "-interpolation-array", Count: len(times), Values: strings.Join(interpolations, " ")},
+				Accessor: daeAccessor{
+					Source: "#" + id + "-interpolation-array",
+					Count:  len(times),
+					Stride: 1,
+					Params: []daeParam{{Name: "INTERPOLATION", Type: "Name"}},
+				},
+			},
+		},
+		Samplers: []daeSampler{{
+			ID: id + "-sampler",
+			Inputs: []daeInput{
+				{Semantic: "INPUT", Source: "#" + id + "-input"},
+				{Semantic: "OUTPUT", Source: "#" + id + "-output"},
+				{Semantic: "INTERPOLATION", Source: "#" + id + "-interpolation"},
+			},
+		}},
+		Channels: []daeChannel{{Source: "#" + id + "-sampler", Target: target}},
+	}
+}
+
+// addAnimations adds an animation playing the given ranges of frames one
+// after another, and a clip for each range covering its part of the
+// animation. Morph weights select each frame in turn and each tag node's
+// matrix is set to the tag's transform in that frame.
+func (b *daeBuilder) addAnimations(model *md3.Model, morphs []string, tagNodes []string, ranges []animationRange) {
+	a := daeAnimation{ID: "frames"}
+
+	var times []float32
+	var frames []int
+	var start float64
+	for index, r := range ranges {
+		first := len(times)
+		for step, frame := range r.frames {
+			times = append(times, float32(start+float64(step)/r.fps))
+			frames = append(frames, frame)
+		}
+		start += float64(len(r.frames)) / r.fps
+
+		b.doc.Clips = append(b.doc.Clips, daeClip{
+			ID:        fmt.Sprintf("clip%d", index),
+			Name:      r.name,
+			Start:     times[first],
+			End:       times[len(times)-1],
+			Instances: []daeURL{{URL: "#" + a.ID}},
+		})
+	}
+
+	if numTargets := model.NumFrames() - 1; numTargets > 0 {
+		weights := make([]float32, len(frames))
+		for target := range numTargets {
+			for step, frame := range frames {
+				weights[step] = 0
+				if frame == target+1 {
+					weights[step] = 1
+				}
+			}
+
+			// Weights are only keyed where they're nonzero or next to a
+			// nonzero key, and at the ends of the animation; linear
+			// interpolation gives zero everywhere else.
+			var keyTimes, keys []float32
+			for step, weight := range weights {
+				if step == 0 || step == len(weights)-1 || weight != 0 ||
+					weights[step-1] != 0 || weights[step+1] != 0 {
+					keyTimes = append(keyTimes, times[step])
+					keys = append(keys, weight)
+				}
+			}
+
+			for _, morph := range morphs {
+				a.Children = append(a.Children, daeChannelAnimation(
+					fmt.Sprintf("%s-weight%d", morph, target),
+					fmt.Sprintf("%s-weights(%d)", morph, target),
+					keyTimes, keys, daeParam{Name: "MORPH_WEIGHT", Type: "float"}, 1))
+			}
+		}
+	}
+
+	for index, tag := range model.AllTags() {
+		matrices := make([]float32, 0, 16*len(frames))
+		for _, frame := range frames {
+			matrices = append(matrices, daeMatrixValues(outputTagFrame(tag.Frame(frame)))...)
+		}
+		a.Children = append(a.Children, daeChannelAnimation(
+			tagNodes[index]+"-transform",
+			tagNodes[index]+"/transform",
+			times, matrices, daeParam{Name: "TRANSFORM", Type: "float4x4"}, 16))
+	}
+
+	if len(a.Children) > 0 {
+		b.doc.Animations = append(b.doc.Animations, a)
+	} else {
+		b.doc.Clips = nil
+	}
+}
+
+// buildDAE converts the model in pair to a COLLADA document. The model is a
+// single node holding each surface, as a geometry morphed through the
+// model's frames, and a child node for each tag. The given ranges are
+// played one after another, with a clip for each.
+func buildDAE(pair *modelPathPair, ranges []animationRange) *daeDocument {
+	model := pair.model
+	b := &daeBuilder{shaders: pair.shaders}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	b.doc.Xmlns, b.doc.Version = daeNamespace, daeVersion
+	b.doc.Asset = daeAsset{Tool: "go-md3", Created: now, Modified: now, UpAxis: "Z_UP"}
+	if *swapYZ {
+		b.doc.Asset.UpAxis = "Y_UP"
+	}
+
+	root := daeNode{ID: "model", Name: model.Name()}
+	var morphs []string
+	for index, surf := range model.AllSurfaces() {
+		// Empty surfaces are dropped, as they are for glTF.
+		if surf.NumVertices() == 0 || surf.NumTriangles() == 0 {
+			continue
+		}
+		instance := b.addSurface(model, index, surf, pair.skin.Material(surf))
+		if model.NumFrames() > 1 {
+			root.Controllers = append(root.Controllers, instance)
+			morphs = append(morphs, instance.URL[1:])
+		} else {
+			root.Geometries = append(root.Geometries, instance)
+		}
+	}
+
+	var tagNodes []string
+	for index, tag := range model.AllTags() {
+		node := daeNode{ID: fmt.Sprintf("tag%d", index), Name: tag.Name(), Sid: fmt.Sprintf("tag%d", index)}
+		if model.NumFrames() > 0 {
+			node.Matrix = &daeMatrix{
+				Sid:    "transform",
+				Values: daeFloats(daeMatrixValues(outputTagFrame(tag.Frame(0)))),
+			}
+		}
+		root.Children = append(root.Children, node)
+		tagNodes = append(tagNodes, node.ID)
+	}
+
+	b.doc.Scenes = []daeNodeList{{ID: "scene", Name: model.Name(), Nodes: []daeNode{root}}}
+	b.doc.Scene = daeURL{URL: "#scene"}
+
+	if len(ranges) > 0 {
+		b.addAnimations(model, morphs, tagNodes, ranges)
+	}
+
+	return &b.doc
+}
+
+// writeDAE writes doc to w as an XML document.
+func writeDAE(w io.Writer, doc *daeDocument) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// performConvertDAE converts the model in pair to a single COLLADA .dae file.
+func performConvertDAE(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	defer func() { signal <- true }()
+
+	modelPath := pair.path
+	ranges, err := animationRanges(modelPath, pair.model)
+	if err != nil {
+		log.Println("Error reading animations for", modelPath, "->", err)
+		return
+	}
+
+	doc := buildDAE(pair, ranges)
+	dir, name := outputName(modelPath)
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		outPath := path.Join(dir, name+".dae")
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if err := writeDAE(file, doc); err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+		}
+	}
+	<-done
+}
@@ -0,0 +1,655 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/anim"
+	"github.com/nilium/go-md3/md3/player"
+	"github.com/nilium/go-md3/md3/shader"
+)
+
+var (
+	animConfigPath = flag.String("animConfig", "", "An animation.cfg to split converted glTF, COLLADA and IQM animations by.")
+	animFPS        = flag.Float64("fps", 15, "The frame rate of converted glTF, COLLADA and IQM animations when no -animConfig is given.")
+)
+
+// glTF constants. Component types and buffer view targets are the OpenGL
+// enums the spec borrows.
+const (
+	gltfFloat         = 5126
+	gltfUnsignedShort = 5123
+
+	gltfArrayBuffer        = 34962
+	gltfElementArrayBuffer = 34963
+
+	glbMagic     = 0x46546c67 // "glTF"
+	glbVersion   = 2
+	glbChunkJSON = 0x4e4f534a // "JSON"
+	glbChunkBIN  = 0x004e4942 // "BIN\x00"
+)
+
+type gltfDocument struct {
+	Asset       gltfAsset       `json:"asset"`
+	Scene       int             `json:"scene"`
+	Scenes      []gltfScene     `json:"scenes"`
+	Nodes       []gltfNode      `json:"nodes"`
+	Meshes      []gltfMesh      `json:"meshes,omitempty"`
+	Materials   []gltfMaterial  `json:"materials,omitempty"`
+	Textures    []gltfTexture   `json:"textures,omitempty"`
+	Images      []gltfImage     `json:"images,omitempty"`
+	Animations  []gltfAnimation `json:"animations,omitempty"`
+	Accessors   []gltfAccessor  `json:"accessors,omitempty"`
+	BufferViews []gltfView      `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer    `json:"buffers,omitempty"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Name        string      `json:"name,omitempty"`
+	Mesh        *int        `json:"mesh,omitempty"`
+	Children    []int       `json:"children,omitempty"`
+	Translation *[3]float32 `json:"translation,omitempty"`
+	Rotation    *[4]float32 `json:"rotation,omitempty"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+	Weights    []float32       `json:"weights,omitempty"`
+	Extras     *gltfMeshExtras `json:"extras,omitempty"`
+}
+
+// gltfMeshExtras records the names of a mesh's morph targets, which most
+// importers read from here for want of a place in the spec proper.
+type gltfMeshExtras struct {
+	TargetNames []string `json:"targetNames"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int   `json:"attributes"`
+	Indices    int              `json:"indices"`
+	Material   *int             `json:"material,omitempty"`
+	Targets    []map[string]int `json:"targets,omitempty"`
+}
+
+type gltfMaterial struct {
+	Name      string  `json:"name,omitempty"`
+	PBR       gltfPBR `json:"pbrMetallicRoughness"`
+	AlphaMode string  `json:"alphaMode,omitempty"`
+}
+
+type gltfPBR struct {
+	BaseColorTexture *gltfTextureInfo `json:"baseColorTexture,omitempty"`
+	MetallicFactor   float32          `json:"metallicFactor"`
+	RoughnessFactor  float32          `json:"roughnessFactor"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+type gltfTexture struct {
+	Source int `json:"source"`
+}
+
+type gltfImage struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+type gltfAnimation struct {
+	Name     string                 `json:"name,omitempty"`
+	Channels []gltfChannel          `json:"channels"`
+	Samplers []gltfAnimationSampler `json:"samplers"`
+}
+
+type gltfChannel struct {
+	Sampler int               `json:"sampler"`
+	Target  gltfChannelTarget `json:"target"`
+}
+
+type gltfChannelTarget struct {
+	Node int    `json:"node"`
+	Path string `json:"path"`
+}
+
+type gltfAnimationSampler struct {
+	Input         int    `json:"input"`
+	Output        int    `json:"output"`
+	Interpolation string `json:"interpolation"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target,omitempty"`
+}
+
+type gltfBuffer struct {
+	URI        string `json:"uri,omitempty"`
+	ByteLength int    `json:"byteLength"`
+}
+
+// animationRange is a named sequence of model frames to play as a single
+// animation of a converted glTF, COLLADA or IQM file.
+type animationRange struct {
+	name   string
+	frames []int
+	fps    float64
+}
+
+// gltfBuilder accumulates a glTF document and the binary buffer its
+// accessors refer to.
+type gltfBuilder struct {
+	doc gltfDocument
+	bin bytes.Buffer
+	// shaders resolves the images of the document's materials.
+	shaders *shader.Resolver
+}
+
+// gltfAlphaModes maps shader blend modes to the nearest glTF alpha mode. glTF
+// can't add or multiply colours, so additive and filter shaders are blended
+// by alpha instead.
+var gltfAlphaModes = map[shader.BlendMode]string{
+	shader.AlphaTest:  "MASK",
+	shader.AlphaBlend: "BLEND",
+	shader.Additive:   "BLEND",
+	shader.Multiply:   "BLEND",
+}
+
+var gltfComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+}
+
+// addView appends data to the buffer as a new buffer view and returns its
+// index. Views are padded to four bytes so every accessor stays aligned.
+func (b *gltfBuilder) addView(data []byte, target int) int {
+	view := gltfView{ByteOffset: b.bin.Len(), ByteLength: len(data), Target: target}
+	b.bin.Write(data)
+	for b.bin.Len()%4 != 0 {
+		b.bin.WriteByte(0)
+	}
+	b.doc.BufferViews = append(b.doc.BufferViews, view)
+	return len(b.doc.BufferViews) - 1
+}
+
+// addFloats adds an accessor of float elements of the given type and returns
+// its index. If bounds is true, the accessor records the minimum and maximum
+// of each component, as the spec requires of positions and animation inputs.
+func (b *gltfBuilder) addFloats(values []float32, typ string, target int, bounds bool) int {
+	components := gltfComponents[typ]
+	data := make([]byte, 4*len(values))
+	for index, value := range values {
+		binary.LittleEndian.PutUint32(data[4*index:], math.Float32bits(value))
+	}
+
+	accessor := gltfAccessor{
+		BufferView:    b.addView(data, target),
+		ComponentType: gltfFloat,
+		Count:         len(values) / components,
+		Type:          typ,
+	}
+
+	if bounds && len(values) > 0 {
+		accessor.Min = append([]float32(nil), values[:components]...)
+		accessor.Max = append([]float32(nil), values[:components]...)
+		for index, value := range values {
+			c := index % components
+			accessor.Min[c] = min(accessor.Min[c], value)
+			accessor.Max[c] = max(accessor.Max[c], value)
+		}
+	}
+
+	b.doc.Accessors = append(b.doc.Accessors, accessor)
+	return len(b.doc.Accessors) - 1
+}
+
+// addIndices adds an accessor of triangle vertex indices and returns its
+// index. MD3 surfaces never have more vertices than fit in 16 bits.
+func (b *gltfBuilder) addIndices(indices []uint16) int {
+	data := make([]byte, 2*len(indices))
+	for index, value := range indices {
+		binary.LittleEndian.PutUint16(data[2*index:], value)
+	}
+
+	b.doc.Accessors = append(b.doc.Accessors, gltfAccessor{
+		BufferView:    b.addView(data, gltfElementArrayBuffer),
+		ComponentType: gltfUnsignedShort,
+		Count:         len(indices),
+		Type:          "SCALAR",
+	})
+	return len(b.doc.Accessors) - 1
+}
+
+// gltfImageTypes maps the extensions of the image formats glTF allows to their
+// MIME types.
+var gltfImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
+
+// addMaterial returns the index of the material for the given shader name,
+// adding it if it doesn't exist yet. The material's base color texture and
+// alpha mode come from the shader's image and blend mode, as resolved by
+// resolveMaterial. glTF only allows PNG and JPEG images, so materials whose
+// images are in other formats, such as TGA, are left untextured.
+func (b *gltfBuilder) addMaterial(name string) int {
+	for index, material := range b.doc.Materials {
+		if material.Name == name {
+			return index
+		}
+	}
+
+	texture, blend := resolveMaterial(b.shaders, name)
+	material := gltfMaterial{
+		Name:      name,
+		PBR:       gltfPBR{RoughnessFactor: 1},
+		AlphaMode: gltfAlphaModes[blend],
+	}
+	if mimeType, ok := gltfImageTypes[strings.ToLower(path.Ext(texture))]; ok {
+		uri := (&url.URL{Path: texture}).EscapedPath()
+		b.doc.Images = append(b.doc.Images, gltfImage{URI: uri, MimeType: mimeType})
+		b.doc.Textures = append(b.doc.Textures, gltfTexture{Source: len(b.doc.Images) - 1})
+		material.PBR.BaseColorTexture = &gltfTextureInfo{Index: len(b.doc.Textures) - 1}
+	}
+
+	b.doc.Materials = append(b.doc.Materials, material)
+	return len(b.doc.Materials) - 1
+}
+
+// addSurface adds the surface surf as a primitive of a mesh. Its first frame
+// is the primitive's base and every following frame is a morph target
+// holding the difference from it.
+func (b *gltfBuilder) addSurface(surf *md3.Surface, material string) gltfPrimitive {
+	numVertices := surf.NumVertices()
+
+	base := make([]md3.Vertex, numVertices)
+	positions := make([]float32, 0, 3*numVertices)
+	normals := make([]float32, 0, 3*numVertices)
+	texcoords := make([]float32, 0, 2*numVertices)
+	for index := range base {
+		base[index] = outputVertex(surf.Vertex(0, index))
+		positions = appendVec3(positions, base[index].Origin)
+		normals = appendVec3(normals, base[index].Normal)
+		tc := surf.TexCoord(index)
+		texcoords = append(texcoords, tc.S, tc.T)
+	}
+
+	indices := make([]uint16, 0, 3*surf.NumTriangles())
+	for _, tri := range surf.AllTriangles() {
+		for _, index := range outputTriangle(tri) {
+			indices = append(indices, uint16(index))
+		}
+	}
+
+	prim := gltfPrimitive{
+		Attributes: map[string]int{
+			"POSITION":   b.addFloats(positions, "VEC3", gltfArrayBuffer, true),
+			"NORMAL":     b.addFloats(normals, "VEC3", gltfArrayBuffer, false),
+			"TEXCOORD_0": b.addFloats(texcoords, "VEC2", gltfArrayBuffer, false),
+		},
+		Indices: b.addIndices(indices),
+	}
+
+	if material != "" {
+		index := b.addMaterial(material)
+		prim.Material = &index
+	}
+
+	for frame := 1; frame < surf.NumFrames(); frame++ {
+		positions, normals = positions[:0], normals[:0]
+		for index, vert := range surf.AllVertices(frame) {
+			vert = outputVertex(vert)
+			positions = appendVec3(positions, vert.Origin.Sub(base[index].Origin))
+			normals = appendVec3(normals, vert.Normal.Sub(base[index].Normal))
+		}
+
+		prim.Targets = append(prim.Targets, map[string]int{
+			"POSITION": b.addFloats(positions, "VEC3", gltfArrayBuffer, true),
+			"NORMAL":   b.addFloats(normals, "VEC3", gltfArrayBuffer, false),
+		})
+	}
+
+	return prim
+}
+
+// addAnimation adds an animation playing the given range of frames. The
+// mesh's morph target weights select each frame in turn and each tag node is
+// moved to the tag's position in that frame.
+func (b *gltfBuilder) addAnimation(model *md3.Model, meshNode int, tagNodes []int, r animationRange) {
+	a := gltfAnimation{Name: r.name}
+
+	times := make([]float32, len(r.frames))
+	for step := range times {
+		times[step] = float32(float64(step) / r.fps)
+	}
+	input := b.addFloats(times, "SCALAR", 0, true)
+
+	addChannel := func(node int, path string, output []float32, typ string) {
+		a.Samplers = append(a.Samplers, gltfAnimationSampler{
+			Input:         input,
+			Output:        b.addFloats(output, typ, 0, false),
+			Interpolation: "LINEAR",
+		})
+		a.Channels = append(a.Channels, gltfChannel{
+			Sampler: len(a.Samplers) - 1,
+			Target:  gltfChannelTarget{Node: node, Path: path},
+		})
+	}
+
+	if numTargets := model.NumFrames() - 1; meshNode >= 0 && numTargets > 0 {
+		weights := make([]float32, len(r.frames)*numTargets)
+		for step, frame := range r.frames {
+			if frame > 0 {
+				weights[step*numTargets+frame-1] = 1
+			}
+		}
+		addChannel(meshNode, "weights", weights, "SCALAR")
+	}
+
+	for index, tag := range model.AllTags() {
+		translations := make([]float32, 0, 3*len(r.frames))
+		rotations := make([]float32, 0, 4*len(r.frames))
+		var last md3.Quat
+		for step, frame := range r.frames {
+			tf := outputTagFrame(tag.Frame(frame))
+			q := gltfRotation(tf)
+			// Keep consecutive rotations in the same hemisphere so they're
+			// interpolated along the shorter path.
+			if step > 0 && q.Dot(last) < 0 {
+				q = md3.Quat{X: -q.X, Y: -q.Y, Z: -q.Z, W: -q.W}
+			}
+			last = q
+			translations = appendVec3(translations, tf.Origin)
+			rotations = append(rotations, q.X, q.Y, q.Z, q.W)
+		}
+		addChannel(tagNodes[index], "translation", translations, "VEC3")
+		addChannel(tagNodes[index], "rotation", rotations, "VEC4")
+	}
+
+	if len(a.Channels) > 0 {
+		b.doc.Animations = append(b.doc.Animations, a)
+	}
+}
+
+func appendVec3(values []float32, v md3.Vec3) []float32 {
+	return append(values, v.X, v.Y, v.Z)
+}
+
+// gltfRotation returns the rotation of the tag frame tf as a unit quaternion.
+func gltfRotation(tf md3.TagFrame) md3.Quat {
+	return tf.Orthonormalize().Quat().Normalize()
+}
+
+// buildGLTF converts the model in pair to a glTF document and the contents of
+// its binary buffer. The model is a single node holding one mesh, with a
+// primitive for each surface, and a child node for each tag. Animations are
+// split by the given ranges.
+func buildGLTF(pair *modelPathPair, ranges []animationRange) *gltfBuilder {
+	model := pair.model
+	b := &gltfBuilder{shaders: pair.shaders}
+	b.doc.Asset = gltfAsset{Version: "2.0", Generator: "go-md3"}
+	b.doc.Scenes = []gltfScene{{Nodes: []int{0}}}
+	b.doc.Nodes = []gltfNode{{Name: model.Name()}}
+
+	meshNode := -1
+	mesh := gltfMesh{Name: model.Name()}
+	for _, surf := range model.AllSurfaces() {
+		// glTF doesn't allow empty accessors, so empty surfaces are dropped.
+		if surf.NumVertices() == 0 || surf.NumTriangles() == 0 {
+			continue
+		}
+		prim := b.addSurface(surf, pair.skin.Material(surf))
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+
+	if len(mesh.Primitives) > 0 {
+
+		if numTargets := model.NumFrames() - 1; numTargets > 0 {
+			mesh.Weights = make([]float32, numTargets)
+			mesh.Extras = &gltfMeshExtras{}
+			for frame := 1; frame < model.NumFrames(); frame++ {
+				mesh.Extras.TargetNames = append(mesh.Extras.TargetNames, frameName(model, frame))
+			}
+		}
+
+		b.doc.Meshes = append(b.doc.Meshes, mesh)
+		meshIndex := 0
+		b.doc.Nodes[0].Mesh = &meshIndex
+		meshNode = 0
+	}
+
+	var tagNodes []int
+	for _, tag := range model.AllTags() {
+		node := gltfNode{Name: tag.Name()}
+		if model.NumFrames() > 0 {
+			tf := outputTagFrame(tag.Frame(0))
+			q := gltfRotation(tf)
+			node.Translation = &[3]float32{tf.Origin.X, tf.Origin.Y, tf.Origin.Z}
+			node.Rotation = &[4]float32{q.X, q.Y, q.Z, q.W}
+		}
+		b.doc.Nodes = append(b.doc.Nodes, node)
+		tagNodes = append(tagNodes, len(b.doc.Nodes)-1)
+	}
+	b.doc.Nodes[0].Children = tagNodes
+
+	for _, r := range ranges {
+		b.addAnimation(model, meshNode, tagNodes, r)
+	}
+
+	return b
+}
+
+// frameName returns the name of the given frame, or its index if it has
+// no name.
+func frameName(model *md3.Model, frame int) string {
+	if name := model.Frame(frame).Name(); name != "" {
+		return name
+	}
+	return fmt.Sprint(frame)
+}
+
+// animationRanges returns the animations to split the model at the given
+// path into. With no -animConfig, every frame is played in order as a single
+// animation. Otherwise, each of the config's animations whose frames are in
+// the model becomes its own animation. Legs and torso animations are only
+// given to the models they belong to, going by the model's file name.
+func animationRanges(modelPath string, model *md3.Model) ([]animationRange, error) {
+	numFrames := model.NumFrames()
+	if *animConfigPath == "" {
+		if numFrames < 2 {
+			return nil, nil
+		}
+
+		r := animationRange{name: "frames", fps: *animFPS}
+		for frame := 0; frame < numFrames; frame++ {
+			r.frames = append(r.frames, frame)
+		}
+		return []animationRange{r}, nil
+	}
+
+	cfg, err := readAnimConfigForPath(*animConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	base := pathBase(modelPath)
+
+	var ranges []animationRange
+	for index := anim.Index(0); index < anim.NumAnimations; index++ {
+		switch part := index.Part(); {
+		case part == anim.Legs && strings.EqualFold(base, player.TorsoFile),
+			part == anim.Torso && strings.EqualFold(base, player.LegsFile):
+			continue
+		}
+
+		a := cfg.Animation(index)
+		if a.NumFrames <= 0 || a.FirstFrame < 0 || a.FirstFrame+a.NumFrames > numFrames {
+			continue
+		}
+
+		r := animationRange{name: index.String(), fps: float64(a.FPS)}
+		for step := 0; step < a.NumFrames; step++ {
+			r.frames = append(r.frames, a.Frame(step))
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// readAnimConfigForPath reads the animation.cfg at the given path, which may
+// refer to a file within a pk3 archive.
+func readAnimConfigForPath(path string) (*anim.Config, error) {
+	fsys, name, err := fsForPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return anim.Parse(file)
+}
+
+// gltfDocumentFor returns the document built by b with a buffer for its
+// binary data, if it has any, located at uri. GLB files leave the uri empty.
+func gltfDocumentFor(b *gltfBuilder, uri string) *gltfDocument {
+	doc := b.doc
+	if b.bin.Len() > 0 {
+		doc.Buffers = []gltfBuffer{{URI: uri, ByteLength: b.bin.Len()}}
+	}
+	return &doc
+}
+
+// writeGLTF writes the document built by b to w as JSON, referring to its
+// binary buffer at binURI. The buffer itself must be written separately.
+func writeGLTF(w io.Writer, b *gltfBuilder, binURI string) error {
+	uri := (&url.URL{Path: binURI}).EscapedPath()
+	data, err := json.Marshal(gltfDocumentFor(b, uri))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// writeGLB writes the document built by b and its binary buffer to w as a
+// single GLB file.
+func writeGLB(w io.Writer, b *gltfBuilder) error {
+	data, err := json.Marshal(gltfDocumentFor(b, ""))
+	if err != nil {
+		return err
+	}
+
+	for len(data)%4 != 0 {
+		data = append(data, ' ')
+	}
+
+	length := 12 + 8 + len(data)
+	if b.bin.Len() > 0 {
+		length += 8 + b.bin.Len()
+	}
+
+	buf := new(bytes.Buffer)
+	for _, x := range [...]uint32{glbMagic, glbVersion, uint32(length), uint32(len(data)), glbChunkJSON} {
+		binary.Write(buf, binary.LittleEndian, x)
+	}
+	buf.Write(data)
+
+	if b.bin.Len() > 0 {
+		for _, x := range [...]uint32{uint32(b.bin.Len()), glbChunkBIN} {
+			binary.Write(buf, binary.LittleEndian, x)
+		}
+		buf.Write(b.bin.Bytes())
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// performConvertGLTF converts the model in pair to a single .gltf file, with
+// a companion .bin file, or a single .glb file, depending on -format.
+func performConvertGLTF(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	defer func() { signal <- true }()
+
+	modelPath := pair.path
+	ranges, err := animationRanges(modelPath, pair.model)
+	if err != nil {
+		log.Println("Error reading animations for", modelPath, "->", err)
+		return
+	}
+
+	b := buildGLTF(pair, ranges)
+	dir, name := outputName(modelPath)
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		outPath := path.Join(dir, name+"."+*convertFormat)
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if *convertFormat == "glb" {
+			err = writeGLB(file, b)
+		} else {
+			err = writeGLTF(file, b, name+".bin")
+		}
+		if err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+			return
+		}
+
+		if *convertFormat == "glb" || b.bin.Len() == 0 {
+			return
+		}
+
+		binPath := path.Join(dir, name+".bin")
+		if err := os.WriteFile(binPath, b.bin.Bytes(), 0644); err != nil {
+			log.Println("Error writing", binPath, "from", modelPath, "->", err)
+		}
+	}
+	<-done
+}
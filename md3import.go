@@ -0,0 +1,290 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/iqm"
+	"github.com/nilium/go-md3/md3/md2"
+	"github.com/nilium/go-md3/md3/md5"
+	"github.com/nilium/go-md3/md3/mdc"
+	"github.com/nilium/go-md3/md3/mdr"
+	"github.com/nilium/go-md3/md3/obj"
+	"github.com/nilium/go-md3/md3/smd"
+)
+
+var (
+	md5AnimPath = flag.String("md5Anim", "", "The .md5anim to animate imported .md5mesh models with. Defaults to the .md5anim beside each model, if any.")
+	md5Tags     = flag.String("md5Tags", "", "Joints of imported .md5mesh models to convert to tags, such as Rhand=tag_weapon,head=tag_head.")
+	smdAnimPath = flag.String("smdAnim", "", "The animation SMD to animate imported reference SMD models with. Defaults to each model's own skeleton.")
+	smdTags     = flag.String("smdTags", "", "Bones of imported SMD models to convert to tags, such as ValveBiped.Bip01_R_Hand=tag_weapon.")
+)
+
+// importFunc reads a model in a format other than MD3 from the given path,
+// which may refer to a file within a pk3 archive.
+type importFunc func(path string) (*md3.Model, error)
+
+// importers holds the importers for each format other than MD3 that models
+// can be read from, keyed by lowercase file extension.
+var importers = map[string]importFunc{
+	".iqm":     readIQMForPath,
+	".md2":     readMD2ForPath,
+	".md5mesh": readMD5ForPath,
+	".mdc":     readMDCForPath,
+	".mdr":     readMDRForPath,
+	".obj":     readOBJForPath,
+	".smd":     readSMDForPath,
+}
+
+// importerForPath returns the importer for the model at the given path,
+// going by its extension. It returns false if the model should be read as an
+// MD3.
+func importerForPath(p string) (importFunc, bool) {
+	importer, ok := importers[strings.ToLower(path.Ext(pathBase(p)))]
+	return importer, ok
+}
+
+// objSequencePattern matches the first file of a sequence of OBJ frames, as
+// written by convert mode: name+0.obj, followed by name+1.obj, and so on.
+var objSequencePattern = regexp.MustCompile(`(?i)^(.*)\+0(\.obj)$`)
+
+// readOBJForPath builds a model from the OBJ file at the given path. If the
+// file is the first of a sequence of frames, such as name+0.obj, every
+// following frame that exists is read as well. OBJ files are converted to
+// MD3's axes and texture space by reversing -swapYZ and -flipUVs.
+func readOBJForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(name)
+	modelName := strings.TrimSuffix(base, path.Ext(base))
+	names := []string{name}
+	if match := objSequencePattern.FindStringSubmatch(name); match != nil {
+		modelName = path.Base(match[1])
+		for frame := 1; ; frame++ {
+			next := fmt.Sprintf("%s+%d%s", match[1], frame, match[2])
+			if _, err := fs.Stat(fsys, next); err != nil {
+				break
+			}
+			names = append(names, next)
+		}
+	}
+
+	frames := make([]*obj.File, len(names))
+	for index, name := range names {
+		file, err := fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		frames[index], err = obj.Parse(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return obj.Build(modelName, frames, obj.Options{SwapYZ: *swapYZ, FlipUVs: *flipUVs})
+}
+
+// readIQMForPath bakes the IQM model at the given path into an MD3 model
+// named after the file, with a frame for each of its frames.
+func readIQMForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := iqm.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(name)
+	return m.ToMD3(strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// readMD2ForPath converts the MD2 model at the given path to an MD3 model
+// named after the file.
+func readMD2ForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := md2.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	base := path.Base(name)
+	return m.ToMD3(strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// readMDCForPath reads the MDC model at the given path, decompressing every
+// frame.
+func readMDCForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return mdc.Read(data)
+}
+
+// readMDRForPath reads the skeletal MDR model at the given path and bakes its
+// most detailed LOD into an MD3 model, with a frame for each of its frames.
+func readMDRForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := mdr.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.ToMD3(0)
+}
+
+// readMD5ForPath bakes the .md5mesh model at the given path into an MD3 model
+// named after the file. It's animated by -md5Anim or, if that isn't given,
+// by the .md5anim of the same name beside it; if there's none, the model is
+// left in its bind pose. Joints named by -md5Tags become tags.
+func readMD5ForPath(p string) (*md3.Model, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	m, err := md5.ParseMesh(file)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := parseBoneTags(*md5Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	modelName := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	animFS, animName := fsys, path.Join(path.Dir(name), modelName+".md5anim")
+	if *md5AnimPath != "" {
+		if animFS, animName, err = fsForPath(*md5AnimPath); err != nil {
+			return nil, err
+		}
+	} else if _, err := fs.Stat(fsys, animName); err != nil {
+		return m.ToMD3(modelName, nil, tags)
+	}
+
+	file, err = animFS.Open(animName)
+	if err != nil {
+		return nil, err
+	}
+	anim, err := md5.ParseAnim(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", animName, err)
+	}
+
+	return m.ToMD3(modelName, anim, tags)
+}
+
+// parseBoneTags parses a list of joint or bone and tag names, such as
+// "Rhand=tag_weapon,head=tag_head", into a map from joint to tag names.
+func parseBoneTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if list == "" {
+		return tags, nil
+	}
+
+	for _, item := range strings.Split(list, ",") {
+		joint, tag, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || joint == "" || tag == "" {
+			return nil, fmt.Errorf("Invalid joint and tag %q: expected joint=tag", item)
+		}
+		tags[joint] = tag
+	}
+	return tags, nil
+}
+
+// readSMDForPath bakes the reference SMD model at the given path into an MD3
+// model named after the file. It's animated by the animation SMD given by
+// -smdAnim or, if that isn't given, by the frames of its own skeleton. Bones
+// named by -smdTags become tags. SMD files are converted to MD3's axes and
+// texture space by reversing -swapYZ and -flipUVs, as OBJ files are.
+func readSMDForPath(p string) (*md3.Model, error) {
+	ref, err := readSMD(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var anim *smd.File
+	if *smdAnimPath != "" {
+		if anim, err = readSMD(*smdAnimPath); err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := parseBoneTags(*smdTags)
+	if err != nil {
+		return nil, err
+	}
+
+	base := pathBase(p)
+	opts := smd.Options{SwapYZ: *swapYZ, FlipUVs: *flipUVs, Tags: tags}
+	return smd.Build(strings.TrimSuffix(base, path.Ext(base)), ref, anim, opts)
+}
+
+// readSMD parses the SMD file at the given path.
+func readSMD(p string) (*smd.File, error) {
+	fsys, name, err := fsForPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	f, err := smd.Parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return f, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"os"
+	"path"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/iqm"
+)
+
+var iqmSkeleton = flag.Bool("iqmSkeleton", true, "Gives converted IQM files a root joint and a joint for each tag, animated by the model's frames.")
+
+// iqmRootJoint is the name of the joint every vertex of a converted IQM file
+// is weighted to.
+const iqmRootJoint = "root"
+
+// buildIQM converts the model in pair to an IQM model. IQM has no vertex
+// animation, so the mesh is taken from a single frame of the model. With
+// -iqmSkeleton, its vertices are weighted to a single root joint and each
+// tag becomes a child joint of the root, animated over the given ranges of
+// frames; otherwise, only the mesh is converted. IQM shares MD3's axes and
+// texture space, so -swapYZ and -flipUVs don't apply.
+func buildIQM(pair *modelPathPair, frame int, ranges []animationRange) *iqm.Model {
+	model := pair.model
+	out := &iqm.Model{HasNormals: true}
+
+	for _, surf := range model.AllSurfaces() {
+		mesh := iqm.Mesh{
+			Name:          surf.Name(),
+			Material:      pair.skin.Material(surf),
+			FirstVertex:   len(out.Vertices),
+			NumVertices:   surf.NumVertices(),
+			FirstTriangle: len(out.Triangles),
+			NumTriangles:  surf.NumTriangles(),
+		}
+
+		for index, vert := range surf.AllVertices(frame) {
+			out.Vertices = append(out.Vertices, iqm.Vertex{
+				Position: vert.Origin,
+				Normal:   vert.Normal,
+				TexCoord: surf.TexCoord(index),
+				Weights:  [4]float32{1},
+			})
+		}
+
+		base := int32(mesh.FirstVertex)
+		for _, tri := range surf.AllTriangles() {
+			out.Triangles = append(out.Triangles, md3.Triangle{A: tri.A + base, B: tri.B + base, C: tri.C + base})
+		}
+
+		out.Meshes = append(out.Meshes, mesh)
+	}
+
+	if !*iqmSkeleton {
+		return out
+	}
+
+	out.Joints = append(out.Joints, iqm.Joint{Name: iqmRootJoint, Parent: -1, Base: iqm.IdentityTransform()})
+	for _, tag := range model.AllTags() {
+		out.Joints = append(out.Joints, iqm.Joint{Name: tag.Name(), Parent: 0, Base: iqmTransform(tag.Frame(frame))})
+	}
+
+	if model.NumTags() == 0 {
+		return out
+	}
+
+	for _, r := range ranges {
+		out.Anims = append(out.Anims, iqm.Anim{
+			Name:       r.name,
+			FirstFrame: len(out.Frames),
+			NumFrames:  len(r.frames),
+			FrameRate:  float32(r.fps),
+		})
+
+		for _, frame := range r.frames {
+			transforms := []iqm.Transform{iqm.IdentityTransform()}
+			for _, tag := range model.AllTags() {
+				transforms = append(transforms, iqmTransform(tag.Frame(frame)))
+			}
+			out.Frames = append(out.Frames, transforms)
+			out.Bounds = append(out.Bounds, iqmBounds(model.Frame(frame)))
+		}
+	}
+
+	return out
+}
+
+// iqmTransform returns the transform of a tag frame as an IQM joint.
+func iqmTransform(tf md3.TagFrame) iqm.Transform {
+	t := iqm.IdentityTransform()
+	t.Translate = tf.Origin
+	t.Rotate = tf.Orthonormalize().Quat()
+	return t
+}
+
+// iqmBounds returns the bounds of an MD3 frame as the bounds of an IQM frame.
+func iqmBounds(f *md3.Frame) iqm.Bounds {
+	lo, hi := f.Min(), f.Max()
+	x := math.Max(math.Abs(float64(lo.X)), math.Abs(float64(hi.X)))
+	y := math.Max(math.Abs(float64(lo.Y)), math.Abs(float64(hi.Y)))
+	return iqm.Bounds{Min: lo, Max: hi, XYRadius: float32(math.Hypot(x, y)), Radius: f.Radius()}
+}
+
+// performConvertIQM converts the model in pair to an IQM file. Its mesh is
+// taken from the first frame selected by -frames, and its animations are
+// split as glTF animations are.
+func performConvertIQM(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	defer func() { signal <- true }()
+
+	modelPath := pair.path
+	frames, err := parseFrameList(*frameList, pair.model.NumFrames())
+	if err != nil {
+		log.Println("Error selecting frames of", modelPath, "->", err)
+		return
+	} else if len(frames) == 0 {
+		log.Println("Error converting", modelPath, "-> model has no frames")
+		return
+	}
+
+	ranges, err := animationRanges(modelPath, pair.model)
+	if err != nil {
+		log.Println("Error reading animations for", modelPath, "->", err)
+		return
+	}
+
+	out := buildIQM(pair, frames[0], ranges)
+	dir, name := outputName(modelPath)
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		outPath := path.Join(dir, name+".iqm")
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if err := iqm.Write(file, out); err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+		}
+	}
+	<-done
+}
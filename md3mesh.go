@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+var plyASCII = flag.Bool("plyASCII", false, "Writes converted PLY files as text instead of binary.")
+
+// frameMesh is a single frame of a model with its surfaces merged into one
+// mesh, in the output axes and texture space.
+type frameMesh struct {
+	vertices  []md3.Vertex
+	texCoords []md3.TexCoord
+	triangles [][3]int32
+}
+
+// mergeFrame returns the given frame of the model as a single mesh. Each
+// surface's vertices follow those of the surfaces before it, and triangles
+// are wound counter-clockwise, as they are for OBJ.
+func mergeFrame(model *md3.Model, frame int) *frameMesh {
+	mesh := &frameMesh{}
+	for _, surf := range model.AllSurfaces() {
+		base := int32(len(mesh.vertices))
+		for index, vert := range surf.AllVertices(frame) {
+			texCoord := surf.TexCoord(index)
+			if *flipUVs {
+				texCoord.T = 1.0 - texCoord.T
+			}
+			mesh.vertices = append(mesh.vertices, outputVertex(vert))
+			mesh.texCoords = append(mesh.texCoords, texCoord)
+		}
+		for _, tri := range surf.AllTriangles() {
+			out := outputTriangle(tri)
+			mesh.triangles = append(mesh.triangles, [3]int32{base + out[0], base + out[1], base + out[2]})
+		}
+	}
+	return mesh
+}
+
+// writePLY writes a frame of the model as a PLY file, in binary unless
+// -plyASCII is set. Each vertex has a position, normal and texcoord, named
+// x, y, z, nx, ny, nz, s and t.
+func writePLY(w io.Writer, model *md3.Model, frame int) error {
+	mesh := mergeFrame(model, frame)
+	bw := bufio.NewWriter(w)
+
+	format := "binary_little_endian"
+	if *plyASCII {
+		format = "ascii"
+	}
+	fmt.Fprintf(bw, "ply\nformat %s 1.0\ncomment %s frame %d\n", format, model.Name(), frame)
+	fmt.Fprintf(bw, "element vertex %d\n", len(mesh.vertices))
+	for _, property := range [...]string{"x", "y", "z", "nx", "ny", "nz", "s", "t"} {
+		fmt.Fprintf(bw, "property float %s\n", property)
+	}
+	fmt.Fprintf(bw, "element face %d\nproperty list uchar int vertex_indices\nend_header\n", len(mesh.triangles))
+
+	for index, vert := range mesh.vertices {
+		values := [8]float32{
+			vert.Origin.X, vert.Origin.Y, vert.Origin.Z,
+			vert.Normal.X, vert.Normal.Y, vert.Normal.Z,
+			mesh.texCoords[index].S, mesh.texCoords[index].T,
+		}
+		if *plyASCII {
+			fmt.Fprintf(bw, "%f %f %f %f %f %f %f %f\n",
+				values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7])
+		} else {
+			binary.Write(bw, binary.LittleEndian, values)
+		}
+	}
+
+	for _, tri := range mesh.triangles {
+		if *plyASCII {
+			fmt.Fprintf(bw, "3 %d %d %d\n", tri[0], tri[1], tri[2])
+		} else {
+			bw.WriteByte(3)
+			binary.Write(bw, binary.LittleEndian, tri)
+		}
+	}
+
+	return bw.Flush()
+}
+
+// stlTriangle is a triangle of a binary STL file.
+type stlTriangle struct {
+	Normal    [3]float32
+	Vertices  [3][3]float32
+	Attribute uint16
+}
+
+// writeSTL writes a frame of the model as a binary STL file. STL files hold
+// only triangles, so vertex normals and texcoords are dropped and each
+// triangle is given the normal of its face.
+func writeSTL(w io.Writer, model *md3.Model, frame int) error {
+	mesh := mergeFrame(model, frame)
+	bw := bufio.NewWriter(w)
+
+	// The header is free-form, but mustn't begin with "solid", which marks
+	// ASCII STL files.
+	var header [80]byte
+	copy(header[:], fmt.Sprintf("go-md3 %s frame %d", model.Name(), frame))
+	bw.Write(header[:])
+	binary.Write(bw, binary.LittleEndian, uint32(len(mesh.triangles)))
+
+	vec := func(v md3.Vec3) [3]float32 { return [3]float32{v.X, v.Y, v.Z} }
+	for _, tri := range mesh.triangles {
+		a, b, c := mesh.vertices[tri[0]].Origin, mesh.vertices[tri[1]].Origin, mesh.vertices[tri[2]].Origin
+		normal := b.Sub(a).Cross(c.Sub(a))
+		if normal.Len() > 0 {
+			normal = normal.Normalize()
+		}
+		binary.Write(bw, binary.LittleEndian, stlTriangle{
+			Normal:   vec(normal),
+			Vertices: [3][3]float32{vec(a), vec(b), vec(c)},
+		})
+	}
+
+	return bw.Flush()
+}
+
+// frameWriter writes a single frame of a model to w.
+type frameWriter func(w io.Writer, model *md3.Model, frame int) error
+
+// frameConverter returns a converter writing each frame selected by -frames
+// to a separate file with the given extension, named as OBJ frames are:
+// <basename>+<frameNumber><ext>.
+func frameConverter(ext string, write frameWriter) convertFunc {
+	return func(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+		defer func() { signal <- true }()
+
+		modelPath, model := pair.path, pair.model
+		frames, err := parseFrameList(*frameList, model.NumFrames())
+		if err != nil {
+			log.Println("Error selecting frames of", modelPath, "->", err)
+			return
+		}
+
+		dir, name := outputName(modelPath)
+		done := make(chan bool)
+		for _, frame := range frames {
+			writeQueue <- func() {
+				defer func() { go func() { done <- true }() }()
+
+				outPath := path.Join(dir, fmt.Sprintf("%s+%d%s", name, frame, ext))
+				file, err := os.Create(outPath)
+				if err != nil {
+					log.Println("Error creating", outPath, "from", modelPath, "->", err)
+					return
+				}
+				defer file.Close()
+
+				if err := write(file, model, frame); err != nil {
+					log.Println("Error writing", outPath, "from", modelPath, "->", err)
+				}
+			}
+		}
+
+		for range frames {
+			<-done
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nilium/go-md3/md3/pk3"
+)
+
+// archiveSuffix separates the path of a pk3 archive from the path of a file
+// within it, as in "pak0.pk3:models/players/sarge/upper.md3".
+const archiveSuffix = ".pk3:"
+
+var archives = struct {
+	sync.Mutex
+	open map[string]*pk3.FS
+}{open: make(map[string]*pk3.FS)}
+
+// splitArchivePath splits a path of the form "archive.pk3:name" into the
+// archive's path and the name of the file within it. It returns false if the
+// path doesn't refer to a file in an archive.
+func splitArchivePath(path string) (archive, name string, ok bool) {
+	index := strings.Index(strings.ToLower(path), archiveSuffix)
+	if index == -1 {
+		return "", "", false
+	}
+	split := index + len(archiveSuffix) - 1
+	return path[:split], path[split+1:], true
+}
+
+// openArchive returns a filesystem over the pk3 archive at the given path.
+// Archives are only opened once and are left open until the program exits.
+func openArchive(path string) (*pk3.FS, error) {
+	archives.Lock()
+	defer archives.Unlock()
+
+	if fsys, ok := archives.open[path]; ok {
+		return fsys, nil
+	}
+
+	fsys, err := pk3.OpenArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	archives.open[path] = fsys
+	return fsys, nil
+}
+
+// fsForPath returns the filesystem holding the file at the given path and the
+// file's name within it. Paths into archives are resolved against the
+// archive; all other paths are resolved against the directory containing
+// them.
+func fsForPath(path string) (fs.FS, string, error) {
+	if archive, name, ok := splitArchivePath(path); ok {
+		fsys, err := openArchive(archive)
+		return fsys, name, err
+	}
+	return os.DirFS(filepath.Dir(path)), filepath.Base(path), nil
+}
+
+// pathBase returns the last element of the given path, which may refer to a
+// file within a pk3 archive.
+func pathBase(p string) string {
+	if _, name, ok := splitArchivePath(p); ok {
+		return path.Base(name)
+	}
+	return filepath.Base(p)
+}
+
+// expandPaths expands any glob patterns in the given paths, including
+// patterns for files within archives. Paths without patterns are returned
+// as-is.
+func expandPaths(paths []string) ([]string, error) {
+	var expanded []string
+	for _, path := range paths {
+		if !hasGlobMeta(path) {
+			expanded = append(expanded, path)
+			continue
+		}
+
+		var matches []string
+		var err error
+		if archive, pattern, ok := splitArchivePath(path); ok {
+			var fsys *pk3.FS
+			if fsys, err = openArchive(archive); err == nil {
+				matches, err = globFold(fsys, pattern)
+			}
+			for index, match := range matches {
+				matches[index] = archive + ":" + match
+			}
+		} else {
+			matches, err = filepath.Glob(path)
+		}
+
+		if err != nil {
+			return nil, err
+		} else if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match %q", path)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// globFold returns the names of the files in fsys matching pattern, as
+// fs.Glob does, except that each element of a name is matched without regard
+// to case, as files in pk3 archives are looked up. Names are returned as
+// they're stored.
+func globFold(fsys fs.FS, pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	matches := []string{"."}
+	for _, elem := range strings.Split(pattern, "/") {
+		elem = strings.ToLower(elem)
+
+		var next []string
+		for _, dir := range matches {
+			// Matches that aren't directories can't match any more
+			// elements.
+			entries, err := fs.ReadDir(fsys, dir)
+			if err != nil {
+				continue
+			}
+			for _, de := range entries {
+				if ok, _ := path.Match(elem, strings.ToLower(de.Name())); ok {
+					next = append(next, path.Join(dir, de.Name()))
+				}
+			}
+		}
+		matches = next
+	}
+	return matches, nil
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
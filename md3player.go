@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/anim"
+	"github.com/nilium/go-md3/md3/player"
+	"github.com/nilium/go-md3/md3/skin"
+)
+
+var (
+	assemblePlayers = flag.Bool("player", false, "Treat each path as a player model directory and assemble its lower, upper, and head models.")
+	legsAnim        = flag.String("legsAnim", "LEGS_IDLE", "The legs animation to pose assembled players in.")
+	torsoAnim       = flag.String("torsoAnim", "TORSO_STAND", "The torso animation to pose assembled players in.")
+	weaponPath      = flag.String("weapon", "", "An optional weapon model to attach to assembled players' tag_weapon.")
+	playerSkin      = flag.String("playerSkin", "", "The name of the skin, such as default, to resolve assembled players' materials with.")
+)
+
+// readPlayerForPath assembles the player model in the directory at the given
+// path, which may refer to a directory within a pk3 archive, into a single
+// model. If the player has an animation.cfg, the model has
+// one frame for each frame of the longer of its -legsAnim and -torsoAnim
+// animations; otherwise it has a single frame, posed with the legs and torso
+// in their first frames. If -playerSkin is set, the player's skin of that
+// name is returned as well.
+func readPlayerForPath(dir string) (*md3.Model, *skin.Skin, error) {
+	fsys, name := fs.FS(os.DirFS(dir)), "."
+	if archive, archiveDir, ok := splitArchivePath(dir); ok {
+		var err error
+		if fsys, err = openArchive(archive); err != nil {
+			return nil, nil, err
+		}
+		name = archiveDir
+	}
+
+	p, err := player.LoadFS(fsys, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *weaponPath != "" {
+		if p.Weapon, err = readModelForPath(*weaponPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var s *skin.Skin
+	if *playerSkin != "" {
+		if s, err = player.LoadSkin(fsys, name, *playerSkin); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	model, err := bakePlayer(p, path.Base(filepath.ToSlash(filepath.Clean(dir))))
+	if err != nil {
+		return nil, nil, err
+	}
+	return model, s, nil
+}
+
+// bakePlayer assembles the player p into a single model with the given name.
+func bakePlayer(p *player.Player, name string) (*md3.Model, error) {
+	if p.Anim == nil {
+		return p.Bake(name, player.FramePose(0, 0))
+	}
+
+	if err := p.Anim.Validate(p.Legs, p.Torso); err != nil {
+		return nil, err
+	}
+
+	legs, ok := anim.IndexByName(*legsAnim)
+	if !ok {
+		return nil, fmt.Errorf("Unknown legs animation: %q", *legsAnim)
+	}
+
+	torso, ok := anim.IndexByName(*torsoAnim)
+	if !ok {
+		return nil, fmt.Errorf("Unknown torso animation: %q", *torsoAnim)
+	}
+
+	la, ta := p.Anim.Animation(legs), p.Anim.Animation(torso)
+	poses := make([]player.Pose, max(la.NumFrames, ta.NumFrames, 1))
+	for step := range poses {
+		poses[step] = player.FramePose(la.Frame(step), ta.Frame(step))
+	}
+
+	return p.Bake(name, poses...)
+}
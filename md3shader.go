@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/nilium/go-md3/md3/pk3"
+	"github.com/nilium/go-md3/md3/shader"
+)
+
+var gameDir = flag.String("gameDir", "", "A game directory, such as baseq3, whose shader scripts and images resolve converted models' materials.")
+
+var resolvers = struct {
+	sync.Mutex
+	open map[string]*shader.Resolver
+}{open: make(map[string]*shader.Resolver)}
+
+// shadersForPath returns the resolver for the shaders of the model at the
+// given path: one over -gameDir if it's set, or else over the pk3 archive the
+// model is in, if any. Otherwise, the resolver has no scripts or images, and
+// materials fall back to their implicit images. Resolvers are only created
+// once for each directory or archive.
+func shadersForPath(p string) (*shader.Resolver, error) {
+	key, open := "", func() (fs.FS, error) { return nil, nil }
+	if *gameDir != "" {
+		key = *gameDir
+		open = func() (fs.FS, error) { return pk3.OpenGameDir(*gameDir) }
+	} else if archive, _, ok := splitArchivePath(p); ok {
+		key = archive
+		open = func() (fs.FS, error) { return openArchive(archive) }
+	}
+
+	resolvers.Lock()
+	defer resolvers.Unlock()
+
+	if r, ok := resolvers.open[key]; ok {
+		return r, nil
+	}
+
+	fsys, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	r := shader.NewResolver(fsys)
+	if fsys != nil {
+		if err := r.LoadScripts(fsys); err != nil {
+			return nil, err
+		}
+		for _, err := range r.Errors() {
+			log.Println("Warning: skipped malformed shaders ->", err)
+		}
+	}
+
+	resolvers.open[key] = r
+	return r, nil
+}
+
+// resolveMaterial returns the image to texture the named material with and
+// how to blend it. Materials defined by a shader script use the image and
+// blend mode of their base stage; others use their implicit image, found in
+// the resolver's filesystem if it has one. If no image is found, the name is
+// assumed to be a .tga image, as the engine tries first, unless it already
+// names an image.
+func resolveMaterial(r *shader.Resolver, name string) (texture string, blend shader.BlendMode) {
+	if r != nil {
+		if sh, ok := r.Resolve(name); ok {
+			return sh.BaseTexture(), sh.BlendMode()
+		}
+	}
+
+	name = strings.ReplaceAll(name, `\`, "/")
+	switch strings.ToLower(path.Ext(name)) {
+	case ".tga", ".jpg", ".jpeg", ".png":
+		return name, shader.Opaque
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + ".tga", shader.Opaque
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// smdSkeleton is the skeleton of every converted SMD and VTA file: a single
+// root bone at the origin, which every vertex is weighted to.
+const smdSkeleton = "nodes\n0 \"root\" -1\nend\n"
+
+// smdRestPose is the pose of the root bone in each frame.
+const smdRestPose = "0 0.000000 0.000000 0.000000 0.000000 0.000000 0.000000\n"
+
+// smdCorner is a corner of a triangle of a converted SMD file: the surface
+// and index of its vertex. VTA files refer to vertices by the index of their
+// corner, in the order the reference file's triangles list them.
+type smdCorner struct {
+	surf   *md3.Surface
+	vertex int32
+}
+
+// smdCorners returns the corners of every triangle of the model, surface by
+// surface, wound counter-clockwise in the output axes.
+func smdCorners(model *md3.Model) []smdCorner {
+	var corners []smdCorner
+	for _, surf := range model.AllSurfaces() {
+		for _, tri := range surf.AllTriangles() {
+			for _, vertex := range outputTriangle(tri) {
+				corners = append(corners, smdCorner{surf, vertex})
+			}
+		}
+	}
+	return corners
+}
+
+// smdVertex formats the position and normal of the corner's vertex in the
+// given frame, in the output axes.
+func smdVertex(c smdCorner, frame int) string {
+	vert := outputVertex(c.surf.Vertex(frame, int(c.vertex)))
+	return fmt.Sprintf("%f %f %f %f %f %f",
+		vert.Origin.X, vert.Origin.Y, vert.Origin.Z,
+		vert.Normal.X, vert.Normal.Y, vert.Normal.Z)
+}
+
+// writeSMD writes a reference SMD file holding the triangles of the model in
+// the given frame, each using the material of its surface, or the surface's
+// name if it has none.
+func writeSMD(w io.Writer, pair *modelPathPair, corners []smdCorner, frame int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "version 1\n%sskeleton\ntime 0\n%send\ntriangles\n", smdSkeleton, smdRestPose)
+
+	for index, c := range corners {
+		if index%3 == 0 {
+			material := pair.skin.Material(c.surf)
+			if material == "" {
+				material = c.surf.Name()
+			}
+			fmt.Fprintln(bw, material)
+		}
+
+		texCoord := c.surf.TexCoord(int(c.vertex))
+		if *flipUVs {
+			texCoord.T = 1.0 - texCoord.T
+		}
+		fmt.Fprintf(bw, "0 %s %f %f\n", smdVertex(c, frame), texCoord.S, texCoord.T)
+	}
+
+	fmt.Fprintln(bw, "end")
+	return bw.Flush()
+}
+
+// writeVTA writes the given frames of the model as a VTA file, Source's flex
+// animation format. The first frame is the base the others are compared to,
+// and should be the frame written as the reference SMD file; each following
+// frame lists only the vertices that differ from it.
+func writeVTA(w io.Writer, corners []smdCorner, frames []int) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "version 1\n%sskeleton\n", smdSkeleton)
+	for time := range frames {
+		fmt.Fprintf(bw, "time %d\n%s", time, smdRestPose)
+	}
+	fmt.Fprint(bw, "end\nvertexanimation\n")
+
+	base := make([]string, len(corners))
+	for index, c := range corners {
+		base[index] = smdVertex(c, frames[0])
+	}
+
+	for time, frame := range frames {
+		fmt.Fprintf(bw, "time %d\n", time)
+		for index, c := range corners {
+			vert := base[index]
+			if time > 0 {
+				if vert = smdVertex(c, frame); vert == base[index] {
+					continue
+				}
+			}
+			fmt.Fprintf(bw, "%d %s\n", index, vert)
+		}
+	}
+
+	fmt.Fprintln(bw, "end")
+	return bw.Flush()
+}
+
+// performConvertSMD converts the model in pair to a reference SMD file
+// holding the first frame selected by -frames. If more frames are selected,
+// they're written as a VTA file of the same name, with the first frame as
+// its base. The model's tags aren't converted.
+func performConvertSMD(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	defer func() { signal <- true }()
+
+	modelPath := pair.path
+	frames, err := parseFrameList(*frameList, pair.model.NumFrames())
+	if err != nil {
+		log.Println("Error selecting frames of", modelPath, "->", err)
+		return
+	} else if len(frames) == 0 {
+		log.Println("Error converting", modelPath, "-> model has no frames")
+		return
+	}
+
+	corners := smdCorners(pair.model)
+	dir, name := outputName(modelPath)
+
+	// writeFile creates the named file and writes it with fn.
+	writeFile := func(outName string, fn func(w io.Writer) error) {
+		outPath := path.Join(dir, outName)
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if err := fn(file); err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+		}
+	}
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		writeFile(name+".smd", func(w io.Writer) error {
+			return writeSMD(w, pair, corners, frames[0])
+		})
+		if len(frames) > 1 {
+			writeFile(name+".vta", func(w io.Writer) error {
+				return writeVTA(w, corners, frames)
+			})
+		}
+	}
+	<-done
+}
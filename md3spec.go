@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"github.com/nilium/go-md3/md3"
+	"github.com/nilium/go-md3/md3/skin"
 )
 
 func stringOrEmpty(s, defval string) string {
@@ -12,15 +13,17 @@ func stringOrEmpty(s, defval string) string {
 	return s
 }
 
-func logModelSpec(model *md3.Model) {
+// logModelSpec prints a summary of the model. If s is non-nil, the material
+// it resolves for each surface is printed as well.
+func logModelSpec(model *md3.Model, s *skin.Skin) {
 	fmt.Printf("MD3(%s):\n", stringOrEmpty(model.Name(), "no name"))
 	fmt.Printf("  Frames: %d\n", model.NumFrames())
 	fmt.Printf("  Tags(%d):\n", model.NumTags())
-	for tag := range model.Tags() {
+	for _, tag := range model.AllTags() {
 		fmt.Printf("    %s\n", tag.Name())
 	}
 	fmt.Printf("  Surfaces(%d):\n", model.NumSurfaces())
-	for surf := range model.Surfaces() {
+	for _, surf := range model.AllSurfaces() {
 		fmt.Printf("    %s:\n", stringOrEmpty(surf.Name(), "(no name)"))
 		if surf.NumFrames() != model.NumFrames() {
 			fmt.Printf("      Frames:    %d\n", surf.NumFrames())
@@ -28,15 +31,18 @@ func logModelSpec(model *md3.Model) {
 		fmt.Printf("      Vertices:  %d\n", surf.NumVertices())
 		fmt.Printf("      Triangles: %d\n", surf.NumTriangles())
 		fmt.Printf("      Shaders[%d]:\n", surf.NumShaders())
-		for shader := range surf.Shaders() {
+		for _, shader := range surf.AllShaders() {
 			fmt.Printf("        Shader[%d]: %s\n", shader.Index, stringOrEmpty(shader.Name, "(no name)"))
 		}
+		if s != nil {
+			fmt.Printf("      Material:  %s\n", stringOrEmpty(s.Material(surf), "(none)"))
+		}
 	}
 }
 
 func logModelSpecsProcess(pairs <-chan *modelPathPair, done chan<- bool) {
 	for pair := range pairs {
-		logModelSpec(pair.model)
+		logModelSpec(pair.model, pair.skin)
 	}
 
 	done <- true
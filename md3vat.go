@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/nilium/go-md3/md3"
+)
+
+// maxVATWidth is the widest vertex animation texture written, which every
+// GPU supporting OpenGL 4 or Direct3D 10 can sample. Models with more
+// vertices wrap onto further rows of each frame.
+const maxVATWidth = 4096
+
+var vatEncoding = flag.String("vatEncoding", "png", "The encoding of converted vertex animation textures: png, for 16-bit PNG images, or raw, for float32 binaries.")
+
+// vatInfo is the JSON sidecar of a converted vertex animation texture,
+// describing how to sample it.
+type vatInfo struct {
+	Name         string     `json:"name"`
+	Mesh         string     `json:"mesh"`
+	Positions    string     `json:"positions"`
+	Normals      string     `json:"normals"`
+	Encoding     string     `json:"encoding"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	RowsPerFrame int        `json:"rowsPerFrame"`
+	VertexCount  int        `json:"vertexCount"`
+	FrameCount   int        `json:"frameCount"`
+	Frames       []int      `json:"frames"`
+	BoundsMin    [3]float32 `json:"boundsMin"`
+	BoundsMax    [3]float32 `json:"boundsMax"`
+}
+
+// vatLayout places the model's vertices, surface by surface, in the texels
+// of a vertex animation texture. Each frame is a block of rows holding
+// every vertex, left to right and then top to bottom, and the blocks of the
+// converted frames are stacked in order. Texels past the last vertex of a
+// block are unused.
+type vatLayout struct {
+	numVertices  int
+	width        int
+	rowsPerFrame int
+}
+
+func newVATLayout(numVertices int) vatLayout {
+	width := min(numVertices, maxVATWidth)
+	rows := 0
+	if width > 0 {
+		rows = (numVertices + width - 1) / width
+	}
+	return vatLayout{numVertices: numVertices, width: width, rowsPerFrame: rows}
+}
+
+// texel returns the column and row of the vertex in the frame block.
+func (l vatLayout) texel(vertex, frame int) (x, y int) {
+	return vertex % l.width, frame*l.rowsPerFrame + vertex/l.width
+}
+
+// texCoord returns the texture coordinates of the center of the vertex's
+// texel in the first frame block of a texture with the given number of
+// frames.
+func (l vatLayout) texCoord(vertex, numFrames int) (s, t float32) {
+	x, y := l.texel(vertex, 0)
+	return (float32(x) + 0.5) / float32(l.width), (float32(y) + 0.5) / float32(l.rowsPerFrame*numFrames)
+}
+
+// vatTexture holds a value for each vertex of the model in each of the
+// converted frames, placed by its layout.
+type vatTexture struct {
+	vatLayout
+	height int
+	values []md3.Vec3
+}
+
+func newVATTexture(layout vatLayout, numFrames int) *vatTexture {
+	height := layout.rowsPerFrame * numFrames
+	return &vatTexture{
+		vatLayout: layout,
+		height:    height,
+		values:    make([]md3.Vec3, layout.width*height),
+	}
+}
+
+func (t *vatTexture) at(x, y int) md3.Vec3 {
+	return t.values[y*t.width+x]
+}
+
+func (t *vatTexture) set(vertex, frame int, v md3.Vec3) {
+	x, y := t.texel(vertex, frame)
+	t.values[y*t.width+x] = v
+}
+
+// buildVATTextures returns the positions and normals of every vertex of the
+// model in each of the given frames, in the output axes, along with the
+// bounds of the positions.
+func buildVATTextures(model *md3.Model, frames []int) (positions, normals *vatTexture, mins, maxs md3.Vec3) {
+	layout := newVATLayout(vatVertexCount(model))
+	positions = newVATTexture(layout, len(frames))
+	normals = newVATTexture(layout, len(frames))
+	for block, frame := range frames {
+		vertex := 0
+		for _, surf := range model.AllSurfaces() {
+			for _, vert := range surf.AllVertices(frame) {
+				vert = outputVertex(vert)
+				if block == 0 && vertex == 0 {
+					mins, maxs = vert.Origin, vert.Origin
+				}
+				mins = md3.Vec3{X: min(mins.X, vert.Origin.X), Y: min(mins.Y, vert.Origin.Y), Z: min(mins.Z, vert.Origin.Z)}
+				maxs = md3.Vec3{X: max(maxs.X, vert.Origin.X), Y: max(maxs.Y, vert.Origin.Y), Z: max(maxs.Z, vert.Origin.Z)}
+				positions.set(vertex, block, vert.Origin)
+				normals.set(vertex, block, vert.Normal)
+				vertex++
+			}
+		}
+	}
+	return positions, normals, mins, maxs
+}
+
+// vatVertexCount returns the number of vertices of every surface of the
+// model.
+func vatVertexCount(model *md3.Model) int {
+	count := 0
+	for _, surf := range model.AllSurfaces() {
+		count += surf.NumVertices()
+	}
+	return count
+}
+
+// vatChannel scales v from [lo, hi] to a 16-bit channel value. Ranges of
+// zero extent map to zero.
+func vatChannel(v, lo, hi float32) uint16 {
+	if hi <= lo {
+		return 0
+	}
+	return uint16(min(max((v-lo)/(hi-lo), 0), 1)*0xffff + 0.5)
+}
+
+// writeVATPNG writes the texture as a 16-bit RGB PNG image, with each
+// component scaled from the range [lo, hi] to [0, 1].
+func writeVATPNG(w io.Writer, t *vatTexture, lo, hi md3.Vec3) error {
+	img := image.NewNRGBA64(image.Rect(0, 0, t.width, t.height))
+	for y := range t.height {
+		for x := range t.width {
+			v := t.at(x, y)
+			img.SetNRGBA64(x, y, color.NRGBA64{
+				R: vatChannel(v.X, lo.X, hi.X),
+				G: vatChannel(v.Y, lo.Y, hi.Y),
+				B: vatChannel(v.Z, lo.Z, hi.Z),
+				A: 0xffff,
+			})
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// writeVATRaw writes the texture as little-endian float32 RGB texels, row by
+// row, with no header.
+func writeVATRaw(w io.Writer, t *vatTexture) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range t.values {
+		binary.Write(bw, binary.LittleEndian, [3]float32{v.X, v.Y, v.Z})
+	}
+	return bw.Flush()
+}
+
+// buildVATMesh converts the given frame of the model in pair to a static
+// glTF mesh with a primitive for each surface. Each vertex's second texcoord
+// is the center of its texel in the first frame block of vertex animation
+// textures with numFrames frames.
+func buildVATMesh(pair *modelPathPair, frame, numFrames int) *gltfBuilder {
+	model := pair.model
+	b := &gltfBuilder{shaders: pair.shaders}
+	b.doc.Asset = gltfAsset{Version: "2.0", Generator: "go-md3"}
+	b.doc.Scenes = []gltfScene{{Nodes: []int{0}}}
+	b.doc.Nodes = []gltfNode{{Name: model.Name()}}
+
+	layout := newVATLayout(vatVertexCount(model))
+	mesh := gltfMesh{Name: model.Name()}
+	firstVertex := 0
+	for _, surf := range model.AllSurfaces() {
+		// glTF doesn't allow empty accessors, so empty surfaces are dropped,
+		// though their texels of the textures are still skipped.
+		numVertices := surf.NumVertices()
+		if numVertices == 0 || surf.NumTriangles() == 0 {
+			firstVertex += numVertices
+			continue
+		}
+
+		positions := make([]float32, 0, 3*numVertices)
+		normals := make([]float32, 0, 3*numVertices)
+		texcoords := make([]float32, 0, 2*numVertices)
+		ids := make([]float32, 0, 2*numVertices)
+		for index, vert := range surf.AllVertices(frame) {
+			vert = outputVertex(vert)
+			positions = appendVec3(positions, vert.Origin)
+			normals = appendVec3(normals, vert.Normal)
+			tc := surf.TexCoord(index)
+			texcoords = append(texcoords, tc.S, tc.T)
+			s, t := layout.texCoord(firstVertex+index, numFrames)
+			ids = append(ids, s, t)
+		}
+		firstVertex += numVertices
+
+		indices := make([]uint16, 0, 3*surf.NumTriangles())
+		for _, tri := range surf.AllTriangles() {
+			for _, index := range outputTriangle(tri) {
+				indices = append(indices, uint16(index))
+			}
+		}
+
+		prim := gltfPrimitive{
+			Attributes: map[string]int{
+				"POSITION":   b.addFloats(positions, "VEC3", gltfArrayBuffer, true),
+				"NORMAL":     b.addFloats(normals, "VEC3", gltfArrayBuffer, false),
+				"TEXCOORD_0": b.addFloats(texcoords, "VEC2", gltfArrayBuffer, false),
+				"TEXCOORD_1": b.addFloats(ids, "VEC2", gltfArrayBuffer, false),
+			},
+			Indices: b.addIndices(indices),
+		}
+		if material := pair.skin.Material(surf); material != "" {
+			index := b.addMaterial(material)
+			prim.Material = &index
+		}
+		mesh.Primitives = append(mesh.Primitives, prim)
+	}
+
+	if len(mesh.Primitives) > 0 {
+		b.doc.Meshes = append(b.doc.Meshes, mesh)
+		meshIndex := 0
+		b.doc.Nodes[0].Mesh = &meshIndex
+	}
+	return b
+}
+
+// performConvertVAT converts the model in pair to vertex animation
+// textures: a static <basename>.glb mesh of the first frame selected by
+// -frames, position and normal textures with a block of rows holding every
+// vertex for each selected frame, and a <basename>.vat.json file describing
+// them. Positions are scaled to the bounds given in the JSON file and
+// normals from [-1, 1] when written as PNG images.
+func performConvertVAT(pair *modelPathPair, signal chan<- bool, writeQueue chan<- func()) {
+	defer func() { signal <- true }()
+
+	modelPath, model := pair.path, pair.model
+	frames, err := parseFrameList(*frameList, model.NumFrames())
+	if err != nil {
+		log.Println("Error selecting frames of", modelPath, "->", err)
+		return
+	} else if len(frames) == 0 {
+		log.Println("Error converting", modelPath, "-> model has no frames")
+		return
+	}
+
+	dir, name := outputName(modelPath)
+	positions, normals, mins, maxs := buildVATTextures(model, frames)
+	if positions.width == 0 {
+		log.Println("Error converting", modelPath, "-> model has no vertices")
+		return
+	}
+
+	ext := ".png"
+	switch *vatEncoding {
+	case "png":
+	case "raw":
+		ext = ".bin"
+	default:
+		log.Println("Error converting", modelPath, "-> invalid VAT encoding", *vatEncoding)
+		return
+	}
+
+	info := vatInfo{
+		Name:         model.Name(),
+		Mesh:         name + ".glb",
+		Positions:    name + "_positions" + ext,
+		Normals:      name + "_normals" + ext,
+		Encoding:     *vatEncoding,
+		Width:        positions.width,
+		Height:       positions.height,
+		RowsPerFrame: positions.rowsPerFrame,
+		VertexCount:  positions.numVertices,
+		FrameCount:   len(frames),
+		Frames:       frames,
+		BoundsMin:    [3]float32{mins.X, mins.Y, mins.Z},
+		BoundsMax:    [3]float32{maxs.X, maxs.Y, maxs.Z},
+	}
+	mesh := buildVATMesh(pair, frames[0], len(frames))
+
+	// writeFile creates the named file and writes it with fn.
+	writeFile := func(outName string, fn func(w io.Writer) error) {
+		outPath := path.Join(dir, outName)
+		file, err := os.Create(outPath)
+		if err != nil {
+			log.Println("Error creating", outPath, "from", modelPath, "->", err)
+			return
+		}
+		defer file.Close()
+
+		if err := fn(file); err != nil {
+			log.Println("Error writing", outPath, "from", modelPath, "->", err)
+		}
+	}
+
+	done := make(chan bool)
+	writeQueue <- func() {
+		defer func() { go func() { done <- true }() }()
+
+		writeFile(info.Mesh, func(w io.Writer) error {
+			return writeGLB(w, mesh)
+		})
+
+		unit := md3.Vec3{X: 1, Y: 1, Z: 1}
+		for _, t := range [...]struct {
+			name     string
+			texture  *vatTexture
+			min, max md3.Vec3
+		}{
+			{info.Positions, positions, mins, maxs},
+			{info.Normals, normals, unit.Scale(-1), unit},
+		} {
+			writeFile(t.name, func(w io.Writer) error {
+				if *vatEncoding == "raw" {
+					return writeVATRaw(w, t.texture)
+				}
+				return writeVATPNG(w, t.texture, t.min, t.max)
+			})
+		}
+
+		writeFile(name+".vat.json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(info)
+		})
+	}
+	<-done
+}